@@ -27,12 +27,36 @@ type Stmt interface {
 	stmt()
 }
 
+// TypeExpr represents a type annotation, such as number, Point[] or string | nil.
+// Annotations are only used by the checker, the interpreter ignores them.
+type TypeExpr interface {
+	Node
+	typeExpr()
+}
+
+// Pattern represents a destructuring target, such as [a, b, ...rest] or {x, y}.
+// Declarations bind names by Ident, while assignments may also target
+// variables, properties and indexes.
+type Pattern interface {
+	Node
+	pattern()
+}
+
 func (*Ident) node() {}
 
+func (*NamedType) node() {}
+func (*ArrayType) node() {}
+func (*UnionType) node() {}
+
+func (*NamedType) typeExpr() {}
+func (*ArrayType) typeExpr() {}
+func (*UnionType) typeExpr() {}
+
+func (*Param) node() {}
+
 func (*Literal) node() {}
 
 func (*AssignExpr) node()        {}
-func (*ArrayAssignExpr) node()   {}
 func (*BinaryExpr) node()        {}
 func (*CallExpr) node()          {}
 func (*GetExpr) node()           {}
@@ -44,20 +68,41 @@ func (*ThisExpr) node()          {}
 func (*UnaryExpr) node()         {}
 func (*VariableExpr) node()      {}
 func (*ArrayLiteralExpr) node()  {}
-func (*IndexLiteralExpr) node()  {}
-func (*IndexVariableExpr) node() {}
-
-func (*BlockStmt) node()    {}
-func (*ClassStmt) node()    {}
-func (*ExprStmt) node()     {}
-func (*FunctionStmt) node() {}
-func (*IfStmt) node()       {}
-func (*PrintStmt) node()    {}
-func (*ReturnStmt) node()   {}
-func (*VarStmt) node()      {}
-func (*LetStmt) node()      {}
-func (*WhileStmt) node()    {}
-func (*ImportStmt) node()   {}
+func (*IndexExpr) node()         {}
+func (*IndexSetExpr) node()      {}
+func (*SliceExpr) node()         {}
+func (*SpreadExpr) node()        {}
+func (*NamedArgExpr) node()      {}
+func (*PatternAssignExpr) node() {}
+func (*TemplateExpr) node()      {}
+func (*YieldExpr) node()         {}
+func (*SpawnExpr) node()         {}
+func (*AwaitExpr) node()         {}
+func (*MatchExpr) node()         {}
+
+func (*BlockStmt) node()       {}
+func (*ClassStmt) node()       {}
+func (*ExprStmt) node()        {}
+func (*FunctionStmt) node()    {}
+func (*IfStmt) node()          {}
+func (*PrintStmt) node()       {}
+func (*ReturnStmt) node()      {}
+func (*VarStmt) node()         {}
+func (*LetStmt) node()         {}
+func (*ConstStmt) node()       {}
+func (*DestructureStmt) node() {}
+func (*ForInStmt) node()       {}
+func (*WhileStmt) node()       {}
+func (*ImportStmt) node()      {}
+func (*SelectStmt) node()      {}
+func (*SelectCase) node()      {}
+func (*MatchStmt) node()       {}
+func (*MatchArm) node()        {}
+func (*EnumStmt) node()        {}
+func (*DeferStmt) node()       {}
+func (*TraitStmt) node()       {}
+func (*EnumVariant) node()     {}
+func (*FieldDecl) node()       {}
 
 // Ident represents an identifier.
 type Ident struct {
@@ -66,6 +111,148 @@ type Ident struct {
 
 func (ident *Ident) String() string { return ident.Name }
 
+type (
+	// NamedType 命名类型，如 number、string、Point
+	NamedType struct {
+		Name string
+	}
+	// ArrayType 数组类型，如 number[]
+	ArrayType struct {
+		Element TypeExpr
+	}
+	// UnionType 联合类型，如 string | nil
+	UnionType struct {
+		Types []TypeExpr
+	}
+)
+
+func (t *NamedType) String() string { return t.Name }
+
+func (t *ArrayType) String() string {
+	if _, ok := t.Element.(*UnionType); ok {
+		return "(" + t.Element.String() + ")[]"
+	}
+	return t.Element.String() + "[]"
+}
+
+func (t *UnionType) String() string {
+	types := make([]string, len(t.Types))
+	for i, typ := range t.Types {
+		types[i] = typ.String()
+	}
+	return strings.Join(types, " | ")
+}
+
+// annotation returns the annotation of typ to print after a name.
+func annotation(typ TypeExpr) string {
+	if typ == nil {
+		return ""
+	}
+	return ": " + typ.String()
+}
+
+// Param represents a function parameter, such as a, b = 10, ...args or [x, y].
+type Param struct {
+	Name    string
+	Pattern Pattern  // not nil if the parameter is destructured, Name is empty then.
+	Default Expr     // nil if the parameter has no default value.
+	Rest    bool     // rest parameter collects the remaining arguments into an array.
+	Type    TypeExpr // nil if the parameter is not annotated.
+}
+
+func (p *Param) String() string {
+	name := p.Name
+	if p.Pattern != nil {
+		name = p.Pattern.String()
+	}
+	name += annotation(p.Type)
+	if p.Rest {
+		return "..." + name
+	}
+	if p.Default != nil {
+		return name + " = " + p.Default.String()
+	}
+	return name
+}
+
+type (
+	// ArrayPattern 数组解构，如 [a, b, ...rest]
+	ArrayPattern struct {
+		Elements []Pattern
+		Rest     Pattern // nil if there is no rest element.
+	}
+	// ObjectPattern 对象解构，如 {x, y: alias}
+	ObjectPattern struct {
+		Fields []*FieldPattern
+	}
+	// FieldPattern 对象解构中的字段，Value 为绑定的目标
+	FieldPattern struct {
+		Key   string
+		Value Pattern
+	}
+)
+
+func (*ArrayPattern) node()  {}
+func (*ObjectPattern) node() {}
+func (*FieldPattern) node()  {}
+
+func (*Ident) pattern()         {}
+func (*ArrayPattern) pattern()  {}
+func (*ObjectPattern) pattern() {}
+func (*VariableExpr) pattern()  {}
+func (*GetExpr) pattern()       {}
+func (*IndexExpr) pattern()     {}
+
+func (p *ArrayPattern) String() string {
+	elements := make([]string, 0, len(p.Elements)+1)
+	for _, e := range p.Elements {
+		elements = append(elements, e.String())
+	}
+	if p.Rest != nil {
+		elements = append(elements, "..."+p.Rest.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+func (p *ObjectPattern) String() string {
+	fields := make([]string, len(p.Fields))
+	for i, f := range p.Fields {
+		fields[i] = f.String()
+	}
+	return "{" + strings.Join(fields, ", ") + "}"
+}
+
+func (f *FieldPattern) String() string {
+	if ident, ok := f.Value.(*Ident); ok && ident.Name == f.Key {
+		return f.Key
+	}
+	return f.Key + ": " + f.Value.String()
+}
+
+// PatternNames returns the names bound by the declaration pattern p.
+func PatternNames(p Pattern) []string {
+	switch n := p.(type) {
+	case *Ident:
+		return []string{n.Name}
+	case *ArrayPattern:
+		var names []string
+		for _, e := range n.Elements {
+			names = append(names, PatternNames(e)...)
+		}
+		if n.Rest != nil {
+			names = append(names, PatternNames(n.Rest)...)
+		}
+		return names
+	case *ObjectPattern:
+		var names []string
+		for _, f := range n.Fields {
+			names = append(names, PatternNames(f.Value)...)
+		}
+		return names
+	}
+	return nil
+}
+
 type Literal struct {
 	Token token.Token
 	Value string
@@ -100,12 +287,6 @@ type (
 		Operator token.Token
 		Right    Expr
 	}
-	// ArrayAssignExpr 数组赋值表达式
-	ArrayAssignExpr struct {
-		Left  *VariableExpr
-		Index Expr
-		Value Expr
-	}
 	// CallExpr 函数调用表达式
 	CallExpr struct {
 		Callee    Expr
@@ -154,21 +335,63 @@ type (
 		Elements []Expr
 		Distance int // -1 represents global variable.
 	}
-	// IndexLiteralExpr 数组索引表达式（通过字面量获取）
-	IndexLiteralExpr struct {
-		Left  Expr
-		Index Expr
+	// IndexExpr 索引表达式，如 a[i]、grid[i][j]、f()[0]
+	IndexExpr struct {
+		Object Expr
+		Index  Expr
+	}
+	// IndexSetExpr 索引赋值表达式，如 a[i] = v
+	IndexSetExpr struct {
+		Object Expr
+		Index  Expr
+		Value  Expr
+	}
+	// SliceExpr 切片表达式，如 a[start:end:step]，省略的部分为 nil
+	SliceExpr struct {
+		Object Expr
+		Start  Expr
+		End    Expr
+		Step   Expr
+	}
+	// SpreadExpr 调用时展开数组参数，如 f(...arr)
+	SpreadExpr struct {
+		Expression Expr
 	}
-	// IndexVariableExpr 数组索引赋值表达式（通过变量获取）
-	IndexVariableExpr struct {
+	// NamedArgExpr 调用时的关键字参数，如 f(b: 1)
+	NamedArgExpr struct {
 		Name  string
-		Left  Expr
-		Index Expr
+		Value Expr
+	}
+	// PatternAssignExpr 解构赋值表达式，如 [a, b] = [b, a]
+	PatternAssignExpr struct {
+		Pattern *ArrayPattern
+		Value   Expr
+	}
+	// TemplateExpr 模板字符串，如 `a${b}c`，Texts 比 Exprs 多一个
+	TemplateExpr struct {
+		Texts []string
+		Exprs []Expr
+	}
+	// YieldExpr 生成器的 yield 表达式，Value 为 nil 时产出 nil
+	YieldExpr struct {
+		Value Expr
+	}
+	// SpawnExpr 在新的 goroutine 中运行函数调用，返回任务句柄，如 spawn f(x)
+	SpawnExpr struct {
+		Call *CallExpr
+	}
+	// AwaitExpr 在异步函数中等待 Promise 完成，如 await fetch()
+	AwaitExpr struct {
+		Value Expr
+	}
+	// MatchExpr match 表达式，分支的 Body 为表达式，如 match (x) { 1 => "one", _ => "many" }
+	MatchExpr struct {
+		Value Expr
+		Arms  []*MatchArm
 	}
 )
 
 func (*AssignExpr) expr()        {}
-func (*ArrayAssignExpr) expr()   {}
 func (*BinaryExpr) expr()        {}
 func (*CallExpr) expr()          {}
 func (*GetExpr) expr()           {}
@@ -180,17 +403,22 @@ func (*ThisExpr) expr()          {}
 func (*UnaryExpr) expr()         {}
 func (*VariableExpr) expr()      {}
 func (*ArrayLiteralExpr) expr()  {}
-func (*IndexLiteralExpr) expr()  {}
-func (*IndexVariableExpr) expr() {}
+func (*IndexExpr) expr()         {}
+func (*IndexSetExpr) expr()      {}
+func (*SliceExpr) expr()         {}
+func (*SpreadExpr) expr()        {}
+func (*NamedArgExpr) expr()      {}
+func (*PatternAssignExpr) expr() {}
+func (*TemplateExpr) expr()      {}
+func (*YieldExpr) expr()         {}
+func (*SpawnExpr) expr()         {}
+func (*AwaitExpr) expr()         {}
+func (*MatchExpr) expr()         {}
 
 func (e *AssignExpr) String() string {
 	return fmt.Sprintf("%s = %s", e.Left, e.Value)
 }
 
-func (e *ArrayAssignExpr) String() string {
-	return fmt.Sprintf("%s = %s", e.Left, e.Value)
-}
-
 func (e *BinaryExpr) String() string {
 	return fmt.Sprintf("(%s %s %s)", e.Left, e.Operator, e.Right)
 }
@@ -247,12 +475,74 @@ func (e *ArrayLiteralExpr) String() string {
 	return buff.String()
 }
 
-func (e *IndexLiteralExpr) String() string {
-	return fmt.Sprintf("%s[%s]", e.Left.String(), e.Index.String())
+func (e *IndexExpr) String() string {
+	return fmt.Sprintf("%s[%s]", e.Object, e.Index)
 }
 
-func (e *IndexVariableExpr) String() string {
-	return fmt.Sprintf("%s[%s]", e.Name, e.Index.String())
+func (e *IndexSetExpr) String() string {
+	return fmt.Sprintf("%s[%s] = %s", e.Object, e.Index, e.Value)
+}
+
+func (e *SliceExpr) String() string {
+	part := func(expr Expr) string {
+		if expr == nil {
+			return ""
+		}
+		return expr.String()
+	}
+	s := e.Object.String() + "[" + part(e.Start) + ":" + part(e.End)
+	if e.Step != nil {
+		s += ":" + part(e.Step)
+	}
+	return s + "]"
+}
+
+func (e *SpreadExpr) String() string {
+	return "..." + e.Expression.String()
+}
+
+func (e *NamedArgExpr) String() string {
+	return e.Name + ": " + e.Value.String()
+}
+
+func (e *PatternAssignExpr) String() string {
+	return fmt.Sprintf("%s = %s", e.Pattern, e.Value)
+}
+
+func (e *YieldExpr) String() string {
+	if e.Value == nil {
+		return "yield"
+	}
+	return "yield " + e.Value.String()
+}
+
+func (e *SpawnExpr) String() string {
+	return "spawn " + e.Call.String()
+}
+
+func (e *AwaitExpr) String() string {
+	return "await " + e.Value.String()
+}
+
+func (e *MatchExpr) String() string {
+	arms := make([]string, len(e.Arms))
+	for i, arm := range e.Arms {
+		arms[i] = arm.String()
+	}
+	return fmt.Sprintf("match (%s) { %s }", e.Value, strings.Join(arms, ", "))
+}
+
+func (e *TemplateExpr) String() string {
+	var b strings.Builder
+	b.WriteString("`")
+	for i, text := range e.Texts {
+		b.WriteString(text)
+		if i < len(e.Exprs) {
+			b.WriteString("${" + e.Exprs[i].String() + "}")
+		}
+	}
+	b.WriteString("`")
+	return b.String()
 }
 
 type (
@@ -260,9 +550,27 @@ type (
 		Statements []Stmt
 	}
 	ClassStmt struct {
-		Name       string
-		SuperClass VariableExpr
-		Methods    []*FunctionStmt
+		Name          string
+		SuperClass    VariableExpr
+		Methods       []*FunctionStmt
+		Getters       []*FunctionStmt
+		Setters       []*FunctionStmt
+		Fields        []*FieldDecl // initialized for each instance before init runs
+		StaticMethods []*FunctionStmt
+		StaticFields  []*FieldDecl
+		Traits        []*VariableExpr // traits mixed in by with
+	}
+	// TraitStmt trait 声明，Methods 为默认方法，Required 为使用它的类必须实现的方法（没有方法体）
+	TraitStmt struct {
+		Name     string
+		Methods  []*FunctionStmt
+		Required []*FunctionStmt
+	}
+	// FieldDecl 类的字段声明，如 count = 0; Initializer 为 nil 时初始值为 nil
+	FieldDecl struct {
+		Name        string
+		Type        TypeExpr
+		Initializer Expr
 	}
 	ImportStmt struct {
 		Name        string
@@ -273,9 +581,12 @@ type (
 	}
 	FunctionStmt struct {
 		Name          string
-		Params        []*Ident
+		Params        []*Param
 		Body          []Stmt
 		IsInitializer bool
+		IsGenerator   bool // the body contains yield
+		IsAsync       bool // declared with async, a call returns a promise
+		ReturnType    TypeExpr
 	}
 	IfStmt struct {
 		Condition  Expr
@@ -289,31 +600,96 @@ type (
 		Keyword token.Token
 		Value   Expr
 	}
+	// DeferStmt defer 语句，Expression 在函数返回或出错时求值，后 defer 的先执行
+	DeferStmt struct {
+		Expression Expr
+	}
 	VarStmt struct {
 		Name        *Ident
+		Type        TypeExpr
 		Initializer Expr
 	}
 	LetStmt struct {
 		Name        *Ident
+		Type        TypeExpr
+		Initializer Expr
+	}
+	ConstStmt struct {
+		Name        *Ident
+		Type        TypeExpr
 		Initializer Expr
 	}
 	WhileStmt struct {
 		Condition Expr
 		Body      Stmt
 	}
+	// DestructureStmt 解构声明，如 let [a, b] = arr; Kind 为 var、let 或 const
+	DestructureStmt struct {
+		Kind        token.Token
+		Pattern     Pattern
+		Initializer Expr
+	}
+	// ForInStmt 遍历数组或字符串，如 for (let x in arr) {}
+	ForInStmt struct {
+		Kind     token.Token
+		Target   Pattern
+		Iterable Expr
+		Body     Stmt
+	}
+	// SelectStmt 执行第一个就绪的通道操作，没有就绪的操作时执行 Default 或阻塞
+	SelectStmt struct {
+		Cases   []*SelectCase
+		Default *BlockStmt // nil if there is no default case.
+	}
+	// MatchStmt match 语句，执行第一个模式匹配且守卫成立的分支
+	MatchStmt struct {
+		Value Expr
+		Arms  []*MatchArm
+	}
+	// MatchArm match 的分支，Guard 为 nil 时没有守卫，Body 为语句或表达式
+	MatchArm struct {
+		Pattern MatchPattern
+		Guard   Expr
+		Body    Node
+	}
+	// EnumStmt 枚举声明，如 enum Color { Red, Green = 2, Circle(r) }
+	EnumStmt struct {
+		Name     string
+		Variants []*EnumVariant
+	}
+	// EnumVariant 枚举变体，Value 为显式的值，Params 不为 nil 时变体携带数据
+	EnumVariant struct {
+		Name   string
+		Value  Expr
+		Params []string
+	}
+	// SelectCase select 的分支，Comm 为 ch.recv() 或 ch.send(v)，Name 绑定接收的值
+	SelectCase struct {
+		Name string // empty if the received value is not bound.
+		Comm *CallExpr
+		Body *BlockStmt
+	}
 )
 
-func (*BlockStmt) stmt()    {}
-func (*ClassStmt) stmt()    {}
-func (*ExprStmt) stmt()     {}
-func (*FunctionStmt) stmt() {}
-func (*IfStmt) stmt()       {}
-func (*PrintStmt) stmt()    {}
-func (*ReturnStmt) stmt()   {}
-func (*VarStmt) stmt()      {}
-func (*LetStmt) stmt()      {}
-func (*WhileStmt) stmt()    {}
-func (*ImportStmt) stmt()   {}
+func (*BlockStmt) stmt()       {}
+func (*ClassStmt) stmt()       {}
+func (*ExprStmt) stmt()        {}
+func (*FunctionStmt) stmt()    {}
+func (*IfStmt) stmt()          {}
+func (*PrintStmt) stmt()       {}
+func (*ReturnStmt) stmt()      {}
+func (*VarStmt) stmt()         {}
+func (*LetStmt) stmt()         {}
+func (*ConstStmt) stmt()       {}
+func (*DestructureStmt) stmt() {}
+func (*ForInStmt) stmt()       {}
+func (*WhileStmt) stmt()       {}
+func (*ImportStmt) stmt()      {}
+func (*SelectStmt) stmt()      {}
+func (*MatchStmt) stmt()       {}
+func (*EnumStmt) stmt()        {}
+func (*DeferStmt) stmt()       {}
+func (*TraitStmt) stmt()       {}
 
 func (i *ImportStmt) String() string {
 	return "import" + i.Name
@@ -330,7 +706,42 @@ func (s *BlockStmt) String() string {
 }
 
 func (s *ClassStmt) String() string {
-	return "class " + s.Name
+	if len(s.Traits) == 0 {
+		return "class " + s.Name
+	}
+	traits := make([]string, len(s.Traits))
+	for i, t := range s.Traits {
+		traits[i] = t.Name
+	}
+	return "class " + s.Name + " with " + strings.Join(traits, ", ")
+}
+
+func (s *TraitStmt) String() string {
+	return "trait " + s.Name
+}
+
+// Declares reports whether the class declares the instance member name.
+func (s *ClassStmt) Declares(name string) bool {
+	for _, methods := range [][]*FunctionStmt{s.Methods, s.Getters, s.Setters} {
+		for _, method := range methods {
+			if method.Name == name {
+				return true
+			}
+		}
+	}
+	for _, field := range s.Fields {
+		if field.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *FieldDecl) String() string {
+	if f.Initializer == nil {
+		return f.Name + annotation(f.Type) + ";"
+	}
+	return f.Name + annotation(f.Type) + " = " + f.Initializer.String() + ";"
 }
 
 func (s *ExprStmt) String() string {
@@ -339,15 +750,20 @@ func (s *ExprStmt) String() string {
 
 func (s *FunctionStmt) String() string {
 	var sb strings.Builder
+	if s.IsAsync {
+		sb.WriteString("async ")
+	}
 	sb.WriteString("fun ")
 	sb.WriteString(s.Name)
 	sb.WriteString("(")
 	params := make([]string, len(s.Params))
 	for i, p := range s.Params {
-		params[i] = p.Name
+		params[i] = p.String()
 	}
 	sb.WriteString(strings.Join(params, ", "))
-	sb.WriteString(") { ")
+	sb.WriteString(")")
+	sb.WriteString(annotation(s.ReturnType))
+	sb.WriteString(" { ")
 	for _, stmt := range s.Body {
 		sb.WriteString(stmt.String())
 	}
@@ -384,12 +800,19 @@ func (s *ReturnStmt) String() string {
 	return str + ";"
 }
 
+func (s *DeferStmt) String() string {
+	return "defer " + s.Expression.String() + ";"
+}
+
 func (s *VarStmt) String() string {
 	var sb strings.Builder
 	sb.WriteString("var ")
 	sb.WriteString(s.Name.String())
-	sb.WriteString(" = ")
-	sb.WriteString(s.Initializer.String())
+	sb.WriteString(annotation(s.Type))
+	if s.Initializer != nil {
+		sb.WriteString(" = ")
+		sb.WriteString(s.Initializer.String())
+	}
 	sb.WriteRune(';')
 	return sb.String()
 }
@@ -398,8 +821,24 @@ func (s *LetStmt) String() string {
 	var sb strings.Builder
 	sb.WriteString("let ")
 	sb.WriteString(s.Name.String())
-	sb.WriteString(" = ")
-	sb.WriteString(s.Initializer.String())
+	sb.WriteString(annotation(s.Type))
+	if s.Initializer != nil {
+		sb.WriteString(" = ")
+		sb.WriteString(s.Initializer.String())
+	}
+	sb.WriteRune(';')
+	return sb.String()
+}
+
+func (s *ConstStmt) String() string {
+	var sb strings.Builder
+	sb.WriteString("const ")
+	sb.WriteString(s.Name.String())
+	sb.WriteString(annotation(s.Type))
+	if s.Initializer != nil {
+		sb.WriteString(" = ")
+		sb.WriteString(s.Initializer.String())
+	}
 	sb.WriteRune(';')
 	return sb.String()
 }
@@ -412,3 +851,233 @@ func (s *WhileStmt) String() string {
 	sb.WriteString(s.Body.String())
 	return sb.String()
 }
+
+func (s *DestructureStmt) String() string {
+	return fmt.Sprintf("%s %s = %s;", s.Kind, s.Pattern, s.Initializer)
+}
+
+func (s *ForInStmt) String() string {
+	return fmt.Sprintf("for (%s %s in %s) %s", s.Kind, s.Target, s.Iterable, s.Body)
+}
+
+func (s *SelectStmt) String() string {
+	var sb strings.Builder
+	sb.WriteString("select { ")
+	for _, c := range s.Cases {
+		sb.WriteString(c.String())
+		sb.WriteString(" ")
+	}
+	if s.Default != nil {
+		sb.WriteString("default ")
+		sb.WriteString(s.Default.String())
+		sb.WriteString(" ")
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+func (c *SelectCase) String() string {
+	if c.Name != "" {
+		return fmt.Sprintf("case let %s = %s %s", c.Name, c.Comm, c.Body)
+	}
+	return fmt.Sprintf("case %s %s", c.Comm, c.Body)
+}
+
+func (s *MatchStmt) String() string {
+	arms := make([]string, len(s.Arms))
+	for i, arm := range s.Arms {
+		arms[i] = arm.String()
+	}
+	return fmt.Sprintf("match (%s) { %s }", s.Value, strings.Join(arms, " "))
+}
+
+func (a *MatchArm) String() string {
+	s := a.Pattern.String()
+	if a.Guard != nil {
+		s += " if " + a.Guard.String()
+	}
+	return s + " => " + a.Body.String()
+}
+
+func (s *EnumStmt) String() string {
+	variants := make([]string, len(s.Variants))
+	for i, v := range s.Variants {
+		variants[i] = v.String()
+	}
+	return "enum " + s.Name + " { " + strings.Join(variants, ", ") + " }"
+}
+
+func (v *EnumVariant) String() string {
+	if v.Params != nil {
+		return v.Name + "(" + strings.Join(v.Params, ", ") + ")"
+	}
+	if v.Value != nil {
+		return v.Name + " = " + v.Value.String()
+	}
+	return v.Name
+}
+
+// MatchPattern represents a pattern of a match arm, it tests a value and binds
+// the names it captures.
+type MatchPattern interface {
+	Node
+	matchPattern()
+}
+
+type (
+	// WildcardPattern 通配符 _，匹配任意值
+	WildcardPattern struct{}
+	// BindingPattern 匹配任意值并绑定到变量
+	BindingPattern struct {
+		Name string
+	}
+	// ValuePattern 字面量模式，值相等时匹配，如 1、"a"、-2、nil
+	ValuePattern struct {
+		Value Expr
+	}
+	// RangePattern 范围模式，如 1..10（不含 10）、1..=10
+	RangePattern struct {
+		Low       Expr
+		High      Expr
+		Inclusive bool
+	}
+	// OrPattern 多个备选模式，如 1 | 2 | 3
+	OrPattern struct {
+		Alternatives []MatchPattern
+	}
+	// ListPattern 数组模式，如 [first, ...rest]，Rest 为 nil 时长度必须相等
+	ListPattern struct {
+		Elements []MatchPattern
+		Rest     MatchPattern
+	}
+	// FieldsPattern 字段模式，如 {x: 0, y} 或带类型的 Point{x, y}
+	FieldsPattern struct {
+		Class  *VariableExpr // nil if any instance matches.
+		Fields []*FieldMatch
+	}
+	// EnumPattern 枚举变体模式，如 Color.Red 或 Shape.Circle(r)，Args 为 nil 时不匹配字段
+	EnumPattern struct {
+		Enum    *VariableExpr
+		Variant string
+		Args    []MatchPattern
+	}
+	// FieldMatch 字段模式中的字段
+	FieldMatch struct {
+		Key     string
+		Pattern MatchPattern
+	}
+)
+
+func (*WildcardPattern) node() {}
+func (*BindingPattern) node()  {}
+func (*ValuePattern) node()    {}
+func (*RangePattern) node()    {}
+func (*OrPattern) node()       {}
+func (*ListPattern) node()     {}
+func (*FieldsPattern) node()   {}
+func (*FieldMatch) node()      {}
+func (*EnumPattern) node()     {}
+
+func (*WildcardPattern) matchPattern() {}
+func (*BindingPattern) matchPattern()  {}
+func (*ValuePattern) matchPattern()    {}
+func (*RangePattern) matchPattern()    {}
+func (*OrPattern) matchPattern()       {}
+func (*ListPattern) matchPattern()     {}
+func (*FieldsPattern) matchPattern()   {}
+func (*EnumPattern) matchPattern()     {}
+
+func (*WildcardPattern) String() string { return "_" }
+
+func (p *BindingPattern) String() string { return p.Name }
+
+func (p *ValuePattern) String() string { return p.Value.String() }
+
+func (p *RangePattern) String() string {
+	if p.Inclusive {
+		return p.Low.String() + "..=" + p.High.String()
+	}
+	return p.Low.String() + ".." + p.High.String()
+}
+
+func (p *OrPattern) String() string {
+	alternatives := make([]string, len(p.Alternatives))
+	for i, alt := range p.Alternatives {
+		alternatives[i] = alt.String()
+	}
+	return strings.Join(alternatives, " | ")
+}
+
+func (p *ListPattern) String() string {
+	elements := make([]string, 0, len(p.Elements)+1)
+	for _, e := range p.Elements {
+		elements = append(elements, e.String())
+	}
+	if p.Rest != nil {
+		elements = append(elements, "..."+p.Rest.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+func (p *FieldsPattern) String() string {
+	fields := make([]string, len(p.Fields))
+	for i, f := range p.Fields {
+		fields[i] = f.String()
+	}
+	s := "{" + strings.Join(fields, ", ") + "}"
+	if p.Class != nil {
+		return p.Class.Name + s
+	}
+	return s
+}
+
+func (p *EnumPattern) String() string {
+	s := p.Enum.Name + "." + p.Variant
+	if p.Args == nil {
+		return s
+	}
+	args := make([]string, len(p.Args))
+	for i, arg := range p.Args {
+		args[i] = arg.String()
+	}
+	return s + "(" + strings.Join(args, ", ") + ")"
+}
+
+func (f *FieldMatch) String() string {
+	if b, ok := f.Pattern.(*BindingPattern); ok && b.Name == f.Key {
+		return f.Key
+	}
+	return f.Key + ": " + f.Pattern.String()
+}
+
+// MatchPatternNames returns the names bound by the match pattern p.
+func MatchPatternNames(p MatchPattern) []string {
+	switch n := p.(type) {
+	case *BindingPattern:
+		return []string{n.Name}
+	case *OrPattern:
+		return MatchPatternNames(n.Alternatives[0])
+	case *ListPattern:
+		var names []string
+		for _, e := range n.Elements {
+			names = append(names, MatchPatternNames(e)...)
+		}
+		if n.Rest != nil {
+			names = append(names, MatchPatternNames(n.Rest)...)
+		}
+		return names
+	case *FieldsPattern:
+		var names []string
+		for _, f := range n.Fields {
+			names = append(names, MatchPatternNames(f.Pattern)...)
+		}
+		return names
+	case *EnumPattern:
+		var names []string
+		for _, arg := range n.Args {
+			names = append(names, MatchPatternNames(arg)...)
+		}
+		return names
+	}
+	return nil
+}
@@ -0,0 +1,1042 @@
+// Package checker infers the types of expressions and reports the values that
+// don't match the type annotations. Annotations are optional, a value whose
+// type is unknown is of type any and is accepted anywhere.
+package checker
+
+import (
+	"fmt"
+	"strings"
+
+	"tiny-script/ast"
+	"tiny-script/token"
+)
+
+// typeError is a type mismatch found by the checker.
+type typeError struct {
+	s string
+}
+
+func (e *typeError) Error() string {
+	return e.s
+}
+
+// builtins are the signatures of the builtin functions of the interpreter.
+var builtins = []*funcType{
+	{name: "int", min: 1, max: 1, ret: intType},
+	{name: "float", min: 1, max: 1, ret: floatType},
+	{name: "bigint", min: 1, max: 1, ret: bigIntType},
+	{name: "decimal", min: 1, max: 1, ret: decimalType},
+	{name: "decimalContext", min: 1, max: 2, ret: nilType},
+	{name: "chan", min: 0, max: 1, ret: chanType},
+	{name: "setTimeout", min: 1, max: -1, ret: intType},
+	{name: "setInterval", min: 1, max: -1, ret: intType},
+	{name: "clearTimeout", min: 1, max: 1, ret: nilType},
+	{name: "clearInterval", min: 1, max: 1, ret: nilType},
+	{name: "Promise", min: 1, max: 1, ret: promiseType},
+	{name: "sleep", min: 1, max: 1, ret: promiseType},
+	{name: "typeof", min: 1, max: 1, ret: stringType},
+	{name: "instanceof", min: 2, max: 2, ret: boolType},
+	{name: "className", min: 1, max: 1, ret: stringType},
+	{name: "fields", min: 1, max: 1, ret: &arrayType{elem: stringType}},
+	{name: "methods", min: 1, max: 1, ret: &arrayType{elem: stringType}},
+	{name: "hasField", min: 2, max: 2, ret: boolType},
+	{name: "getField", min: 2, max: 2, ret: anyType},
+	{name: "setField", min: 3, max: 3, ret: anyType},
+	{name: "callable", min: 1, max: 1, ret: boolType},
+	{name: "repr", min: 1, max: 2, ret: stringType},
+	{name: "Map", min: 0, max: 1, ret: mapType},
+	{name: "equals", min: 2, max: 2, ret: boolType},
+	{name: "hash", min: 1, max: 1, ret: intType},
+	{name: "sort", min: 1, max: 2, ret: &arrayType{elem: anyType}},
+	{name: "maxCallDepth", min: 1, max: 1, ret: intType},
+}
+
+var operatorMethods = map[token.Token]string{
+	token.Plus:         "__add__",
+	token.Minus:        "__sub__",
+	token.Star:         "__mul__",
+	token.Slash:        "__div__",
+	token.Less:         "__lt__",
+	token.LessEqual:    "__le__",
+	token.Greater:      "__gt__",
+	token.GreaterEqual: "__ge__",
+}
+
+// symbol is a variable in a scope, declared is its annotation, assignments to
+// a variable without annotation are not checked.
+type symbol struct {
+	typ      Type
+	declared Type
+}
+
+type scope struct {
+	parent *scope
+	names  map[string]*symbol
+	types  map[string]Type // classes, traits and enums usable in annotations.
+}
+
+func (s *scope) lookup(name string) *symbol {
+	for ; s != nil; s = s.parent {
+		if sym, ok := s.names[name]; ok {
+			return sym
+		}
+	}
+	return nil
+}
+
+func (s *scope) lookupType(name string) (Type, bool) {
+	for ; s != nil; s = s.parent {
+		if typ, ok := s.types[name]; ok {
+			return typ, true
+		}
+	}
+	return nil, false
+}
+
+type checker struct {
+	errs  []error
+	scope *scope
+	this  Type      // type of this, nil outside classes and traits.
+	fun   *funcType // the function being checked, nil at top level.
+	// ret is the annotated return type of the function being checked, nil if
+	// its returns are not checked.
+	ret Type
+	// unknown holds the annotations already reported as unknown types, since
+	// an annotation is resolved both where it is declared and where it is
+	// checked.
+	unknown map[*ast.NamedType]bool
+}
+
+// Check checks the types of a program and returns all the mismatches found.
+func Check(statements []ast.Stmt) []error {
+	c := &checker{unknown: make(map[*ast.NamedType]bool)}
+	c.begin()
+	for _, builtin := range builtins {
+		c.define(builtin.name, builtin, nil)
+	}
+	c.hoist(statements)
+	for _, stmt := range statements {
+		c.stmt(stmt)
+	}
+	return c.errs
+}
+
+func (c *checker) errorf(format string, args ...interface{}) {
+	c.errs = append(c.errs, &typeError{s: fmt.Sprintf(format, args...)})
+}
+
+func (c *checker) begin() {
+	c.scope = &scope{parent: c.scope, names: make(map[string]*symbol), types: make(map[string]Type)}
+}
+
+func (c *checker) end() {
+	c.scope = c.scope.parent
+}
+
+func (c *checker) define(name string, typ, declared Type) {
+	c.scope.names[name] = &symbol{typ: typ, declared: declared}
+}
+
+// resolve returns the type of an annotation, any if there is no annotation.
+func (c *checker) resolve(typ ast.TypeExpr) Type {
+	switch t := typ.(type) {
+	case nil:
+		return anyType
+	case *ast.NamedType:
+		if named, ok := c.scope.lookupType(t.Name); ok {
+			return named
+		}
+		if b, ok := basics[t.Name]; ok {
+			return b
+		}
+		if !c.unknown[t] {
+			c.unknown[t] = true
+			c.errorf("Unknown type %s.", t.Name)
+		}
+		return anyType
+	case *ast.ArrayType:
+		return &arrayType{elem: c.resolve(t.Element)}
+	case *ast.UnionType:
+		types := make([]Type, len(t.Types))
+		for i, member := range t.Types {
+			types[i] = c.resolve(member)
+		}
+		return union(types...)
+	}
+	return anyType
+}
+
+// hoist declares the functions, classes, traits and enums of a block ahead of
+// its statements, so that they can be used before their declaration.
+func (c *checker) hoist(statements []ast.Stmt) {
+	classes := make(map[*ast.ClassStmt]*classInfo)
+	traits := make(map[*ast.TraitStmt]*traitInfo)
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *ast.ClassStmt:
+			class := &classInfo{name: s.Name, fields: make(map[string]Type), methods: make(map[string]*funcType),
+				getters: make(map[string]Type), setters: make(map[string]Type), statics: make(map[string]Type)}
+			classes[s] = class
+			c.scope.types[s.Name] = &instanceType{class: class}
+			c.define(s.Name, &classType{class: class}, nil)
+		case *ast.TraitStmt:
+			trait := &traitInfo{name: s.Name, methods: make(map[string]*funcType)}
+			traits[s] = trait
+			c.scope.types[s.Name] = &traitType{trait: trait}
+			c.define(s.Name, traitValue, nil)
+		case *ast.EnumStmt:
+			enum := &enumInfo{name: s.Name, variants: make(map[string]*ast.EnumVariant)}
+			for _, variant := range s.Variants {
+				enum.variants[variant.Name] = variant
+			}
+			c.scope.types[s.Name] = &enumType{enum: enum}
+			c.define(s.Name, &enumNamespace{enum: enum}, nil)
+		}
+	}
+
+	// signatures may refer to any of the types declared above.
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *ast.FunctionStmt:
+			c.define(s.Name, c.signature(s), nil)
+		case *ast.TraitStmt:
+			for _, method := range append(append([]*ast.FunctionStmt{}, s.Methods...), s.Required...) {
+				traits[s].methods[method.Name] = c.signature(method)
+			}
+		}
+	}
+	for _, stmt := range statements {
+		if s, ok := stmt.(*ast.ClassStmt); ok {
+			c.declareMembers(classes[s], s)
+		}
+	}
+}
+
+func (c *checker) declareMembers(class *classInfo, stmt *ast.ClassStmt) {
+	for _, field := range stmt.Fields {
+		class.fields[field.Name] = c.resolve(field.Type)
+	}
+	for _, method := range stmt.Methods {
+		class.methods[method.Name] = c.signature(method)
+	}
+	for _, getter := range stmt.Getters {
+		class.getters[getter.Name] = c.resolve(getter.ReturnType)
+	}
+	for _, setter := range stmt.Setters {
+		class.setters[setter.Name] = c.resolve(setter.Params[0].Type)
+	}
+	for _, method := range stmt.StaticMethods {
+		class.statics[method.Name] = c.signature(method)
+	}
+	for _, field := range stmt.StaticFields {
+		class.statics[field.Name] = c.resolve(field.Type)
+	}
+	for _, name := range stmt.Traits {
+		if t, ok := c.scope.lookupType(name.Name); ok {
+			if trait, ok := t.(*traitType); ok {
+				class.traits = append(class.traits, trait.trait)
+				for methodName, method := range trait.trait.methods {
+					if _, ok := class.methods[methodName]; !ok {
+						class.methods[methodName] = method
+					}
+				}
+			}
+		}
+	}
+}
+
+// signature returns the type of a function, a call of an async function
+// returns a promise and a call of a generator returns a generator.
+func (c *checker) signature(fn *ast.FunctionStmt) *funcType {
+	f := &funcType{name: fn.Name, params: make([]*param, len(fn.Params)), max: len(fn.Params), ret: c.resolve(fn.ReturnType)}
+	for i, p := range fn.Params {
+		f.params[i] = &param{name: p.Name, typ: c.resolve(p.Type), rest: p.Rest}
+		switch {
+		case p.Rest:
+			f.max = -1
+		case p.Default == nil:
+			f.min++
+		}
+	}
+	switch {
+	case fn.IsAsync:
+		f.ret = promiseType
+	case fn.IsGenerator:
+		f.ret = generatorType
+	}
+	return f
+}
+
+func (c *checker) stmts(statements []ast.Stmt) {
+	c.begin()
+	defer c.end()
+	c.hoist(statements)
+	for _, stmt := range statements {
+		c.stmt(stmt)
+	}
+}
+
+func (c *checker) stmt(stmt ast.Stmt) {
+	switch s := stmt.(type) {
+	case *ast.BlockStmt:
+		c.stmts(s.Statements)
+	case *ast.ExprStmt:
+		c.expr(s.Expression)
+	case *ast.PrintStmt:
+		c.expr(s.Expression)
+	case *ast.VarStmt:
+		c.declare(s.Name.Name, s.Type, s.Initializer, false)
+	case *ast.LetStmt:
+		c.declare(s.Name.Name, s.Type, s.Initializer, true)
+	case *ast.ConstStmt:
+		c.declare(s.Name.Name, s.Type, s.Initializer, true)
+	case *ast.DestructureStmt:
+		c.expr(s.Initializer)
+		c.bindPattern(s.Pattern, anyType)
+	case *ast.ForInStmt:
+		elem := Type(anyType)
+		switch t := c.expr(s.Iterable).(type) {
+		case *arrayType:
+			elem = t.elem
+		case basic:
+			if t == stringType {
+				elem = stringType
+			}
+		}
+		c.begin()
+		c.bindPattern(s.Target, elem)
+		c.stmt(s.Body)
+		c.end()
+	case *ast.IfStmt:
+		c.expr(s.Condition)
+		c.stmt(s.ThenBranch)
+		if s.ElseBranch != nil {
+			c.stmt(s.ElseBranch)
+		}
+	case *ast.WhileStmt:
+		c.expr(s.Condition)
+		c.stmt(s.Body)
+	case *ast.ReturnStmt:
+		c.returnStmt(s)
+	case *ast.DeferStmt:
+		c.expr(s.Expression)
+	case *ast.FunctionStmt:
+		c.function(s, c.this)
+	case *ast.ClassStmt:
+		c.classStmt(s)
+	case *ast.TraitStmt:
+		t, _ := c.scope.lookupType(s.Name)
+		for _, method := range s.Methods {
+			c.function(method, t)
+		}
+	case *ast.EnumStmt:
+		for _, variant := range s.Variants {
+			if variant.Value != nil {
+				c.expr(variant.Value)
+			}
+		}
+	case *ast.ImportStmt:
+		c.define(s.Name, anyType, nil)
+	case *ast.SelectStmt:
+		for _, sc := range s.Cases {
+			c.expr(sc.Comm)
+			c.begin()
+			if sc.Name != "" {
+				c.define(sc.Name, anyType, nil)
+			}
+			c.stmt(sc.Body)
+			c.end()
+		}
+		if s.Default != nil {
+			c.stmt(s.Default)
+		}
+	case *ast.MatchStmt:
+		c.matchArms(c.expr(s.Value), s.Arms)
+	}
+}
+
+// declare checks the initializer of a variable against its annotation. The
+// type of a let or a const without annotation is inferred from the
+// initializer, while a var may hold anything.
+func (c *checker) declare(name string, annotation ast.TypeExpr, initializer ast.Expr, infer bool) {
+	var typ Type = anyType
+	if initializer != nil {
+		typ = c.expr(initializer)
+	}
+	if annotation != nil {
+		declared := c.resolve(annotation)
+		if initializer != nil && !assignable(typ, declared) {
+			c.errorf("Cannot assign %s to %s of type %s.", typ, name, declared)
+		}
+		c.define(name, declared, declared)
+		return
+	}
+	if !infer || typ == nilType {
+		typ = anyType
+	}
+	c.define(name, typ, nil)
+}
+
+func (c *checker) bindPattern(pattern ast.Pattern, typ Type) {
+	switch p := pattern.(type) {
+	case *ast.Ident:
+		c.define(p.Name, typ, nil)
+	case *ast.ArrayPattern:
+		elem := Type(anyType)
+		if array, ok := typ.(*arrayType); ok {
+			elem = array.elem
+		}
+		for _, e := range p.Elements {
+			c.bindPattern(e, elem)
+		}
+		if p.Rest != nil {
+			c.bindPattern(p.Rest, &arrayType{elem: elem})
+		}
+	case *ast.ObjectPattern:
+		for _, field := range p.Fields {
+			c.bindPattern(field.Value, anyType)
+		}
+	case ast.Expr:
+		c.expr(p)
+	}
+}
+
+func (c *checker) returnStmt(stmt *ast.ReturnStmt) {
+	var typ Type = nilType
+	if stmt.Value != nil {
+		typ = c.expr(stmt.Value)
+	}
+	if c.ret != nil && !assignable(typ, c.ret) {
+		c.errorf("%s returns %s, expected %s.", c.fun.name, typ, c.ret)
+	}
+}
+
+// function checks the body of a function, this is the type of this in it.
+func (c *checker) function(fn *ast.FunctionStmt, this Type) {
+	sig := c.signature(fn)
+	enclosing, enclosingRet, enclosingThis := c.fun, c.ret, c.this
+	c.fun, c.ret, c.this = sig, nil, this
+	if fn.ReturnType != nil && !fn.IsAsync && !fn.IsGenerator && !fn.IsInitializer {
+		c.ret = sig.ret
+	}
+	defer func() { c.fun, c.ret, c.this = enclosing, enclosingRet, enclosingThis }()
+
+	c.begin()
+	defer c.end()
+	for i, p := range fn.Params {
+		typ := sig.params[i].typ
+		if p.Default != nil {
+			if v := c.expr(p.Default); !assignable(v, typ) {
+				c.errorf("Cannot assign %s to %s of type %s.", v, p.Name, typ)
+			}
+		}
+		if p.Pattern != nil {
+			c.bindPattern(p.Pattern, typ)
+			continue
+		}
+		if p.Rest && p.Type == nil {
+			typ = &arrayType{elem: anyType}
+		}
+		c.define(p.Name, typ, typ)
+	}
+	c.hoist(fn.Body)
+	for _, stmt := range fn.Body {
+		c.stmt(stmt)
+	}
+	if c.ret != nil && !assignable(nilType, c.ret) && !terminates(fn.Body) {
+		c.errorf("%s may finish without returning a value of type %s.", fn.Name, c.ret)
+	}
+}
+
+// terminates reports whether a block always leaves the function by a return.
+// A while (true) loop never finishes, as there is no statement to break it.
+func terminates(statements []ast.Stmt) bool {
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *ast.ReturnStmt:
+			return true
+		case *ast.BlockStmt:
+			if terminates(s.Statements) {
+				return true
+			}
+		case *ast.IfStmt:
+			if s.ElseBranch != nil && terminates([]ast.Stmt{s.ThenBranch}) && terminates([]ast.Stmt{s.ElseBranch}) {
+				return true
+			}
+		case *ast.WhileStmt:
+			if lit, ok := s.Condition.(*ast.Literal); ok && lit.Token == token.True {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *checker) classStmt(stmt *ast.ClassStmt) {
+	instanceT, _ := c.scope.lookupType(stmt.Name)
+	instance := instanceT.(*instanceType)
+	class := instance.class
+	for _, field := range stmt.Fields {
+		c.fieldInitializer(class, field, instance)
+	}
+	for _, methods := range [][]*ast.FunctionStmt{stmt.Methods, stmt.Getters, stmt.Setters} {
+		for _, method := range methods {
+			c.function(method, instance)
+		}
+	}
+	classT := c.scope.lookup(stmt.Name).typ
+	for _, field := range stmt.StaticFields {
+		c.fieldInitializer(class, field, classT)
+	}
+	for _, method := range stmt.StaticMethods {
+		c.function(method, classT)
+	}
+}
+
+func (c *checker) fieldInitializer(class *classInfo, field *ast.FieldDecl, this Type) {
+	if field.Initializer == nil {
+		return
+	}
+	enclosing := c.this
+	c.this = this
+	v := c.expr(field.Initializer)
+	c.this = enclosing
+	if declared := c.resolve(field.Type); !assignable(v, declared) {
+		c.errorf("Property %s of %s expects %s, got %s.", field.Name, class.name, declared, v)
+	}
+}
+
+func (c *checker) matchArms(value Type, arms []*ast.MatchArm) Type {
+	types := make([]Type, 0, len(arms))
+	for _, arm := range arms {
+		c.begin()
+		c.bindMatchPattern(arm.Pattern, value)
+		if arm.Guard != nil {
+			c.expr(arm.Guard)
+		}
+		switch body := arm.Body.(type) {
+		case ast.Expr:
+			types = append(types, c.expr(body))
+		case ast.Stmt:
+			c.stmt(body)
+		}
+		c.end()
+	}
+	return union(types...)
+}
+
+func (c *checker) bindMatchPattern(pattern ast.MatchPattern, value Type) {
+	switch p := pattern.(type) {
+	case *ast.BindingPattern:
+		c.define(p.Name, value, nil)
+	case *ast.ValuePattern:
+		c.expr(p.Value)
+	case *ast.RangePattern:
+		c.expr(p.Low)
+		c.expr(p.High)
+	case *ast.OrPattern:
+		for _, alt := range p.Alternatives {
+			c.bindMatchPattern(alt, anyType)
+		}
+	case *ast.ListPattern:
+		for _, e := range p.Elements {
+			c.bindMatchPattern(e, anyType)
+		}
+		if p.Rest != nil {
+			c.bindMatchPattern(p.Rest, &arrayType{elem: anyType})
+		}
+	case *ast.FieldsPattern:
+		for _, f := range p.Fields {
+			c.bindMatchPattern(f.Pattern, anyType)
+		}
+	case *ast.EnumPattern:
+		for _, arg := range p.Args {
+			c.bindMatchPattern(arg, anyType)
+		}
+	}
+}
+
+func (c *checker) expr(expr ast.Expr) Type {
+	switch e := expr.(type) {
+	case *ast.Literal:
+		return literalType(e)
+	case *ast.GroupingExpr:
+		return c.expr(e.Expression)
+	case *ast.VariableExpr:
+		if sym := c.scope.lookup(e.Name); sym != nil {
+			return sym.typ
+		}
+		return anyType
+	case *ast.AssignExpr:
+		v := c.expr(e.Value)
+		c.assign(e.Left.Name, v)
+		return v
+	case *ast.BinaryExpr:
+		return c.binary(e.Operator, c.expr(e.Left), c.expr(e.Right))
+	case *ast.UnaryExpr:
+		return c.unary(e.Operator, c.expr(e.Right))
+	case *ast.LogicalExpr:
+		return union(c.expr(e.Left), c.expr(e.Right))
+	case *ast.CallExpr:
+		return c.call(e)
+	case *ast.GetExpr:
+		return c.property(c.expr(e.Object), e.Name)
+	case *ast.SetExpr:
+		object := c.expr(e.Object)
+		v := c.expr(e.Value)
+		c.setProperty(object, e.Name, v)
+		return v
+	case *ast.ThisExpr:
+		if c.this != nil {
+			return c.this
+		}
+		return anyType
+	case *ast.ArrayLiteralExpr:
+		types := make([]Type, 0, len(e.Elements))
+		for _, element := range e.Elements {
+			if spread, ok := element.(*ast.SpreadExpr); ok {
+				if array, ok := c.expr(spread.Expression).(*arrayType); ok {
+					types = append(types, array.elem)
+					continue
+				}
+				types = append(types, anyType)
+				continue
+			}
+			types = append(types, c.expr(element))
+		}
+		return &arrayType{elem: union(types...)}
+	case *ast.IndexExpr:
+		return c.index(c.expr(e.Object), c.expr(e.Index))
+	case *ast.IndexSetExpr:
+		object := c.expr(e.Object)
+		c.expr(e.Index)
+		v := c.expr(e.Value)
+		if array, ok := object.(*arrayType); ok && !assignable(v, array.elem) {
+			c.errorf("Cannot assign %s to an element of %s.", v, array)
+		}
+		return v
+	case *ast.SliceExpr:
+		object := c.expr(e.Object)
+		for _, bound := range []ast.Expr{e.Start, e.End, e.Step} {
+			if bound != nil {
+				c.expr(bound)
+			}
+		}
+		if _, ok := object.(*arrayType); ok || object == stringType {
+			return object
+		}
+		return anyType
+	case *ast.SpreadExpr:
+		c.expr(e.Expression)
+		return anyType
+	case *ast.NamedArgExpr:
+		return c.expr(e.Value)
+	case *ast.PatternAssignExpr:
+		v := c.expr(e.Value)
+		c.bindPattern(e.Pattern, anyType)
+		return v
+	case *ast.TemplateExpr:
+		for _, expr := range e.Exprs {
+			c.expr(expr)
+		}
+		return stringType
+	case *ast.YieldExpr:
+		if e.Value != nil {
+			c.expr(e.Value)
+		}
+		return anyType
+	case *ast.SpawnExpr:
+		c.call(e.Call)
+		return taskType
+	case *ast.AwaitExpr:
+		c.expr(e.Value)
+		return anyType
+	case *ast.MatchExpr:
+		return c.matchArms(c.expr(e.Value), e.Arms)
+	}
+	return anyType
+}
+
+func literalType(lit *ast.Literal) Type {
+	switch lit.Token {
+	case token.True, token.False:
+		return boolType
+	case token.String:
+		return stringType
+	case token.Nil:
+		return nilType
+	}
+	digits := strings.ToLower(lit.Value)
+	switch {
+	case strings.HasSuffix(digits, "n"):
+		return bigIntType
+	case strings.HasSuffix(digits, "d"):
+		return decimalType
+	case strings.HasPrefix(digits, "0x"):
+		return intType
+	case strings.ContainsAny(digits, ".e"):
+		return floatType
+	}
+	return intType
+}
+
+// assign checks a value assigned to a variable, a variable without annotation
+// that is assigned a value of another type may hold anything from then on.
+func (c *checker) assign(name string, v Type) {
+	sym := c.scope.lookup(name)
+	if sym == nil {
+		return
+	}
+	if sym.declared != nil {
+		if !assignable(v, sym.declared) {
+			c.errorf("Cannot assign %s to %s of type %s.", v, name, sym.declared)
+		}
+		return
+	}
+	if !assignable(v, sym.typ) {
+		sym.typ = anyType
+	}
+}
+
+func (c *checker) binary(op token.Token, left, right Type) Type {
+	switch op {
+	case token.EqualEqual, token.BangEqual, token.EqualEqualEqual, token.BangEqualEqual, token.Is:
+		return boolType
+	}
+	if ret, ok := c.overloaded(op, left, right); ok {
+		return ret
+	}
+	if !isNumeric(left) || !isNumeric(right) {
+		if op == token.Plus && (left == stringType || isNumeric(left)) && (right == stringType || isNumeric(right)) {
+			return stringType
+		}
+		if isKnown(left) && isKnown(right) {
+			c.errorf("Operator %s cannot be applied to %s and %s.", op, left, right)
+		}
+		if isComparison(op) {
+			return boolType
+		}
+		return anyType
+	}
+	if isComparison(op) {
+		return boolType
+	}
+	return c.arithmetic(op, left, right)
+}
+
+func isComparison(op token.Token) bool {
+	switch op {
+	case token.Greater, token.GreaterEqual, token.Less, token.LessEqual:
+		return true
+	}
+	return false
+}
+
+// isKnown reports whether an operator applied to a value of type t can be
+// checked, the operators of instances may be overloaded.
+func isKnown(t Type) bool {
+	if u, ok := t.(unionType); ok {
+		for _, m := range u {
+			if !isKnown(m) {
+				return false
+			}
+		}
+		return true
+	}
+	switch t {
+	case anyType, instanceValue:
+		return false
+	}
+	switch t.(type) {
+	case *instanceType, *traitType:
+		return false
+	}
+	return true
+}
+
+// overloaded returns the type returned by the special method implementing op
+// on the left operand, or the reflected comparison on the right operand.
+func (c *checker) overloaded(op token.Token, left, right Type) (Type, bool) {
+	name, ok := operatorMethods[op]
+	if !ok {
+		return nil, false
+	}
+	if method, ok := methodOf(left, name); ok {
+		return method.ret, true
+	}
+	reflected := map[token.Token]string{
+		token.Less: "__gt__", token.LessEqual: "__ge__", token.Greater: "__lt__", token.GreaterEqual: "__le__",
+	}[op]
+	if method, ok := methodOf(right, reflected); ok && reflected != "" {
+		return method.ret, true
+	}
+	return nil, false
+}
+
+func methodOf(t Type, name string) (*funcType, bool) {
+	if instance, ok := t.(*instanceType); ok {
+		method, ok := instance.class.methods[name]
+		return method, ok
+	}
+	return nil, false
+}
+
+// arithmetic returns the type of an arithmetic operation on numbers, int is
+// promoted to the other type while float cannot be mixed with the exact types.
+func (c *checker) arithmetic(op token.Token, left, right Type) Type {
+	if _, ok := left.(unionType); ok {
+		return numberType
+	}
+	if _, ok := right.(unionType); ok {
+		return numberType
+	}
+	a, b := left, right
+	switch {
+	case a == numberType || b == numberType:
+		return numberType
+	case a == intType && b == intType && op == token.Slash:
+		return union(intType, floatType)
+	case a == b || b == intType:
+		return a
+	case a == intType:
+		return b
+	case a == floatType || b == floatType:
+		c.errorf("Cannot mix %s and %s, convert one of them explicitly.", a, b)
+		return anyType
+	}
+	return decimalType
+}
+
+func (c *checker) unary(op token.Token, right Type) Type {
+	if op == token.Bang {
+		return boolType
+	}
+	if method, ok := methodOf(right, "__neg__"); ok {
+		return method.ret
+	}
+	switch {
+	case isNumeric(right):
+		if _, ok := right.(unionType); ok {
+			return numberType
+		}
+		return right
+	case isKnown(right):
+		c.errorf("Operator %s cannot be applied to %s.", op, right)
+	}
+	return anyType
+}
+
+func (c *checker) call(expr *ast.CallExpr) Type {
+	callee := c.expr(expr.Callee)
+	var (
+		args   []Type
+		named  = make(map[string]Type)
+		names  []string
+		spread bool
+	)
+	for _, arg := range expr.Arguments {
+		switch a := arg.(type) {
+		case *ast.SpreadExpr:
+			c.expr(a)
+			spread = true
+		case *ast.NamedArgExpr:
+			named[a.Name] = c.expr(a.Value)
+			names = append(names, a.Name)
+		default:
+			args = append(args, c.expr(a))
+		}
+	}
+	check := func(f *funcType) {
+		c.arguments(f, args, names, named, spread)
+	}
+
+	switch f := callee.(type) {
+	case *funcType:
+		check(f)
+		return f.ret
+	case *classType:
+		if init, ok := f.class.methods["init"]; ok {
+			check(&funcType{name: f.class.name, params: init.params, min: init.min, max: init.max})
+		} else {
+			check(&funcType{name: f.class.name, params: []*param{}})
+		}
+		return &instanceType{class: f.class}
+	case *instanceType:
+		if method, ok := f.class.methods["__call__"]; ok {
+			check(method)
+			return method.ret
+		}
+	case basic:
+		switch f {
+		case nilType, boolType, intType, floatType, bigIntType, decimalType, numberType, stringType:
+			c.errorf("Cannot call a value of type %s.", f)
+		}
+	case *arrayType:
+		c.errorf("Cannot call a value of type %s.", f)
+	}
+	return anyType
+}
+
+// arguments checks the number and the types of the arguments of a call, the
+// number is unknown if an argument is spread.
+func (c *checker) arguments(f *funcType, args []Type, names []string, named map[string]Type, spread bool) {
+	if n := len(args) + len(names); !spread && (n < f.min || f.max >= 0 && n > f.max) {
+		c.errorf("%s expects %s, got %d.", f.name, arity(f.min, f.max), n)
+	}
+	if f.params == nil {
+		return
+	}
+	for i, arg := range args {
+		var p *param
+		switch {
+		case i < len(f.params) && !f.params[i].rest:
+			p = f.params[i]
+		case len(f.params) > 0 && f.params[len(f.params)-1].rest:
+			p = f.params[len(f.params)-1]
+		default:
+			continue
+		}
+		typ := p.typ
+		if p.rest {
+			typ = anyType
+			if array, ok := p.typ.(*arrayType); ok {
+				typ = array.elem
+			}
+		}
+		if !assignable(arg, typ) {
+			name := p.name
+			if name == "" {
+				name = fmt.Sprint(i + 1)
+			}
+			c.errorf("Argument %s of %s expects %s, got %s.", name, f.name, typ, arg)
+		}
+	}
+	for _, name := range names {
+		p := findParam(f, name)
+		if p == nil {
+			c.errorf("%s got an unexpected keyword argument %q.", f.name, name)
+			continue
+		}
+		if !assignable(named[name], p.typ) {
+			c.errorf("Argument %s of %s expects %s, got %s.", name, f.name, p.typ, named[name])
+		}
+	}
+}
+
+func findParam(f *funcType, name string) *param {
+	for _, p := range f.params {
+		if p.name == name && !p.rest {
+			return p
+		}
+	}
+	return nil
+}
+
+func arity(min, max int) string {
+	switch {
+	case min == max && min == 1:
+		return "1 argument"
+	case min == max:
+		return fmt.Sprintf("%d arguments", min)
+	case max < 0:
+		return fmt.Sprintf("at least %d arguments", min)
+	}
+	return fmt.Sprintf("%d to %d arguments", min, max)
+}
+
+func (c *checker) property(object Type, name string) Type {
+	switch o := object.(type) {
+	case *instanceType:
+		class := o.class
+		if typ, ok := class.fields[name]; ok {
+			return typ
+		}
+		if typ, ok := class.getters[name]; ok {
+			return typ
+		}
+		if method, ok := class.methods[name]; ok {
+			return method
+		}
+	case *classType:
+		if typ, ok := o.class.statics[name]; ok {
+			return typ
+		}
+	case *traitType:
+		if method, ok := o.trait.methods[name]; ok {
+			return method
+		}
+	case *enumNamespace:
+		return c.variant(o.enum, name)
+	case *enumType:
+		if name == "name" {
+			return stringType
+		}
+	case *arrayType:
+		if name == "length" {
+			return intType
+		}
+		c.errorf("%s has no property %s.", o, name)
+	case basic:
+		switch o {
+		case nilType, boolType, intType, floatType, bigIntType, decimalType, numberType, stringType:
+			c.errorf("%s has no property %s.", o, name)
+		}
+	}
+	return anyType
+}
+
+// variant returns the type of a property of an enum, a variant with params is
+// a function making the values of the enum.
+func (c *checker) variant(enum *enumInfo, name string) Type {
+	typ := &enumType{enum: enum}
+	if variant, ok := enum.variants[name]; ok {
+		if variant.Params == nil {
+			return typ
+		}
+		n := len(variant.Params)
+		return &funcType{name: enum.name + "." + name, min: n, max: n, ret: typ}
+	}
+	if name == "values" {
+		return &funcType{name: "values", ret: &arrayType{elem: typ}}
+	}
+	c.errorf("Enum %s has no variant %s.", enum.name, name)
+	return anyType
+}
+
+func (c *checker) setProperty(object Type, name string, v Type) {
+	instance, ok := object.(*instanceType)
+	if !ok {
+		return
+	}
+	class := instance.class
+	declared, ok := class.setters[name]
+	if !ok {
+		if _, ok := class.getters[name]; ok {
+			c.errorf("Cannot set property %s which has only a getter.", name)
+			return
+		}
+		declared, ok = class.fields[name]
+	}
+	if ok && !assignable(v, declared) {
+		c.errorf("Property %s of %s expects %s, got %s.", name, class.name, declared, v)
+	}
+}
+
+func (c *checker) index(object, index Type) Type {
+	switch o := object.(type) {
+	case *arrayType:
+		if isKnown(index) && !assignable(index, intType) {
+			c.errorf("Index of %s must be an int, got %s.", o, index)
+		}
+		return o.elem
+	case *instanceType:
+		if method, ok := o.class.methods["__index__"]; ok {
+			return method.ret
+		}
+	case basic:
+		if o == stringType {
+			return stringType
+		}
+	}
+	return anyType
+}
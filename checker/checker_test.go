@@ -0,0 +1,132 @@
+package checker
+
+import (
+	"testing"
+
+	"tiny-script/lexer"
+	"tiny-script/parser"
+)
+
+func TestCheckValidProgram(t *testing.T) {
+	input := `class Point {
+		x: int = 0;
+		y: int = 0;
+		init(x: int, y: int) { this.x = x; this.y = y; }
+		__add__(o: Point): Point { return Point(this.x + o.x, this.y + o.y); }
+		get norm(): int { return this.x * this.x + this.y * this.y; }
+	}
+	trait Shape { area(): number; }
+	class Square with Shape { side: number = 1; area(): number { return this.side * this.side; } }
+	enum Color { Red, Green }
+	function scale(p: Point, k: int = 2): Point { return Point(p.x * k, p.y * k); }
+	function area(s: Shape): number { return s.area(); }
+	function first(xs: int[]): int | nil { return xs[0]; }
+	let p: Point = scale(Point(1, 2)) + Point(3, 4);
+	let n: int = p.norm;
+	let a: number = area(Square()) + 1;
+	let c: Color = Color.Red;
+	let s: string = "x" + 1;
+	let f: float = 1;
+	var v: int | string = 1;
+	v = "s";
+	let u = nil;
+	u = 1;
+	let xs: (int | string)[] = [1, "a"];
+	let m: int | nil = first([1, 2]);`
+	testCheck(t, input, nil)
+}
+
+func TestCheckMismatches(t *testing.T) {
+	input := `class Point {
+		x: int = "a";
+		init(x: int) { this.x = x; }
+		get y(): int { return 1; }
+	}
+	trait Shape { area(): number; }
+	function f(a: number, b: string = "x"): bool { return a; }
+	function g(s: Shape) {}
+	function first(xs: int[]): int | nil { return xs[0]; }
+	let x: number = "s";
+	let p = Point("1");
+	p.x = "s";
+	p.y = 1;
+	f("a");
+	f(1, 2, 3);
+	f(1, c: 3);
+	g(p);
+	let arr: int[] = [1, 2, "3"];
+	arr[0] = "s";
+	let m = 1 - "a";
+	var z: string | nil = nil;
+	z = 3;
+	let t: Foo = 1;
+	print arr.size;
+	print 1.5 + 2n;
+	let k: int = first([1]) + 1;
+	let cn: int = className(p);
+	let sorted: int = sort([2, 1]);`
+	testCheck(t, input, []string{
+		"Property x of Point expects int, got string.",
+		"f returns number, expected bool.",
+		"Cannot assign string to x of type number.",
+		"Argument x of Point expects int, got string.",
+		"Property x of Point expects int, got string.",
+		"Cannot set property y which has only a getter.",
+		"Argument a of f expects number, got string.",
+		"f expects 1 to 2 arguments, got 3.",
+		"Argument b of f expects string, got int.",
+		"f got an unexpected keyword argument \"c\".",
+		"Argument s of g expects Shape, got Point.",
+		"Cannot assign (int | string)[] to arr of type int[].",
+		"Cannot assign string to an element of int[].",
+		"Operator - cannot be applied to int and string.",
+		"Cannot assign int to z of type string | nil.",
+		"Unknown type Foo.",
+		"int[] has no property size.",
+		"Cannot mix float and bigint, convert one of them explicitly.",
+		"Operator + cannot be applied to int | nil and int.",
+		"Cannot assign string to cn of type int.",
+		"Cannot assign any[] to sorted of type int.",
+	})
+}
+
+func testCheck(t *testing.T, input string, expected []string) {
+	statements, err := parser.New(lexer.New(input)).Parse()
+	if err != nil {
+		t.Fatalf("parse failed. error: %s", err.Error())
+	}
+	errs := Check(statements)
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors. got %d: %v", len(expected), len(errs), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("test [%d]: expected error %q. got %q", i, expected[i], err.Error())
+		}
+	}
+}
+
+func TestCheckUnknownTypeReportedOnce(t *testing.T) {
+	input := `
+	function f(x: Foo): Bar { return x; }
+	class C { c: Baz = 1; get g(): Baz { return 1; } }`
+	testCheck(t, input, []string{
+		"Unknown type Bar.",
+		"Unknown type Foo.",
+		"Unknown type Baz.",
+		"Unknown type Baz.",
+	})
+}
+
+func TestCheckMissingReturn(t *testing.T) {
+	input := `
+	function f(x: int): int { if (x > 0) { return 1; } }
+	function g(x: int): int { if (x > 0) { return 1; } else { return 2; } }
+	function h(): int { while (true) {} }
+	function k(): int | nil { if (false) { return 1; } }
+	function m(): int { print 1; }`
+	testCheck(t, input, []string{
+		"f may finish without returning a value of type int.",
+		"m may finish without returning a value of type int.",
+	})
+}
@@ -0,0 +1,265 @@
+package checker
+
+import (
+	"strings"
+
+	"tiny-script/ast"
+)
+
+// Type represents the static type of a value.
+type Type interface {
+	String() string
+}
+
+// basic is a type without structure, its name is the one returned by typeof
+// except number, which accepts any of the numeric types.
+type basic string
+
+const (
+	anyType       basic = "any"
+	nilType       basic = "nil"
+	boolType      basic = "bool"
+	intType       basic = "int"
+	floatType     basic = "float"
+	bigIntType    basic = "bigint"
+	decimalType   basic = "decimal"
+	numberType    basic = "number"
+	stringType    basic = "string"
+	functionType  basic = "function"
+	mapType       basic = "map"
+	chanType      basic = "chan"
+	taskType      basic = "task"
+	promiseType   basic = "promise"
+	generatorType basic = "generator"
+	classValue    basic = "class"
+	traitValue    basic = "trait"
+	enumValue     basic = "enum"
+	variantValue  basic = "variant"
+	instanceValue basic = "instance"
+)
+
+var basics = map[string]Type{
+	"array": &arrayType{elem: anyType},
+}
+
+func init() {
+	for _, b := range []basic{anyType, nilType, boolType, intType, floatType, bigIntType, decimalType, numberType,
+		stringType, functionType, mapType, chanType, taskType, promiseType, generatorType,
+		classValue, traitValue, enumValue, variantValue, instanceValue} {
+		basics[string(b)] = b
+	}
+}
+
+func (b basic) String() string { return string(b) }
+
+type (
+	// arrayType is the type of arrays whose elements are of type elem.
+	arrayType struct {
+		elem Type
+	}
+	// unionType accepts a value of any of its types.
+	unionType []Type
+	// instanceType is the type of the instances of a class.
+	instanceType struct {
+		class *classInfo
+	}
+	// classType is the type of a class itself, calling it makes an instance.
+	classType struct {
+		class *classInfo
+	}
+	// traitType accepts the instances of the classes using the trait.
+	traitType struct {
+		trait *traitInfo
+	}
+	// enumType is the type of the variants of an enum.
+	enumType struct {
+		enum *enumInfo
+	}
+	// enumNamespace is the type of an enum itself, its properties are the variants.
+	enumNamespace struct {
+		enum *enumInfo
+	}
+	// funcType is the signature of a function, params is nil if the types of
+	// the arguments are unknown.
+	funcType struct {
+		name   string
+		params []*param
+		min    int
+		max    int // -1 if there is a rest parameter.
+		ret    Type
+	}
+	param struct {
+		name string
+		typ  Type
+		rest bool
+	}
+)
+
+func (a *arrayType) String() string {
+	if _, ok := a.elem.(unionType); ok {
+		return "(" + a.elem.String() + ")[]"
+	}
+	return a.elem.String() + "[]"
+}
+
+func (u unionType) String() string {
+	types := make([]string, len(u))
+	for i, typ := range u {
+		types[i] = typ.String()
+	}
+	return strings.Join(types, " | ")
+}
+
+func (i *instanceType) String() string { return i.class.name }
+func (c *classType) String() string    { return "class " + c.class.name }
+func (t *traitType) String() string    { return t.trait.name }
+func (e *enumType) String() string     { return e.enum.name }
+func (e *enumNamespace) String() string {
+	return "enum " + e.enum.name
+}
+func (f *funcType) String() string { return "function" }
+
+type (
+	classInfo struct {
+		name    string
+		fields  map[string]Type // declared fields, any if not annotated.
+		methods map[string]*funcType
+		getters map[string]Type
+		setters map[string]Type
+		statics map[string]Type
+		traits  []*traitInfo
+	}
+	traitInfo struct {
+		name    string
+		methods map[string]*funcType // default and required methods.
+	}
+	enumInfo struct {
+		name     string
+		variants map[string]*ast.EnumVariant
+	}
+)
+
+func (c *classInfo) uses(trait *traitInfo) bool {
+	for _, t := range c.traits {
+		if t == trait {
+			return true
+		}
+	}
+	return false
+}
+
+// union returns the type accepting a value of any of types, nested unions are
+// flattened and any absorbs the other types.
+func union(types ...Type) Type {
+	var u unionType
+	seen := make(map[string]bool)
+	var add func(Type)
+	add = func(t Type) {
+		if members, ok := t.(unionType); ok {
+			for _, m := range members {
+				add(m)
+			}
+			return
+		}
+		if !seen[t.String()] {
+			seen[t.String()] = true
+			u = append(u, t)
+		}
+	}
+	for _, t := range types {
+		add(t)
+	}
+	if seen[string(anyType)] || len(u) == 0 {
+		return anyType
+	}
+	if len(u) == 1 {
+		return u[0]
+	}
+	return u
+}
+
+func isNumeric(t Type) bool {
+	switch t {
+	case intType, floatType, bigIntType, decimalType, numberType:
+		return true
+	}
+	if u, ok := t.(unionType); ok {
+		for _, m := range u {
+			if !isNumeric(m) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// assignable reports whether a value of type from can be used where a value
+// of type to is expected.
+func assignable(from, to Type) bool {
+	if from == anyType || to == anyType {
+		return true
+	}
+	if u, ok := from.(unionType); ok {
+		for _, t := range u {
+			if !assignable(t, to) {
+				return false
+			}
+		}
+		return true
+	}
+	switch t := to.(type) {
+	case unionType:
+		for _, m := range t {
+			if assignable(from, m) {
+				return true
+			}
+		}
+		return false
+	case basic:
+		switch t {
+		case numberType:
+			return isNumeric(from)
+		case floatType:
+			return from == intType || from == floatType
+		case functionType:
+			switch from.(type) {
+			case *funcType, *classType:
+				return true
+			}
+		case classValue:
+			_, ok := from.(*classType)
+			return ok || from == classValue
+		case enumValue:
+			_, ok := from.(*enumNamespace)
+			return ok || from == enumValue
+		case variantValue:
+			_, ok := from.(*enumType)
+			return ok || from == variantValue
+		case instanceValue:
+			switch from.(type) {
+			case *instanceType, *traitType:
+				return true
+			}
+		}
+		return from == to
+	case *arrayType:
+		f, ok := from.(*arrayType)
+		return ok && assignable(f.elem, t.elem)
+	case *instanceType:
+		f, ok := from.(*instanceType)
+		return ok && f.class == t.class
+	case *traitType:
+		switch f := from.(type) {
+		case *instanceType:
+			return f.class.uses(t.trait)
+		case *traitType:
+			return f.trait == t.trait
+		}
+		return false
+	case *enumType:
+		f, ok := from.(*enumType)
+		return ok && f.enum == t.enum
+	}
+	return from == to
+}
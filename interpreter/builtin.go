@@ -0,0 +1,198 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"tiny-script/errors"
+	"tiny-script/token"
+	"tiny-script/valuer"
+)
+
+// builtins are the functions defined in globals for every script.
+var builtins = []*valuer.Builtin{
+	{Name: "int", Min: 1, Max: 1, Fn: builtinInt},
+	{Name: "float", Min: 1, Max: 1, Fn: builtinFloat},
+	{Name: "bigint", Min: 1, Max: 1, Fn: builtinBigInt},
+	{Name: "decimal", Min: 1, Max: 1, Fn: builtinDecimal},
+	{Name: "decimalContext", Min: 1, Max: 2, Fn: builtinDecimalContext},
+	{Name: "chan", Min: 0, Max: 1, Fn: builtinChan},
+	{Name: "setTimeout", Min: 1, Max: -1, Fn: builtinSetTimeout},
+	{Name: "setInterval", Min: 1, Max: -1, Fn: builtinSetInterval},
+	{Name: "clearTimeout", Min: 1, Max: 1, Fn: builtinClearTimeout},
+	{Name: "clearInterval", Min: 1, Max: 1, Fn: builtinClearTimeout},
+	{Name: "sleep", Min: 1, Max: 1, Fn: builtinSleep},
+	{Name: "typeof", Min: 1, Max: 1, Fn: builtinTypeof},
+	{Name: "instanceof", Min: 2, Max: 2, Fn: builtinInstanceof},
+	{Name: "className", Min: 1, Max: 1, Fn: builtinClassName},
+	{Name: "fields", Min: 1, Max: 1, Fn: builtinFields},
+	{Name: "methods", Min: 1, Max: 1, Fn: builtinMethods},
+	{Name: "hasField", Min: 2, Max: 2, Fn: builtinHasField},
+	{Name: "callable", Min: 1, Max: 1, Fn: builtinCallable},
+	{Name: "maxCallDepth", Min: 1, Max: 1, Fn: builtinMaxCallDepth},
+}
+
+// threadBuiltins are the built-in functions which call back functions of the
+// script, they are called with the calling thread so that their callbacks run
+// on it and count toward the depth of its call stack. The table is made by init
+// since the built-ins refer back to it through callBuiltin.
+var threadBuiltins map[*valuer.Builtin]func(t *thread, args []valuer.Valuer) valuer.Valuer
+
+func init() {
+	threadBuiltins = map[*valuer.Builtin]func(t *thread, args []valuer.Valuer) valuer.Valuer{
+		{Name: "Promise", Min: 1, Max: 1}:  (*thread).builtinPromise,
+		{Name: "getField", Min: 2, Max: 2}: (*thread).builtinGetField,
+		{Name: "setField", Min: 3, Max: 3}: (*thread).builtinSetField,
+		{Name: "Map", Min: 0, Max: 1}:      (*thread).builtinMap,
+		{Name: "equals", Min: 2, Max: 2}:   (*thread).builtinEquals,
+		{Name: "hash", Min: 1, Max: 1}:     (*thread).builtinHash,
+		{Name: "sort", Min: 1, Max: 2}:     (*thread).builtinSort,
+		{Name: "repr", Min: 1, Max: 2}:     (*thread).builtinRepr,
+	}
+}
+
+func defineBuiltins(environment *valuer.Environment) {
+	setDecimalContext(20, valuer.RoundHalfEven)
+	atomic.StoreInt64(&maxCallDepth, defaultMaxCallDepth)
+	for _, builtin := range builtins {
+		environment.Define(builtin.Name, builtin)
+	}
+	for builtin := range threadBuiltins {
+		environment.Define(builtin.Name, builtin)
+	}
+}
+
+func (t *thread) callBuiltin(builtin *valuer.Builtin, args []valuer.Valuer, named map[string]valuer.Valuer) valuer.Valuer {
+	for name := range named {
+		errors.Error(token.LeftParen, fmt.Sprintf("%s got an unexpected keyword argument %q.", builtin, name))
+	}
+	if len(args) < builtin.Min || len(args) > builtin.Max && builtin.Max >= 0 {
+		errors.Error(token.LeftParen, arityMessage(builtin.Min, builtin.Max, len(args)))
+	}
+	if fn, ok := threadBuiltins[builtin]; ok {
+		return fn(t, args)
+	}
+	return builtin.Fn(args)
+}
+
+// builtinInt converts a number, a string or a bool to int, a float is truncated toward zero.
+func builtinInt(args []valuer.Valuer) valuer.Valuer {
+	switch v := args[0].(type) {
+	case *valuer.Int:
+		return v
+	case *valuer.Number:
+		// float64(math.MaxInt64) rounds up to 2^63, which is out of range.
+		if t := math.Trunc(v.Value); t >= math.MinInt64 && t < math.MaxInt64 {
+			return &valuer.Int{Value: int64(t)}
+		}
+	case *valuer.BigInt, *valuer.Decimal:
+		if n := truncate(v); n.IsInt64() {
+			return &valuer.Int{Value: n.Int64()}
+		}
+	case *valuer.String:
+		if n, err := strconv.ParseInt(strings.TrimSpace(v.Value), 10, 64); err == nil {
+			return &valuer.Int{Value: n}
+		}
+	case *valuer.Boolean:
+		if v.Value {
+			return &valuer.Int{Value: 1}
+		}
+		return &valuer.Int{Value: 0}
+	}
+	errors.Error(token.LeftParen, fmt.Sprintf("Cannot convert %s %s to int.", args[0].Type(), args[0]))
+	return nil
+}
+
+// builtinFloat converts a number, a string or a bool to float.
+func builtinFloat(args []valuer.Valuer) valuer.Valuer {
+	switch v := args[0].(type) {
+	case *valuer.Int, *valuer.Number, *valuer.BigInt, *valuer.Decimal:
+		f, _ := toFloat(v)
+		return &valuer.Number{Value: f}
+	case *valuer.String:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v.Value), 64); err == nil {
+			return &valuer.Number{Value: f}
+		}
+	case *valuer.Boolean:
+		if v.Value {
+			return &valuer.Number{Value: 1}
+		}
+		return &valuer.Number{Value: 0}
+	}
+	errors.Error(token.LeftParen, fmt.Sprintf("Cannot convert %s %s to float.", args[0].Type(), args[0]))
+	return nil
+}
+
+// builtinBigInt converts a number or a string to bigint, a fraction is truncated toward zero.
+func builtinBigInt(args []valuer.Valuer) valuer.Valuer {
+	switch v := args[0].(type) {
+	case *valuer.Int, *valuer.BigInt, *valuer.Decimal:
+		return &valuer.BigInt{Value: truncate(v)}
+	case *valuer.Number:
+		if !math.IsInf(v.Value, 0) && !math.IsNaN(v.Value) {
+			n, _ := big.NewFloat(math.Trunc(v.Value)).Int(nil)
+			return &valuer.BigInt{Value: n}
+		}
+	case *valuer.String:
+		if n, ok := new(big.Int).SetString(strings.TrimSpace(v.Value), 10); ok {
+			return &valuer.BigInt{Value: n}
+		}
+	}
+	errors.Error(token.LeftParen, fmt.Sprintf("Cannot convert %s %s to bigint.", args[0].Type(), args[0]))
+	return nil
+}
+
+// builtinDecimal converts a number or a string to decimal, a float is converted
+// from its shortest representation, so decimal(0.1) is 0.1.
+func builtinDecimal(args []valuer.Valuer) valuer.Valuer {
+	switch v := args[0].(type) {
+	case *valuer.Int, *valuer.BigInt, *valuer.Decimal:
+		return toDecimal(v)
+	case *valuer.Number:
+		if !math.IsInf(v.Value, 0) && !math.IsNaN(v.Value) {
+			d, _ := valuer.ParseDecimal(strconv.FormatFloat(v.Value, 'f', -1, 64))
+			return d
+		}
+	case *valuer.String:
+		if d, err := valuer.ParseDecimal(v.Value); err == nil {
+			return d
+		}
+	}
+	errors.Error(token.LeftParen, fmt.Sprintf("Cannot convert %s %s to decimal.", args[0].Type(), args[0]))
+	return nil
+}
+
+// builtinDecimalContext sets the number of fractional digits and the rounding
+// mode of decimal results, such as decimalContext(2, "half_up").
+func builtinDecimalContext(args []valuer.Valuer) valuer.Valuer {
+	precision, ok := args[0].(*valuer.Int)
+	if !ok || precision.Value < 0 || precision.Value > 1000 {
+		errors.Error(token.LeftParen, fmt.Sprintf("Decimal precision must be an int between 0 and 1000, got %s.", args[0]))
+	}
+	_, rounding := decimalContext()
+	if len(args) > 1 {
+		rounding = ""
+		for _, r := range valuer.Roundings {
+			if s, ok := args[1].(*valuer.String); ok && valuer.Rounding(s.Value) == r {
+				rounding = r
+			}
+		}
+		if rounding == "" {
+			errors.Error(token.LeftParen, fmt.Sprintf("Unknown rounding mode %s, expect one of %v.", args[1], valuer.Roundings))
+		}
+	}
+	setDecimalContext(int(precision.Value), rounding)
+	return Nil
+}
+
+// truncate returns the integer part of an int, a bigint or a decimal.
+func truncate(v valuer.Valuer) *big.Int {
+	if d, ok := v.(*valuer.Decimal); ok {
+		return valuer.RoundRat(d.Rat(), 0, valuer.RoundDown).Unscaled
+	}
+	return toBigInt(v)
+}
@@ -0,0 +1,125 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"tiny-script/ast"
+	"tiny-script/errors"
+	"tiny-script/token"
+	"tiny-script/valuer"
+)
+
+const defaultMaxCallDepth = 10000
+
+// maxCallDepth is the number of nested calls a thread may make before a stack
+// overflow is raised, shared by threads.
+var maxCallDepth int64 = defaultMaxCallDepth
+
+// stackTraceFrames is the number of innermost frames listed by a stack overflow.
+const stackTraceFrames = 10
+
+// tailCall is returned in place of the value of return f(...) in a function
+// when f is a function of the script, callFunction makes the call once the
+// frame of the caller is gone so that tail recursion runs in constant space.
+type tailCall struct {
+	callee *valuer.Function
+	args   []valuer.Valuer
+	named  map[string]valuer.Valuer
+}
+
+func (*tailCall) Type() valuer.Type { return valuer.ReturnType }
+
+func (c *tailCall) String() string { return "tail call" }
+
+// frame is an activation of a function on the call stack of a thread.
+type frame struct {
+	function *valuer.Function
+	deferred []deferred // run in reverse order when the frame is left
+}
+
+// deferred is a call of a defer statement, whose callee and arguments are
+// evaluated by the statement, or another expression evaluated at exit in the
+// environment of the statement.
+type deferred struct {
+	callee valuer.Valuer // nil if expr is not a call.
+	args   []valuer.Valuer
+	named  map[string]valuer.Valuer
+	expr   ast.Expr
+	env    *valuer.Environment
+}
+
+// pushFrame records a call of function on the call stack of t, a stack
+// overflow is raised if the stack is already at the maximum depth.
+func (t *thread) pushFrame(function *valuer.Function) {
+	if depth := int64(len(t.frames)); depth >= atomic.LoadInt64(&maxCallDepth) {
+		errors.Error(token.LeftParen, t.stackOverflow(function))
+	}
+	t.frames = append(t.frames, &frame{function: function})
+}
+
+// popFrame leaves the innermost frame of t after running its deferred
+// expressions, it is deferred by the caller so that they also run on errors.
+func (t *thread) popFrame() {
+	defer func() { t.frames = t.frames[:len(t.frames)-1] }()
+	t.runDeferred(t.frames[len(t.frames)-1])
+}
+
+// runDeferred evaluates the deferred expressions of f, the last deferred first,
+// the remaining ones still run if one of them raises an error.
+func (t *thread) runDeferred(f *frame) {
+	if len(f.deferred) == 0 {
+		return
+	}
+	d := f.deferred[len(f.deferred)-1]
+	f.deferred = f.deferred[:len(f.deferred)-1]
+	defer t.runDeferred(f)
+	if d.callee != nil {
+		t.call(d.callee, d.args, d.named)
+		return
+	}
+	t.evalWith(d.expr, d.env)
+}
+
+func (t *thread) evalDeferStmt(stmt *ast.DeferStmt) {
+	d := deferred{expr: stmt.Expression, env: t.env}
+	if call, ok := stmt.Expression.(*ast.CallExpr); ok {
+		d.callee = t.Eval(call.Callee)
+		d.args, d.named = t.evalArguments(call.Arguments)
+	}
+	f := t.frames[len(t.frames)-1]
+	f.deferred = append(f.deferred, d)
+}
+
+// canTailCall reports whether a return in the innermost frame of t can leave
+// the frame before making its call, which must happen before deferred
+// expressions run.
+func (t *thread) canTailCall() bool {
+	return len(t.frames) > 0 && len(t.frames[len(t.frames)-1].deferred) == 0
+}
+
+// stackOverflow returns the message of a stack overflow raised by calling
+// function, listing the innermost frames of the call stack first.
+func (t *thread) stackOverflow(function *valuer.Function) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "stack overflow: maximum call depth of %d exceeded.", len(t.frames))
+	fmt.Fprintf(&b, "\n    at %s", function.Name)
+	for i := len(t.frames) - 1; i >= 0 && i >= len(t.frames)-stackTraceFrames+1; i-- {
+		fmt.Fprintf(&b, "\n    at %s", t.frames[i].function.Name)
+	}
+	if hidden := len(t.frames) - stackTraceFrames + 1; hidden > 0 {
+		fmt.Fprintf(&b, "\n    ... %d more", hidden)
+	}
+	return b.String()
+}
+
+// builtinMaxCallDepth sets the maximum call depth of threads and returns the
+// previous one, such as maxCallDepth(500).
+func builtinMaxCallDepth(args []valuer.Valuer) valuer.Valuer {
+	depth, ok := args[0].(*valuer.Int)
+	if !ok || depth.Value < 1 {
+		errors.Error(token.LeftParen, fmt.Sprintf("Maximum call depth must be a positive int, got %s.", args[0]))
+	}
+	return &valuer.Int{Value: atomic.SwapInt64(&maxCallDepth, depth.Value)}
+}
@@ -0,0 +1,289 @@
+package interpreter
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tiny-script/ast"
+	"tiny-script/errors"
+	"tiny-script/token"
+	"tiny-script/valuer"
+)
+
+// A spawned task runs a call on its own thread in a goroutine, the result or
+// the error raised is handed to whoever waits for it.
+type taskState struct {
+	done   chan struct{} // closed when the call finishes
+	result valuer.Valuer
+	err    interface{} // panic raised by the call
+	waited int32       // set atomically once wait() has observed the task
+}
+
+var (
+	// tasks holds the tasks spawned since the last waitTasks.
+	tasksMu sync.Mutex
+	tasks   []*taskState
+)
+
+// A deadlock is detected by counting the threads that can make progress: the
+// main thread and the running tasks. A thread blocked on a channel or on a
+// task doesn't count, once none is left every blocked thread fails.
+var (
+	activeMu sync.Mutex
+	active   int           // threads not blocked
+	epoch    int           // changed whenever active is
+	deadlock chan struct{} // closed once all the threads are blocked
+)
+
+// deadlockDelay is how long the threads must all stay blocked before a
+// deadlock is raised, a thread just woken up has yet to be counted again.
+const deadlockDelay = 50 * time.Millisecond
+
+// stopThreads waits for the tasks left behind by a program that failed before
+// waiting for them. The main thread stops counting, so that the blocked tasks
+// fail with a deadlock instead of blocking forever.
+func stopThreads() {
+	leave()
+	for {
+		tasksMu.Lock()
+		pending := tasks
+		tasks = nil
+		tasksMu.Unlock()
+		if len(pending) == 0 {
+			return
+		}
+		for _, s := range pending {
+			<-s.done
+		}
+	}
+}
+
+func resetThreads() {
+	activeMu.Lock()
+	active = 1
+	epoch = 0
+	deadlock = make(chan struct{})
+	activeMu.Unlock()
+}
+
+// enter counts a thread that can make progress again.
+func enter() {
+	activeMu.Lock()
+	active++
+	epoch++
+	activeMu.Unlock()
+}
+
+// leave stops counting a thread that blocks or finishes, and returns the
+// channel closed on a deadlock.
+func leave() <-chan struct{} {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	active--
+	epoch++
+	if active == 0 {
+		e, d := epoch, deadlock
+		time.AfterFunc(deadlockDelay, func() {
+			activeMu.Lock()
+			defer activeMu.Unlock()
+			if epoch == e && d == deadlock {
+				close(d)
+			}
+		})
+	}
+	return deadlock
+}
+
+// block waits for one of cases like reflect.Select, a case that can proceed
+// right away is chosen without blocking. A deadlock is raised if every thread
+// is blocked, since no one can ever make a case proceed.
+func block(cases []reflect.SelectCase) (int, reflect.Value, bool) {
+	chosen, recv, recvOK := reflect.Select(append(cases, reflect.SelectCase{Dir: reflect.SelectDefault}))
+	if chosen < len(cases) {
+		return chosen, recv, recvOK
+	}
+	stop := leave()
+	defer enter()
+	chosen, recv, recvOK = reflect.Select(append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(stop)}))
+	if chosen == len(cases) {
+		errors.Error(token.Identifier, "Deadlock, all threads are blocked.")
+	}
+	return chosen, recv, recvOK
+}
+
+// waitDone blocks until done is closed.
+func waitDone(done chan struct{}) {
+	block([]reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)}})
+}
+
+func (t *thread) evalSpawnExpr(expr *ast.SpawnExpr) valuer.Valuer {
+	callee := t.Eval(expr.Call.Callee)
+	args, named := t.evalArguments(expr.Call.Arguments)
+	state := &taskState{done: make(chan struct{})}
+	tasksMu.Lock()
+	tasks = append(tasks, state)
+	tasksMu.Unlock()
+	task := &thread{env: globals}
+	enter()
+	go state.run(func() valuer.Valuer { return task.call(callee, args, named) })
+	return &valuer.Task{Name: expr.Call.Callee.String(), Wait: state.wait}
+}
+
+func (s *taskState) run(call func() valuer.Valuer) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.err = r
+		}
+		close(s.done)
+		leave()
+	}()
+	s.result = call()
+}
+
+// wait blocks until the task finishes, the error of the task is raised again
+// on the waiting thread.
+func (s *taskState) wait() valuer.Valuer {
+	waitDone(s.done)
+	atomic.StoreInt32(&s.waited, 1)
+	if s.err != nil {
+		panic(s.err)
+	}
+	return s.result
+}
+
+// waitTasks waits for all the spawned tasks, including the ones spawned while
+// waiting, and reports the errors that no one has waited for.
+func waitTasks() {
+	for {
+		tasksMu.Lock()
+		pending := tasks
+		tasks = nil
+		tasksMu.Unlock()
+		if len(pending) == 0 {
+			return
+		}
+		for _, s := range pending {
+			waitDone(s.done)
+			if s.err == nil || atomic.LoadInt32(&s.waited) == 1 {
+				continue
+			}
+			if err, ok := s.err.(errors.RuntimeError); ok {
+				fmt.Fprintln(os.Stderr, err.Error())
+			} else {
+				panic(s.err)
+			}
+		}
+	}
+}
+
+func taskProperty(task *valuer.Task, name string) valuer.Valuer {
+	if name == "wait" {
+		return &valuer.Builtin{Name: "wait", Min: 0, Max: 0, Fn: func([]valuer.Valuer) valuer.Valuer {
+			return task.Wait()
+		}}
+	}
+	errors.Error(token.Identifier, "Undefined propterty "+name+".")
+	return nil
+}
+
+// builtinChan makes a channel, unbuffered unless a capacity is given.
+func builtinChan(args []valuer.Valuer) valuer.Valuer {
+	capacity := 0
+	if len(args) > 0 {
+		capacity = toInteger(args[0], "Channel capacity must be an integer.")
+		if capacity < 0 {
+			errors.Error(token.LeftParen, "Channel capacity must not be negative.")
+		}
+	}
+	return &valuer.Channel{C: make(chan valuer.Valuer, capacity)}
+}
+
+// channelProperty returns the methods of a channel: send(v) blocks until v is
+// taken, recv() returns nil once the channel is closed and drained.
+func channelProperty(ch *valuer.Channel, name string) valuer.Valuer {
+	switch name {
+	case "send":
+		return &valuer.Builtin{Name: "send", Min: 1, Max: 1, Fn: func(args []valuer.Valuer) valuer.Valuer {
+			send := reflect.SelectCase{Dir: reflect.SelectSend, Chan: reflect.ValueOf(ch.C), Send: reflect.ValueOf(args[0])}
+			onClosed("Send on closed channel.", func() { block([]reflect.SelectCase{send}) })
+			return Nil
+		}}
+	case "recv":
+		return &valuer.Builtin{Name: "recv", Min: 0, Max: 0, Fn: func([]valuer.Valuer) valuer.Valuer {
+			if _, v, ok := block([]reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch.C)}}); ok {
+				return v.Interface().(valuer.Valuer)
+			}
+			return Nil
+		}}
+	case "close":
+		return &valuer.Builtin{Name: "close", Min: 0, Max: 0, Fn: func([]valuer.Valuer) valuer.Valuer {
+			onClosed("Close of closed channel.", func() { close(ch.C) })
+			return Nil
+		}}
+	}
+	errors.Error(token.Identifier, "Undefined propterty "+name+".")
+	return nil
+}
+
+// onClosed runs op, the runtime panic of a closed channel is raised as msg.
+func onClosed(msg string, op func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(runtime.Error); ok {
+				errors.Error(token.Identifier, msg)
+			}
+			panic(r)
+		}
+	}()
+	op()
+}
+
+// evalSelectStmt blocks until one of the channel operations can proceed and
+// runs its body, the default body runs instead if none is ready.
+func (t *thread) evalSelectStmt(stmt *ast.SelectStmt) valuer.Valuer {
+	cases := make([]reflect.SelectCase, 0, len(stmt.Cases)+1)
+	for _, c := range stmt.Cases {
+		get := c.Comm.Callee.(*ast.GetExpr)
+		ch, ok := t.Eval(get.Object).(*valuer.Channel)
+		if !ok {
+			errors.Error(token.Case, "Only channels can be selected.")
+		}
+		if get.Name == "recv" {
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch.C)})
+		} else {
+			v := t.Eval(c.Comm.Arguments[0])
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectSend, Chan: reflect.ValueOf(ch.C), Send: reflect.ValueOf(v)})
+		}
+	}
+	var (
+		chosen int
+		recv   reflect.Value
+		recvOK bool
+	)
+	onClosed("Send on closed channel.", func() {
+		if stmt.Default != nil {
+			chosen, recv, recvOK = reflect.Select(append(cases, reflect.SelectCase{Dir: reflect.SelectDefault}))
+		} else {
+			chosen, recv, recvOK = block(cases)
+		}
+	})
+	if chosen == len(stmt.Cases) {
+		return t.Eval(stmt.Default)
+	}
+	c := stmt.Cases[chosen]
+	if c.Name == "" {
+		return t.Eval(c.Body)
+	}
+	var v valuer.Valuer = Nil
+	if recvOK {
+		v = recv.Interface().(valuer.Valuer)
+	}
+	environment := valuer.NewEnclosing(t.env)
+	environment.Define(c.Name, v)
+	return t.evalWith(c.Body, environment)
+}
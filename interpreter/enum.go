@@ -0,0 +1,131 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"tiny-script/ast"
+	"tiny-script/errors"
+	"tiny-script/token"
+	"tiny-script/valuer"
+)
+
+// evalEnumStmt defines the enum namespace. A variant without an explicit value
+// takes the value of the previous int value plus one, starting from 0.
+func (t *thread) evalEnumStmt(stmt *ast.EnumStmt) {
+	enum := &valuer.Enum{Name: stmt.Name}
+	var next int64
+	auto := true
+	for _, decl := range stmt.Variants {
+		variant := &valuer.EnumVariant{Enum: enum, Name: decl.Name, Params: decl.Params}
+		if decl.Params != nil {
+			n := len(decl.Params)
+			variant.Constructor = &valuer.Builtin{Name: enum.Name + "." + decl.Name, Min: n, Max: n, Fn: func(args []valuer.Valuer) valuer.Valuer {
+				return &valuer.EnumValue{Variant: variant, Fields: append([]valuer.Valuer(nil), args...)}
+			}}
+			enum.Variants = append(enum.Variants, variant)
+			continue
+		}
+		switch {
+		case decl.Value != nil:
+			variant.Value = t.Eval(decl.Value)
+			i, ok := variant.Value.(*valuer.Int)
+			auto = ok
+			if ok {
+				next = i.Value + 1
+			}
+		case auto:
+			variant.Value = &valuer.Int{Value: next}
+			next++
+		default:
+			errors.Error(token.Enum, fmt.Sprintf("Enum variant %s.%s needs an explicit value.", enum.Name, decl.Name))
+		}
+		for _, other := range enum.Variants {
+			if other.Value != nil && t.sameValue(other.Value, variant.Value) {
+				errors.Error(token.Enum, fmt.Sprintf("Enum variants %s and %s have the same value %s.", other.Name, decl.Name, variant.Value))
+			}
+		}
+		variant.Unit = &valuer.EnumValue{Variant: variant}
+		enum.Variants = append(enum.Variants, variant)
+	}
+	t.env.Define(stmt.Name, enum)
+}
+
+// variantValue returns the value of a variant without params, or the
+// constructor of a variant with params.
+func variantValue(variant *valuer.EnumVariant) valuer.Valuer {
+	if variant.Unit != nil {
+		return variant.Unit
+	}
+	return variant.Constructor
+}
+
+// enumProperty returns a variant of enum, or values() listing all of them.
+func enumProperty(enum *valuer.Enum, name string) valuer.Valuer {
+	if variant := enum.Variant(name); variant != nil {
+		return variantValue(variant)
+	}
+	if name == "values" {
+		return &valuer.Builtin{Name: "values", Min: 0, Max: 0, Fn: func([]valuer.Valuer) valuer.Valuer {
+			elements := make([]valuer.Valuer, len(enum.Variants))
+			for i, variant := range enum.Variants {
+				elements[i] = variantValue(variant)
+			}
+			return &valuer.Array{Elements: elements}
+		}}
+	}
+	errors.Error(token.Identifier, fmt.Sprintf("Enum %s has no variant %s.", enum.Name, name))
+	return nil
+}
+
+// enumValueProperty returns a field of v, its name, or the value of a variant
+// without params.
+func enumValueProperty(v *valuer.EnumValue, name string) valuer.Valuer {
+	if field, ok := v.Field(name); ok {
+		return field
+	}
+	switch {
+	case name == "name":
+		return &valuer.String{Value: v.Variant.Name}
+	case name == "value" && v.Variant.Value != nil:
+		return v.Variant.Value
+	}
+	errors.Error(token.Identifier, fmt.Sprintf("Undefined propterty %s.", name))
+	return nil
+}
+
+// enumValuesEqual reports whether a and b are of the same variant with equal fields.
+func (t *thread) enumValuesEqual(a, b *valuer.EnumValue) bool {
+	if a.Variant != b.Variant {
+		return false
+	}
+	for i := range a.Fields {
+		if !t.isEqual(a.Fields[i], b.Fields[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *thread) matchEnumPattern(p *ast.EnumPattern, v valuer.Valuer, environment *valuer.Environment) bool {
+	enum, ok := t.evalWith(p.Enum, environment).(*valuer.Enum)
+	if !ok {
+		errors.Error(token.Identifier, fmt.Sprintf("%s is not an enum.", p.Enum.Name))
+	}
+	variant := enum.Variant(p.Variant)
+	if variant == nil {
+		errors.Error(token.Identifier, fmt.Sprintf("Enum %s has no variant %s.", enum.Name, p.Variant))
+	}
+	if p.Args != nil && len(p.Args) != len(variant.Params) {
+		errors.Error(token.LeftParen, fmt.Sprintf("%s.%s has %d fields, but the pattern has %d.", enum.Name, variant.Name, len(variant.Params), len(p.Args)))
+	}
+	value, ok := v.(*valuer.EnumValue)
+	if !ok || value.Variant != variant {
+		return false
+	}
+	for i, arg := range p.Args {
+		if !t.matchPattern(arg, value.Fields[i], environment) {
+			return false
+		}
+	}
+	return true
+}
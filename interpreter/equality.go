@@ -0,0 +1,297 @@
+package interpreter
+
+import (
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+
+	"tiny-script/errors"
+	"tiny-script/token"
+	"tiny-script/valuer"
+)
+
+// strictEqual implements ===, values of different types are never the same,
+// and composite values are the same only if they are the same reference.
+func (t *thread) strictEqual(a, b valuer.Valuer) bool {
+	if a.Type() != b.Type() {
+		return false
+	}
+	switch a.(type) {
+	case *valuer.Nil, *valuer.Boolean, *valuer.String, *valuer.Int, *valuer.Number, *valuer.BigInt, *valuer.Decimal:
+		return t.isEqual(a, b)
+	}
+	return a == b
+}
+
+// pair is a pair of values being compared by deepEqual.
+type pair struct{ a, b valuer.Valuer }
+
+// deepEqual compares arrays, maps and enum values by their contents, other
+// values are compared by ==. A pair of values met again while comparing them
+// is taken as equal so that cyclic values can be compared.
+func (t *thread) deepEqual(a, b valuer.Valuer, seen map[pair]bool) bool {
+	switch a1 := a.(type) {
+	case *valuer.Array:
+		b1, ok := b.(*valuer.Array)
+		if !ok {
+			return false
+		}
+		if a1 == b1 || seen[pair{a, b}] {
+			return true
+		}
+		seen[pair{a, b}] = true
+		x, y := a1.Snapshot(), b1.Snapshot()
+		if len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !t.deepEqual(x[i], y[i], seen) {
+				return false
+			}
+		}
+		return true
+	case *valuer.Map:
+		b1, ok := b.(*valuer.Map)
+		if !ok {
+			return false
+		}
+		if a1 == b1 || seen[pair{a, b}] {
+			return true
+		}
+		seen[pair{a, b}] = true
+		entries := a1.Entries()
+		if len(entries) != b1.Len() {
+			return false
+		}
+		for _, e := range entries {
+			v, ok := t.mapGet(b1, e.Key)
+			if !ok || !t.deepEqual(e.Value, v, seen) {
+				return false
+			}
+		}
+		return true
+	case *valuer.EnumValue:
+		b1, ok := b.(*valuer.EnumValue)
+		if !ok || a1.Variant != b1.Variant {
+			return false
+		}
+		for i := range a1.Fields {
+			if !t.deepEqual(a1.Fields[i], b1.Fields[i], seen) {
+				return false
+			}
+		}
+		return true
+	}
+	return t.isEqual(a, b)
+}
+
+// equals reports whether a and b are structurally equal.
+func (t *thread) equals(a, b valuer.Valuer) bool {
+	return t.deepEqual(a, b, make(map[pair]bool))
+}
+
+// hashValue returns a hash consistent with equals: equal values have the same
+// hash. Instances are hashed by __hash__, or by reference without it.
+func (t *thread) hashValue(v valuer.Valuer) uint64 {
+	h := fnv.New64a()
+	t.writeHash(h, v, make(map[valuer.Valuer]bool))
+	return h.Sum64()
+}
+
+func (t *thread) writeHash(h hash.Hash64, v valuer.Valuer, visiting map[valuer.Valuer]bool) {
+	if isNumber(v) {
+		// numbers of different types equal to each other as floats, so that
+		// they are hashed as floats.
+		f, _ := toFloat(v)
+		if f == 0 {
+			f = 0 // -0 equals 0
+		}
+		fmt.Fprint(h, "number:", math.Float64bits(f))
+		return
+	}
+	fmt.Fprint(h, v.Type(), ":")
+	switch x := v.(type) {
+	case *valuer.Nil:
+	case *valuer.Boolean:
+		fmt.Fprint(h, x.Value)
+	case *valuer.String:
+		h.Write([]byte(x.Value))
+	case *valuer.Array:
+		if visiting[x] {
+			return
+		}
+		visiting[x] = true
+		for _, e := range x.Snapshot() {
+			t.writeHash(h, e, visiting)
+			h.Write([]byte{','})
+		}
+		delete(visiting, x)
+	case *valuer.Map:
+		if visiting[x] {
+			return
+		}
+		visiting[x] = true
+		// the entries are hashed in any order.
+		var sum uint64
+		for _, e := range x.Entries() {
+			entry := fnv.New64a()
+			t.writeHash(entry, e.Key, visiting)
+			entry.Write([]byte{':'})
+			t.writeHash(entry, e.Value, visiting)
+			sum += entry.Sum64()
+		}
+		fmt.Fprint(h, sum)
+		delete(visiting, x)
+	case *valuer.EnumValue:
+		fmt.Fprint(h, reflect.ValueOf(x.Variant).Pointer())
+		for _, f := range x.Fields {
+			t.writeHash(h, f, visiting)
+		}
+	case *valuer.Instance:
+		if method, ok := specialMethod(x, "__hash__"); ok {
+			n, ok := t.callFunction(method, nil, nil).(*valuer.Int)
+			if !ok {
+				errors.Error(token.LeftParen, "__hash__ must return an int.")
+			}
+			fmt.Fprint(h, n.Value)
+			return
+		}
+		fmt.Fprint(h, reflect.ValueOf(x).Pointer())
+	default:
+		fmt.Fprint(h, reflect.ValueOf(v).Pointer())
+	}
+}
+
+// typeRanks orders the values of different types for compareValues.
+var typeRanks = map[valuer.Type]int{
+	valuer.NilType:      0,
+	valuer.BooleanType:  1,
+	valuer.IntType:      2,
+	valuer.NumberType:   2,
+	valuer.BigIntType:   2,
+	valuer.DecimalType:  2,
+	valuer.StringType:   3,
+	valuer.ArrayType:    4,
+	valuer.VariantType:  5,
+	valuer.InstanceType: 6,
+}
+
+// compareValues orders any two values: nil < bools < numbers < strings < arrays
+// < enum values < instances < others. Arrays are compared element by element,
+// enum values by the order of their variants, instances by __lt__.
+func (t *thread) compareValues(a, b valuer.Valuer) int {
+	ra, ok := typeRanks[a.Type()]
+	if !ok {
+		ra = len(typeRanks)
+	}
+	rb, ok := typeRanks[b.Type()]
+	if !ok {
+		rb = len(typeRanks)
+	}
+	if ra != rb {
+		return ra - rb
+	}
+	switch x := a.(type) {
+	case *valuer.Boolean:
+		return boolRank(x.Value) - boolRank(b.(*valuer.Boolean).Value)
+	case *valuer.String:
+		return strings.Compare(x.Value, b.(*valuer.String).Value)
+	case *valuer.Array:
+		xs, ys := x.Snapshot(), b.(*valuer.Array).Snapshot()
+		for i := 0; i < len(xs) && i < len(ys); i++ {
+			if c := t.compareValues(xs[i], ys[i]); c != 0 {
+				return c
+			}
+		}
+		return len(xs) - len(ys)
+	case *valuer.EnumValue:
+		y := b.(*valuer.EnumValue)
+		if x.Variant.Enum != y.Variant.Enum {
+			return strings.Compare(x.Variant.Enum.Name, y.Variant.Enum.Name)
+		}
+		if x.Variant != y.Variant {
+			return variantIndex(x.Variant) - variantIndex(y.Variant)
+		}
+		for i := range x.Fields {
+			if c := t.compareValues(x.Fields[i], y.Fields[i]); c != 0 {
+				return c
+			}
+		}
+		return 0
+	case *valuer.Instance:
+		if method, ok := specialMethod(a, "__lt__"); ok && isTruthy(t.callFunction(method, []valuer.Valuer{b}, nil)) {
+			return -1
+		}
+		if method, ok := specialMethod(b, "__lt__"); ok && isTruthy(t.callFunction(method, []valuer.Valuer{a}, nil)) {
+			return 1
+		}
+		return 0
+	}
+	if isNumber(a) {
+		switch {
+		case compareNumbers(token.Less, a, b):
+			return -1
+		case compareNumbers(token.Greater, a, b):
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a.Type().String(), b.Type().String())
+}
+
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func variantIndex(variant *valuer.EnumVariant) int {
+	for i, v := range variant.Enum.Variants {
+		if v == variant {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t *thread) builtinEquals(args []valuer.Valuer) valuer.Valuer {
+	return toBooleanValuer(t.equals(args[0], args[1]))
+}
+
+func (t *thread) builtinHash(args []valuer.Valuer) valuer.Valuer {
+	return &valuer.Int{Value: int64(t.hashValue(args[0]))}
+}
+
+// builtinSort returns a sorted copy of an array, ordered by compareValues or
+// by a compare function returning a negative number if a < b, zero if a == b
+// and a positive number if a > b. The sort is stable.
+func (t *thread) builtinSort(args []valuer.Valuer) valuer.Valuer {
+	array, ok := args[0].(*valuer.Array)
+	if !ok {
+		errors.Error(token.LeftParen, fmt.Sprintf("sort expects an array, got %s.", args[0].Type()))
+	}
+	elements := array.Snapshot()
+	compare := t.compareValues
+	if len(args) > 1 {
+		fn := args[1]
+		compare = func(a, b valuer.Valuer) int {
+			v := t.callValue(fn, a, b)
+			switch {
+			case !isNumber(v):
+				errors.Error(token.LeftParen, "Compare function must return a number.")
+			case compareNumbers(token.Less, v, &valuer.Int{}):
+				return -1
+			case compareNumbers(token.Greater, v, &valuer.Int{}):
+				return 1
+			}
+			return 0
+		}
+	}
+	sort.SliceStable(elements, func(i, j int) bool { return compare(elements[i], elements[j]) < 0 })
+	return &valuer.Array{Elements: elements}
+}
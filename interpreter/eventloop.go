@@ -0,0 +1,436 @@
+package interpreter
+
+import (
+	"container/heap"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"tiny-script/ast"
+	"tiny-script/errors"
+	"tiny-script/token"
+	"tiny-script/valuer"
+)
+
+// Clock tells the time of the event loop, tests replace it with a fake clock.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+var clock Clock = systemClock{}
+
+// SetClock replaces the clock of the event loop.
+func SetClock(c Clock) {
+	clock = c
+}
+
+// The event loop runs on the main thread after the script: promise reactions
+// run as microtasks before each timer, and timers run in the order they are due.
+type eventLoop struct {
+	mu         sync.Mutex
+	timers     timerQueue
+	byID       map[int64]*timer
+	nextID     int64
+	seq        int64
+	microtasks []func()
+	rejected   []*valuer.Promise // rejected promises, reported if never handled
+}
+
+type timer struct {
+	id       int64
+	seq      int64 // timers due at the same time run in the order they are scheduled
+	due      time.Time
+	interval time.Duration // zero for setTimeout
+	repeat   bool
+	callback valuer.Valuer
+	args     []valuer.Valuer
+	index    int
+}
+
+// timerQueue is a heap of timers ordered by due time.
+type timerQueue []*timer
+
+func (q timerQueue) Len() int { return len(q) }
+
+func (q timerQueue) Less(i, j int) bool {
+	if q[i].due.Equal(q[j].due) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].due.Before(q[j].due)
+}
+
+func (q timerQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index, q[j].index = i, j
+}
+
+func (q *timerQueue) Push(x interface{}) {
+	tm := x.(*timer)
+	tm.index = len(*q)
+	*q = append(*q, tm)
+}
+
+func (q *timerQueue) Pop() interface{} {
+	old := *q
+	tm := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return tm
+}
+
+var loop = newEventLoop()
+
+func newEventLoop() *eventLoop {
+	return &eventLoop{byID: make(map[int64]*timer)}
+}
+
+func (l *eventLoop) schedule(tm *timer) {
+	l.seq++
+	tm.seq = l.seq
+	heap.Push(&l.timers, tm)
+}
+
+func (l *eventLoop) addTimer(callback valuer.Valuer, delay time.Duration, repeat bool, args []valuer.Valuer) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.nextID++
+	tm := &timer{id: l.nextID, due: clock.Now().Add(delay), interval: delay, repeat: repeat, callback: callback, args: args}
+	l.byID[tm.id] = tm
+	l.schedule(tm)
+	return tm.id
+}
+
+func (l *eventLoop) clearTimer(id int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if tm, ok := l.byID[id]; ok {
+		heap.Remove(&l.timers, tm.index)
+		delete(l.byID, id)
+	}
+}
+
+// nextTimer removes the earliest timer, an interval is scheduled again.
+func (l *eventLoop) nextTimer() *timer {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.timers) == 0 {
+		return nil
+	}
+	tm := heap.Pop(&l.timers).(*timer)
+	if tm.repeat {
+		next := *tm
+		next.due = tm.due.Add(tm.interval)
+		l.byID[tm.id] = &next
+		l.schedule(&next)
+	} else {
+		delete(l.byID, tm.id)
+	}
+	return tm
+}
+
+func (l *eventLoop) enqueue(fn func()) {
+	l.mu.Lock()
+	l.microtasks = append(l.microtasks, fn)
+	l.mu.Unlock()
+}
+
+func (l *eventLoop) runMicrotasks() {
+	for {
+		l.mu.Lock()
+		if len(l.microtasks) == 0 {
+			l.mu.Unlock()
+			return
+		}
+		fn := l.microtasks[0]
+		l.microtasks = l.microtasks[1:]
+		l.mu.Unlock()
+		fn()
+	}
+}
+
+// run runs the microtasks and the timers until none is left.
+func (l *eventLoop) run() {
+	for {
+		l.runMicrotasks()
+		tm := l.nextTimer()
+		if tm == nil {
+			return
+		}
+		if d := tm.due.Sub(clock.Now()); d > 0 {
+			clock.Sleep(d)
+		}
+		mainThread.callValue(tm.callback, tm.args...)
+	}
+}
+
+func (l *eventLoop) idle() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.timers) == 0 && len(l.microtasks) == 0
+}
+
+// runEventLoop runs the event loop and waits for the spawned tasks until both
+// are done, then reports the rejections that no one has handled.
+func runEventLoop() {
+	for {
+		loop.run()
+		waitTasks()
+		if loop.idle() {
+			break
+		}
+	}
+	loop.mu.Lock()
+	rejected := loop.rejected
+	loop.rejected = nil
+	loop.mu.Unlock()
+	for _, p := range rejected {
+		if !p.Handled() {
+			_, reason := p.Result()
+			fmt.Fprintln(os.Stderr, "Uncaught (in promise) "+reason.String())
+		}
+	}
+}
+
+// callValue calls callee on t, the callbacks of the event loop run on the main
+// thread and those of built-in functions on the thread calling the built-in,
+// so that the calls count toward the depth of its call stack.
+func (t *thread) callValue(callee valuer.Valuer, args ...valuer.Valuer) valuer.Valuer {
+	return t.call(callee, args, nil)
+}
+
+// catch calls fn and returns the reason of the runtime error it raised.
+func catch(fn func()) (reason valuer.Valuer) {
+	defer func() {
+		if r := recover(); r != nil {
+			err, ok := r.(errors.RuntimeError)
+			if !ok {
+				panic(r)
+			}
+			reason = &valuer.String{Value: err.Error()}
+		}
+	}()
+	fn()
+	return nil
+}
+
+// onSettled runs fn as a microtask once p is settled.
+func onSettled(p *valuer.Promise, fn func(valuer.PromiseState, valuer.Valuer)) {
+	p.OnSettled(func(state valuer.PromiseState, v valuer.Valuer) {
+		loop.enqueue(func() { fn(state, v) })
+	})
+}
+
+func settlePromise(p *valuer.Promise, state valuer.PromiseState, v valuer.Valuer) {
+	if p.Settle(state, v) && state == valuer.Rejected {
+		loop.mu.Lock()
+		loop.rejected = append(loop.rejected, p)
+		loop.mu.Unlock()
+	}
+}
+
+// resolvePromise fulfills p with v, p follows v instead if v is a promise.
+func resolvePromise(p *valuer.Promise, v valuer.Valuer) {
+	inner, ok := v.(*valuer.Promise)
+	if !ok {
+		settlePromise(p, valuer.Fulfilled, v)
+		return
+	}
+	if inner == p {
+		settlePromise(p, valuer.Rejected, &valuer.String{Value: "Chaining cycle detected for promise."})
+		return
+	}
+	onSettled(inner, func(state valuer.PromiseState, v valuer.Valuer) {
+		settlePromise(p, state, v)
+	})
+}
+
+// then returns a promise resolved by the result of the handler matching the
+// state p settles with, a missing handler passes the state on.
+func then(p *valuer.Promise, onFulfilled, onRejected valuer.Valuer) *valuer.Promise {
+	next := &valuer.Promise{}
+	onSettled(p, func(state valuer.PromiseState, v valuer.Valuer) {
+		handler := onFulfilled
+		if state == valuer.Rejected {
+			handler = onRejected
+		}
+		if handler == nil || handler.Type() == valuer.NilType {
+			settlePromise(next, state, v)
+			return
+		}
+		var result valuer.Valuer
+		if reason := catch(func() { result = mainThread.callValue(handler, v) }); reason != nil {
+			settlePromise(next, valuer.Rejected, reason)
+			return
+		}
+		resolvePromise(next, result)
+	})
+	return next
+}
+
+func promiseProperty(p *valuer.Promise, name string) valuer.Valuer {
+	switch name {
+	case "then":
+		return &valuer.Builtin{Name: "then", Min: 1, Max: 2, Fn: func(args []valuer.Valuer) valuer.Valuer {
+			var onRejected valuer.Valuer
+			if len(args) > 1 {
+				onRejected = args[1]
+			}
+			return then(p, args[0], onRejected)
+		}}
+	case "catch":
+		return &valuer.Builtin{Name: "catch", Min: 1, Max: 1, Fn: func(args []valuer.Valuer) valuer.Valuer {
+			return then(p, nil, args[0])
+		}}
+	}
+	errors.Error(token.Identifier, "Undefined propterty "+name+".")
+	return nil
+}
+
+// rejection is sent to a suspended async function to raise the reason of the
+// promise it awaits.
+type rejection struct {
+	reason valuer.Valuer
+}
+
+func (*rejection) Type() valuer.Type { return valuer.NilType }
+
+func (r *rejection) String() string { return r.reason.String() }
+
+// runAsync runs the body of an async function as a generator suspended at each
+// await, the returned promise is settled by the result of the body.
+func runAsync(function *valuer.Function, environment *valuer.Environment) *valuer.Promise {
+	promise := &valuer.Promise{}
+	state := newGeneratorState()
+	var step func(sent valuer.Valuer)
+	step = func(sent valuer.Valuer) {
+		var (
+			awaited valuer.Valuer
+			done    bool
+		)
+		reason := catch(func() {
+			awaited, done = state.resumeWith(sent, func() { state.run(function, environment) })
+		})
+		switch {
+		case reason != nil:
+			settlePromise(promise, valuer.Rejected, reason)
+		case done:
+			resolvePromise(promise, awaited)
+		default:
+			// resumed in a microtask, even if the awaited value is not a promise.
+			awaitedPromise, ok := awaited.(*valuer.Promise)
+			if !ok {
+				awaitedPromise = &valuer.Promise{}
+				awaitedPromise.Settle(valuer.Fulfilled, awaited)
+			}
+			onSettled(awaitedPromise, func(state valuer.PromiseState, v valuer.Valuer) {
+				if state == valuer.Rejected {
+					v = &rejection{reason: v}
+				}
+				step(v)
+			})
+		}
+	}
+	step(Nil)
+	return promise
+}
+
+func (t *thread) evalAwaitExpr(expr *ast.AwaitExpr) valuer.Valuer {
+	v := t.suspend(t.Eval(expr.Value))
+	if r, ok := v.(*rejection); ok {
+		errors.Error(token.Await, r.reason.String())
+	}
+	return v
+}
+
+// toDelay converts milliseconds to a duration, a negative delay is zero.
+func toDelay(v valuer.Valuer) time.Duration {
+	ms, ok := toFloat(v)
+	if !ok {
+		errors.Error(token.LeftParen, fmt.Sprintf("Delay must be a number, got %s.", v.Type()))
+	}
+	if ms < 0 {
+		ms = 0
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// builtinSetTimeout calls a function with the rest arguments after a delay in
+// milliseconds, such as setTimeout(f, 100, x), and returns the id of the timer.
+func builtinSetTimeout(args []valuer.Valuer) valuer.Valuer {
+	return scheduleTimer(args, false)
+}
+
+// builtinSetInterval calls a function repeatedly every delay milliseconds.
+func builtinSetInterval(args []valuer.Valuer) valuer.Valuer {
+	return scheduleTimer(args, true)
+}
+
+func scheduleTimer(args []valuer.Valuer, repeat bool) valuer.Valuer {
+	callback := args[0]
+	switch callback.(type) {
+	case *valuer.Function, *valuer.Builtin, *valuer.ClassValue:
+	default:
+		errors.Error(token.LeftParen, fmt.Sprintf("Timer callback must be a function, got %s.", callback.Type()))
+	}
+	var delay time.Duration
+	if len(args) > 1 {
+		delay = toDelay(args[1])
+	}
+	var rest []valuer.Valuer
+	if len(args) > 2 {
+		rest = args[2:]
+	}
+	return &valuer.Int{Value: loop.addTimer(callback, delay, repeat, rest)}
+}
+
+// builtinClearTimeout cancels a timer, an unknown id is ignored.
+func builtinClearTimeout(args []valuer.Valuer) valuer.Valuer {
+	if id, ok := args[0].(*valuer.Int); ok {
+		loop.clearTimer(id.Value)
+	}
+	return Nil
+}
+
+// builtinPromise makes a promise settled by the executor, which is called at
+// once with the functions resolve and reject.
+func (t *thread) builtinPromise(args []valuer.Valuer) valuer.Valuer {
+	p := &valuer.Promise{}
+	resolve := &valuer.Builtin{Name: "resolve", Min: 0, Max: 1, Fn: func(args []valuer.Valuer) valuer.Valuer {
+		var v valuer.Valuer = Nil
+		if len(args) > 0 {
+			v = args[0]
+		}
+		resolvePromise(p, v)
+		return Nil
+	}}
+	reject := &valuer.Builtin{Name: "reject", Min: 0, Max: 1, Fn: func(args []valuer.Valuer) valuer.Valuer {
+		var reason valuer.Valuer = Nil
+		if len(args) > 0 {
+			reason = args[0]
+		}
+		settlePromise(p, valuer.Rejected, reason)
+		return Nil
+	}}
+	if reason := catch(func() { t.callValue(args[0], resolve, reject) }); reason != nil {
+		settlePromise(p, valuer.Rejected, reason)
+	}
+	return p
+}
+
+// builtinSleep returns a promise fulfilled after a delay in milliseconds.
+func builtinSleep(args []valuer.Valuer) valuer.Valuer {
+	p := &valuer.Promise{}
+	resolve := &valuer.Builtin{Name: "resolve", Min: 0, Max: 0, Fn: func([]valuer.Valuer) valuer.Valuer {
+		settlePromise(p, valuer.Fulfilled, Nil)
+		return Nil
+	}}
+	loop.addTimer(resolve, toDelay(args[0]), false, nil)
+	return p
+}
@@ -0,0 +1,230 @@
+package interpreter
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tiny-script/ast"
+	"tiny-script/errors"
+	"tiny-script/token"
+	"tiny-script/valuer"
+)
+
+// A generator runs its body on its own thread in a goroutine, handing control
+// back and forth with the caller over unbuffered channels.
+type generatorState struct {
+	resume chan valuer.Valuer // caller -> generator, closed to abandon it
+	yield  chan generatorStep // generator -> caller
+
+	mu      sync.Mutex // guards the flags below, a generator may be shared by threads
+	started bool
+	running bool
+	done    bool
+}
+
+type generatorStep struct {
+	value valuer.Valuer
+	done  bool
+	err   interface{} // panic raised by the generator
+}
+
+// generatorExit unwinds the goroutine of an abandoned generator.
+type generatorExit struct{}
+
+var (
+	// abandoned holds the generators collected by the GC, they are closed by
+	// the interpreter goroutine at the next generator creation and when a
+	// program finishes.
+	abandonedMu sync.Mutex
+	abandoned   []*generatorState
+	// liveGenerators counts the goroutines of the generators started and not
+	// finished, only those can be left suspended by a program.
+	liveGenerators int64
+
+	iteratorResultClass = &valuer.ClassValue{Name: "IteratorResult"}
+)
+
+func newGenerator(function *valuer.Function, environment *valuer.Environment) *valuer.Generator {
+	closeAbandoned()
+	state := newGeneratorState()
+	g := &valuer.Generator{
+		Name: function.Name,
+		Resume: func(sent valuer.Valuer) (valuer.Valuer, bool) {
+			return state.resumeWith(sent, func() { state.run(function, environment) })
+		},
+		Close: state.close,
+	}
+	// the goroutine only references state, so g can be collected while suspended.
+	runtime.SetFinalizer(g, func(*valuer.Generator) {
+		abandonedMu.Lock()
+		abandoned = append(abandoned, state)
+		abandonedMu.Unlock()
+	})
+	return g
+}
+
+// gcSentinel holds a pointer so that it is not allocated by the tiny allocator,
+// whose objects may never be finalized.
+type gcSentinel struct {
+	_ *int
+}
+
+// releaseAbandoned closes the generators the finished program has abandoned,
+// a collection is forced and waited for so that their finalizers have run.
+// There is nothing to collect when no generator is suspended.
+func releaseAbandoned() {
+	if atomic.LoadInt64(&liveGenerators) == 0 {
+		closeAbandoned()
+		return
+	}
+	for i := 0; i < 2; i++ {
+		// the finalizers queued by a collection have run once the one of an
+		// object dropped before it has.
+		done := make(chan struct{})
+		runtime.SetFinalizer(&gcSentinel{}, func(*gcSentinel) { close(done) })
+		runtime.GC()
+		select {
+		case <-done:
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	closeAbandoned()
+}
+
+func newGeneratorState() *generatorState {
+	return &generatorState{
+		resume: make(chan valuer.Valuer),
+		yield:  make(chan generatorStep),
+	}
+}
+
+func closeAbandoned() {
+	abandonedMu.Lock()
+	states := abandoned
+	abandoned = nil
+	abandonedMu.Unlock()
+	for _, state := range states {
+		state.close()
+	}
+}
+
+func (g *generatorState) resumeWith(sent valuer.Valuer, start func()) (valuer.Valuer, bool) {
+	g.mu.Lock()
+	if g.done {
+		g.mu.Unlock()
+		return Nil, true
+	}
+	if g.running {
+		g.mu.Unlock()
+		errors.Error(token.Yield, "Generator is already running.")
+	}
+	g.running = true
+	started := g.started
+	g.started = true
+	g.mu.Unlock()
+
+	if !started {
+		atomic.AddInt64(&liveGenerators, 1)
+		go start()
+	} else {
+		g.resume <- sent
+	}
+	step := <-g.yield
+
+	g.mu.Lock()
+	g.running = false
+	g.done = step.done
+	g.mu.Unlock()
+	if step.err != nil {
+		panic(step.err)
+	}
+	return step.value, step.done
+}
+
+// run runs the body of function on a thread of its own, the deferred
+// expressions of the body run when it finishes or is abandoned.
+func (g *generatorState) run(function *valuer.Function, environment *valuer.Environment) {
+	step := generatorStep{done: true, value: Nil}
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(generatorExit); !ok {
+				step.err = r
+			}
+		}
+		atomic.AddInt64(&liveGenerators, -1)
+		g.yield <- step
+	}()
+	t := &thread{env: environment, generator: g}
+	t.pushFrame(function)
+	defer t.popFrame()
+	if v, ok := t.executeBlock(function.Body, environment).(*valuer.ReturnValue); ok {
+		step.value = v.Value
+		if call, ok := v.Value.(*tailCall); ok {
+			step.value = t.call(call.callee, call.args, call.named)
+		}
+	}
+}
+
+// close abandons a suspended generator, its goroutine unwinds from the yield.
+func (g *generatorState) close() {
+	g.mu.Lock()
+	if g.running {
+		g.mu.Unlock()
+		errors.Error(token.Yield, "Generator is already running.")
+	}
+	done, started := g.done, g.started
+	g.done = true
+	g.mu.Unlock()
+	if done || !started {
+		return
+	}
+	close(g.resume)
+	<-g.yield
+}
+
+func (t *thread) evalYieldExpr(expr *ast.YieldExpr) valuer.Valuer {
+	var v valuer.Valuer = Nil
+	if expr.Value != nil {
+		v = t.Eval(expr.Value)
+	}
+	return t.suspend(v)
+}
+
+// suspend hands v to the caller resuming the generator run by t, and returns
+// the value sent when it is resumed.
+func (t *thread) suspend(v valuer.Valuer) valuer.Valuer {
+	t.generator.yield <- generatorStep{value: v}
+	sent, ok := <-t.generator.resume
+	if !ok {
+		panic(generatorExit{})
+	}
+	return sent
+}
+
+// generatorProperty returns the methods of a generator: next(sent) resumes it
+// and returns an IteratorResult with value and done, close() abandons it.
+func generatorProperty(g *valuer.Generator, name string) valuer.Valuer {
+	switch name {
+	case "next":
+		return &valuer.Builtin{Name: "next", Min: 0, Max: 1, Fn: func(args []valuer.Valuer) valuer.Valuer {
+			var sent valuer.Valuer = Nil
+			if len(args) > 0 {
+				sent = args[0]
+			}
+			v, done := g.Resume(sent)
+			return &valuer.Instance{
+				Klass:  iteratorResultClass,
+				Fileds: map[string]valuer.Valuer{"value": v, "done": toBooleanValuer(done)},
+			}
+		}}
+	case "close":
+		return &valuer.Builtin{Name: "close", Min: 0, Max: 0, Fn: func([]valuer.Valuer) valuer.Valuer {
+			g.Close()
+			return Nil
+		}}
+	}
+	errors.Error(token.Identifier, "Undefined propterty "+name+".")
+	return nil
+}
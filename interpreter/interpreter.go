@@ -2,9 +2,12 @@ package interpreter
 
 import (
 	"fmt"
+	"math"
+	"math/big"
 	"os"
 	"reflect"
 	"strconv"
+	"strings"
 
 	"tiny-script/ast"
 	"tiny-script/errors"
@@ -22,9 +25,18 @@ var (
 // potential value is empty or "repl".
 var evalEnv string
 
+// thread holds the evaluation state of a goroutine, the main script, each
+// spawned task and each generator run on their own thread sharing globals.
+type thread struct {
+	env       *valuer.Environment // the current environment
+	generator *generatorState     // the generator run by the thread, nil otherwise
+	frames    []*frame            // the functions being called, innermost last
+	printing  []*valuer.Instance  // the instances whose toString or __str__ is being called
+}
+
 var (
-	env     *valuer.Environment
-	globals *valuer.Environment
+	globals    *valuer.Environment
+	mainThread *thread
 )
 
 func init() {
@@ -33,10 +45,47 @@ func init() {
 
 func initEnv() {
 	globals = valuer.NewEnv()
-	env = globals
+	mainThread = &thread{env: globals}
+	defineBuiltins(globals)
+	resolver.Reset()
+	closeAbandoned()
+	stopThreads()
+	resetThreads()
+	loop = newEventLoop()
+}
+
+// uninitialized is the value of a let/const variable before its declaration
+// is executed, reading or assigning it raises an error (temporal dead zone).
+type uninitialized struct{}
+
+func (*uninitialized) Type() valuer.Type { return valuer.NilType }
+
+func (*uninitialized) String() string { return "<uninitialized>" }
+
+var hole = &uninitialized{}
+
+// hoistDeclarations defines the let/const variables declared by statements
+// in environment ahead of execution, so that they shadow outer variables
+// through the whole block.
+func hoistDeclarations(statements []ast.Stmt, environment *valuer.Environment) {
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *ast.LetStmt:
+			environment.Define(s.Name.Name, hole)
+		case *ast.ConstStmt:
+			environment.Define(s.Name.Name, hole)
+		case *ast.DestructureStmt:
+			if s.Kind != token.Var {
+				for _, name := range ast.PatternNames(s.Pattern) {
+					environment.Define(name, hole)
+				}
+			}
+		}
+	}
 }
 
 func Interpret(statements []ast.Stmt) {
+	defer releaseAbandoned()
 	defer func() {
 		if r := recover(); r != nil {
 			if err, ok := r.(errors.RuntimeError); ok {
@@ -46,12 +95,14 @@ func Interpret(statements []ast.Stmt) {
 			}
 		}
 	}()
+	resolver.Hoist(statements)
 	for _, stmt := range statements {
 		resolver.Resolve(stmt)
 	}
+	hoistDeclarations(statements, globals)
 	//var v valuer.Valuer
 	for _, stmt := range statements {
-		val := Eval(stmt)
+		val := mainThread.Eval(stmt)
 		if val != nil {
 			if val.Type() == valuer.ReturnType {
 				fmt.Fprintf(os.Stderr, "Unexpected return statement %v\n", val)
@@ -60,164 +111,291 @@ func Interpret(statements []ast.Stmt) {
 			}
 		}
 	}
+	runEventLoop()
 
 	//if v != nil && evalEnv == "repl" {
 	//	fmt.Printf("%s %s\n", black(v.Type().String()), v)
 	//}
 }
 
+// Eval evaluates node on the main thread.
 func Eval(node ast.Node) valuer.Valuer {
+	return mainThread.Eval(node)
+}
+
+// Eval evaluates node on thread t.
+func (t *thread) Eval(node ast.Node) valuer.Valuer {
 	switch n := node.(type) {
 	default:
 		panic(fmt.Sprintf("unknown ast type %#v.", n))
 	case *ast.Literal:
 		return evalLiteral(n)
 	case *ast.BinaryExpr:
-		return evalBinaryExpr(n)
+		return t.evalBinaryExpr(n)
 	case *ast.UnaryExpr:
-		return evalUnaryExpr(n)
+		return t.evalUnaryExpr(n)
 	case *ast.GroupingExpr:
-		return Eval(n.Expression)
+		return t.Eval(n.Expression)
 	case *ast.VariableExpr:
-		return evalVariableExpr(n)
+		return t.evalVariableExpr(n)
 	case *ast.AssignExpr:
-		return evalAssignExpr(n)
-	case *ast.ArrayAssignExpr:
-		return evalArrayAssignExpr(n)
+		return t.evalAssignExpr(n)
 	case *ast.LogicalExpr:
-		return evalLogicalExpr(n)
+		return t.evalLogicalExpr(n)
 	case *ast.CallExpr:
-		return evalCallExpr(n)
+		return t.evalCallExpr(n)
 	case *ast.GetExpr:
-		return evalGetExpr(n)
+		return t.evalGetExpr(n)
 	case *ast.SetExpr:
-		return evalSetExpr(n)
+		return t.evalSetExpr(n)
 	case *ast.ThisExpr:
-		return evalThisExpr(n)
+		return t.evalThisExpr(n)
 	case *ast.VarStmt:
-		evalVarStmt(n)
+		t.evalVarStmt(n)
 		return nil
 	case *ast.LetStmt:
-		evalLetStmt(n)
+		t.evalLetStmt(n)
+		return nil
+	case *ast.ConstStmt:
+		t.evalConstStmt(n)
 		return nil
+	case *ast.DestructureStmt:
+		t.evalDestructureStmt(n)
+		return nil
+	case *ast.ForInStmt:
+		return t.evalForInStmt(n)
+	case *ast.PatternAssignExpr:
+		return t.evalPatternAssignExpr(n)
 	case *ast.FunctionStmt:
-		evalFunctionStmt(n)
+		t.evalFunctionStmt(n)
 		return nil
 	case *ast.PrintStmt:
-		evalPrintStmt(n)
+		t.evalPrintStmt(n)
 		return nil
 	case *ast.BlockStmt:
-		return evalBlockStmt(n)
+		return t.evalBlockStmt(n)
 	case *ast.ExprStmt:
-		return evalExprStmt(n)
+		return t.evalExprStmt(n)
 	case *ast.IfStmt:
-		return evalIfStmt(n)
+		return t.evalIfStmt(n)
 	case *ast.WhileStmt:
-		return evalWhileStmt(n)
+		return t.evalWhileStmt(n)
 	case *ast.ReturnStmt:
-		return evalReturnStmt(n)
+		return t.evalReturnStmt(n)
+	case *ast.DeferStmt:
+		t.evalDeferStmt(n)
+		return nil
 	case *ast.ClassStmt:
-		evalClassStmt(n)
+		t.evalClassStmt(n)
 		return nil
 	case *ast.ImportStmt:
 		evalImportStmt(n)
 		return nil
 	case *ast.ArrayLiteralExpr:
-		return evalArrayLiteralExpr(n)
-	case *ast.IndexLiteralExpr:
-		return evalIndexLiteralExpr(n)
-	case *ast.IndexVariableExpr:
-		return evalIndexVariableExpr(n)
+		return t.evalArrayLiteralExpr(n)
+	case *ast.TemplateExpr:
+		return t.evalTemplateExpr(n)
+	case *ast.YieldExpr:
+		return t.evalYieldExpr(n)
+	case *ast.SpawnExpr:
+		return t.evalSpawnExpr(n)
+	case *ast.AwaitExpr:
+		return t.evalAwaitExpr(n)
+	case *ast.MatchStmt:
+		return t.evalMatchStmt(n)
+	case *ast.MatchExpr:
+		return t.evalMatchExpr(n)
+	case *ast.EnumStmt:
+		t.evalEnumStmt(n)
+		return nil
+	case *ast.TraitStmt:
+		t.evalTraitStmt(n)
+		return nil
+	case *ast.SelectStmt:
+		return t.evalSelectStmt(n)
+	case *ast.IndexExpr:
+		return t.evalIndexExpr(n)
+	case *ast.IndexSetExpr:
+		return t.evalIndexSetExpr(n)
+	case *ast.SliceExpr:
+		return t.evalSliceExpr(n)
 	}
 }
 
-func evalArrayAssignExpr(n *ast.ArrayAssignExpr) valuer.Valuer {
-	expr := evalVariableExpr(n.Left)
+func (t *thread) evalIndexExpr(expr *ast.IndexExpr) valuer.Valuer {
+	object := t.Eval(expr.Object)
+	index := t.Eval(expr.Index)
 
-	var index valuer.Valuer
-	switch n.Index.(type) {
-	case *ast.IndexLiteralExpr:
-		index = Eval(n.Index.(*ast.IndexLiteralExpr).Index)
-	case *ast.IndexVariableExpr:
-		t := n.Index.(*ast.IndexVariableExpr)
-		index = evalVariableExpr(t.Index.(*ast.VariableExpr))
+	switch o := object.(type) {
+	case *valuer.Array:
+		return o.Get(checkIndex(index, o.Len()))
+	case *valuer.String:
+		chars := []rune(o.Value)
+		return &valuer.String{Value: string(chars[checkIndex(index, len(chars))])}
+	case *valuer.Map:
+		return t.mapIndex(o, index)
+	case *valuer.Instance:
+		if method, ok := specialMethod(o, "__index__"); ok {
+			return t.callFunction(method, []valuer.Valuer{index}, nil)
+		}
+		errors.Error(token.LeftBracket, "Only arrays and strings can be indexed.")
+		return nil
+	default:
+		errors.Error(token.LeftBracket, "Only arrays and strings can be indexed.")
+		return nil
 	}
+}
 
-	if index.Type() != valuer.NumberType {
-		panic("Index must be number.")
-	}
+func (t *thread) evalIndexSetExpr(expr *ast.IndexSetExpr) valuer.Valuer {
+	object := t.Eval(expr.Object)
+	index := t.Eval(expr.Index)
+	v := t.Eval(expr.Value)
+	t.setIndex(object, index, v)
+	return v
+}
 
-	array, ok := expr.(*valuer.Array)
-	if !ok {
-		panic("Only array can be indexed.")
+func (t *thread) setIndex(object, index, v valuer.Valuer) {
+	if method, ok := specialMethod(object, "__setindex__"); ok {
+		t.callFunction(method, []valuer.Valuer{index, v}, nil)
+		return
 	}
-
-	indexVal := int(index.(*valuer.Number).Value)
-
-	if indexVal >= len(array.Elements) || indexVal < 0 {
-		panic("Index out of range.")
+	if m, ok := object.(*valuer.Map); ok {
+		t.mapSet(m, index, v)
+		return
 	}
-
-	array.Elements[indexVal] = Eval(n.Value)
-	return nil
-}
-
-func evalIndexVariableExpr(n *ast.IndexVariableExpr) valuer.Valuer {
-	v, ok := env.Get(n.Name)
+	array, ok := object.(*valuer.Array)
 	if !ok {
-		errors.Error(token.Identifier, fmt.Sprintf("Undefined variable %s.", n.Name))
+		errors.Error(token.LeftBracket, "Only array elements can be assigned.")
+		return
 	}
+	array.Set(checkIndex(index, array.Len()), v)
+}
 
-	if v.Type() != valuer.NumberType {
-		panic("Index must be number.")
+func (t *thread) evalSliceExpr(expr *ast.SliceExpr) valuer.Valuer {
+	object := t.Eval(expr.Object)
+	var bounds [3]valuer.Valuer
+	for i, e := range []ast.Expr{expr.Start, expr.End, expr.Step} {
+		if e != nil {
+			bounds[i] = t.Eval(e)
+		}
 	}
 
-	left := Eval(n.Left)
-
-	array, ok := left.(*valuer.Array)
-	if !ok {
-		panic("Only array can be indexed.")
+	switch o := object.(type) {
+	case *valuer.Array:
+		snapshot := o.Snapshot()
+		indexes := sliceIndexes(len(snapshot), bounds[0], bounds[1], bounds[2])
+		elements := make([]valuer.Valuer, 0, len(indexes))
+		for _, i := range indexes {
+			elements = append(elements, snapshot[i])
+		}
+		return &valuer.Array{Elements: elements}
+	case *valuer.String:
+		chars := []rune(o.Value)
+		indexes := sliceIndexes(len(chars), bounds[0], bounds[1], bounds[2])
+		sliced := make([]rune, 0, len(indexes))
+		for _, i := range indexes {
+			sliced = append(sliced, chars[i])
+		}
+		return &valuer.String{Value: string(sliced)}
+	default:
+		errors.Error(token.LeftBracket, "Only arrays and strings can be sliced.")
+		return nil
 	}
+}
 
-	index := int(v.(*valuer.Number).Value)
-	if index >= len(array.Elements) || index < 0 {
-		panic("Index out of range.")
+// checkIndex 校验索引是否为合法的整数且未越界，负数索引从末尾开始计算，返回对应的下标
+func checkIndex(index valuer.Valuer, length int) int {
+	i := toInteger(index, "Index must be an integer.")
+	if i < 0 {
+		i += length
 	}
-	return array.Elements[index]
+	if i < 0 || i >= length {
+		errors.Error(token.LeftBracket, fmt.Sprintf("Index %s out of range for length %d.", index, length))
+	}
+	return i
 }
 
-func evalIndexLiteralExpr(n *ast.IndexLiteralExpr) valuer.Valuer {
-	variableExpr, ok := n.Left.(*ast.VariableExpr)
-	if !ok {
-		panic("Only variable can be indexed.")
+// sliceIndexes 按照 Python 的切片规则计算 [start:end:step] 选中的下标，
+// 越界的 start/end 会被截断到合法范围内，nil 表示省略。
+func sliceIndexes(length int, start, end, step valuer.Valuer) []int {
+	st := 1
+	if step != nil && step != Nil {
+		st = toInteger(step, "Slice step must be an integer.")
+		if st == 0 {
+			errors.Error(token.Colon, "Slice step cannot be zero.")
+		}
 	}
-	var v valuer.Valuer
-	if variableExpr.Distance >= 0 {
-		v, ok = env.GetAt(variableExpr.Distance, variableExpr.Name)
-	} else {
-		v, ok = globals.Get(variableExpr.Name)
+
+	lower, upper := 0, length
+	if st < 0 {
+		lower, upper = -1, length-1
 	}
-	if !ok {
-		panic("Undefined variable.")
+	bound := func(v valuer.Valuer, def int) int {
+		if v == nil || v == Nil {
+			return def
+		}
+		i := toInteger(v, "Slice indices must be integers.")
+		if i < 0 {
+			i += length
+		}
+		if i < lower {
+			return lower
+		}
+		if i > upper {
+			return upper
+		}
+		return i
 	}
-	array, ok := v.(*valuer.Array)
-	if !ok {
-		panic("Only array can be indexed.")
+
+	var indexes []int
+	if st > 0 {
+		for i, j := bound(start, lower), bound(end, upper); i < j; i += st {
+			indexes = append(indexes, i)
+		}
+	} else {
+		for i, j := bound(start, upper), bound(end, lower); i > j; i += st {
+			indexes = append(indexes, i)
+		}
 	}
-	index := Eval(n.Index)
-	if index.Type() != valuer.NumberType {
-		panic("Index must be number.")
+	return indexes
+}
+
+// toInteger 将整数值的数字转为 int，否则以 msg 抛出运行时错误
+func toInteger(v valuer.Valuer, msg string) int {
+	switch n := v.(type) {
+	case *valuer.Int:
+		return int(n.Value)
+	case *valuer.Number:
+		if n.Value == math.Trunc(n.Value) {
+			return int(n.Value)
+		}
 	}
-	if int(index.(*valuer.Number).Value) >= len(array.Elements) {
-		panic("Index out of range.")
+	errors.Error(token.LeftBracket, msg)
+	return 0
+}
+
+func (t *thread) evalTemplateExpr(expr *ast.TemplateExpr) valuer.Valuer {
+	var b strings.Builder
+	for i, text := range expr.Texts {
+		b.WriteString(text)
+		if i < len(expr.Exprs) {
+			b.WriteString(t.display(t.Eval(expr.Exprs[i])))
+		}
 	}
-	return array.Elements[int(index.(*valuer.Number).Value)]
+	return &valuer.String{Value: b.String()}
 }
 
-func evalArrayLiteralExpr(expr *ast.ArrayLiteralExpr) valuer.Valuer {
+func (t *thread) evalArrayLiteralExpr(expr *ast.ArrayLiteralExpr) valuer.Valuer {
 	var elements = make([]valuer.Valuer, 0, len(expr.Elements))
 	for _, e := range expr.Elements {
-		elements = append(elements, Eval(e))
+		if spread, ok := e.(*ast.SpreadExpr); ok {
+			iterate(t.Eval(spread.Expression), func(v valuer.Valuer) bool {
+				elements = append(elements, v)
+				return true
+			})
+			continue
+		}
+		elements = append(elements, t.Eval(e))
 	}
 	return &valuer.Array{Elements: elements}
 }
@@ -231,11 +409,7 @@ func evalLiteral(lit *ast.Literal) valuer.Valuer {
 	case token.String:
 		return &valuer.String{Value: lit.Value}
 	case token.Number:
-		v, err := strconv.ParseFloat(lit.Value, 64)
-		if err != nil {
-			panic(err)
-		}
-		return &valuer.Number{Value: v}
+		return parseNumber(lit.Value)
 	case token.Nil:
 		return Nil
 	default:
@@ -243,102 +417,137 @@ func evalLiteral(lit *ast.Literal) valuer.Valuer {
 	}
 }
 
-func evalBinaryExpr(expr *ast.BinaryExpr) valuer.Valuer {
-	left := Eval(expr.Left)
-	right := Eval(expr.Right)
+// parseNumber converts a number literal validated by the lexer, such as 0xFF, 1_000 or .5,
+// literals without fraction and exponent are ints, the suffixes n and d make bigints and decimals.
+func parseNumber(literal string) valuer.Valuer {
+	digits := strings.ReplaceAll(literal, "_", "")
+	base := 10
+	if len(digits) > 2 && digits[0] == '0' {
+		if b, ok := map[byte]int{'x': 16, 'X': 16, 'o': 8, 'O': 8, 'b': 2, 'B': 2}[digits[1]]; ok {
+			base, digits = b, digits[2:]
+		}
+	}
+	if strings.HasSuffix(digits, "n") {
+		v, _ := new(big.Int).SetString(strings.TrimSuffix(digits, "n"), base)
+		return &valuer.BigInt{Value: v}
+	}
+	if base == 10 && strings.HasSuffix(digits, "d") {
+		v, err := valuer.ParseDecimal(strings.TrimSuffix(digits, "d"))
+		if err != nil {
+			errors.Error(token.Number, fmt.Sprintf("Decimal literal %s is out of range.", literal))
+		}
+		return v
+	}
+	if base != 10 || !strings.ContainsAny(digits, ".eE") {
+		v, err := strconv.ParseInt(digits, base, 64)
+		if err != nil {
+			errors.Error(token.Number, fmt.Sprintf("Integer literal %s overflows int, use the suffix n for a bigint.", literal))
+		}
+		return &valuer.Int{Value: v}
+	}
+	v, err := strconv.ParseFloat(digits, 64)
+	if err != nil {
+		errors.Error(token.Number, fmt.Sprintf("Number literal %s is out of range.", literal))
+	}
+	return &valuer.Number{Value: v}
+}
+
+func (t *thread) evalBinaryExpr(expr *ast.BinaryExpr) valuer.Valuer {
+	left := t.Eval(expr.Left)
+	right := t.Eval(expr.Right)
+	if _, ok := operatorMethods[expr.Operator]; ok && expr.Operator != token.EqualEqual {
+		if v, ok := t.overloadedOperator(expr.Operator, left, right); ok {
+			return v
+		}
+	}
 
 	switch op := expr.Operator; op {
 	case token.EqualEqual:
-		t := isEqual(left, right)
-		return toBooleanValuer(t)
+		return toBooleanValuer(t.isEqual(left, right))
 	case token.BangEqual:
-		t := !isEqual(left, right)
-		return toBooleanValuer(t)
-	case token.Greater:
-		a, b := checkNumberOperands(op, left, right)
-		t := a > b
-		return toBooleanValuer(t)
-	case token.GreaterEqual:
-		a, b := checkNumberOperands(op, left, right)
-		t := a >= b
+		return toBooleanValuer(!t.isEqual(left, right))
+	case token.EqualEqualEqual:
+		return toBooleanValuer(t.strictEqual(left, right))
+	case token.BangEqualEqual:
+		return toBooleanValuer(!t.strictEqual(left, right))
+	case token.Greater, token.GreaterEqual, token.Less, token.LessEqual:
+		t := compareNumbers(op, left, right)
 		return toBooleanValuer(t)
-	case token.Less:
-		a, b := checkNumberOperands(op, left, right)
-		t := a < b
-		return toBooleanValuer(t)
-	case token.LessEqual:
-		a, b := checkNumberOperands(op, left, right)
-		t := a <= b
-		return toBooleanValuer(t)
-	case token.Minus:
-		a, b := checkNumberOperands(op, left, right)
-		v := a - b
-		return &valuer.Number{Value: v}
+	case token.Minus, token.Star, token.Slash:
+		return arithmetic(op, left, right)
 	case token.Plus:
 		return doPlusOperation(left, right)
-	case token.Slash:
-		a, b := checkNumberOperands(op, left, right)
-		if b == float64(0) {
-			errors.Error(op, "Divisor can't be 0.")
-		}
-		v := a / b
-		return &valuer.Number{Value: v}
-	case token.Star:
-		a, b := checkNumberOperands(op, left, right)
-		v := a * b
-		return &valuer.Number{Value: v}
+	case token.Is:
+		return toBooleanValuer(isInstanceOf(left, right))
 	default:
 		panic("unhandled default case")
 	}
 }
 
-func evalUnaryExpr(expr *ast.UnaryExpr) valuer.Valuer {
-	right := Eval(expr.Right)
+func (t *thread) evalUnaryExpr(expr *ast.UnaryExpr) valuer.Valuer {
+	right := t.Eval(expr.Right)
 	switch op := expr.Operator; op {
 	case token.Bang:
 		t := !isTruthy(right)
 		return toBooleanValuer(t)
 	case token.Minus:
-		v := checkNumberOperand(op, right)
-		return &valuer.Number{Value: -v}
+		if method, ok := specialMethod(right, "__neg__"); ok {
+			return t.callFunction(method, nil, nil)
+		}
+		return negate(op, right)
 	default:
 		panic("unhandled default case")
 	}
 }
 
-func evalVariableExpr(expr *ast.VariableExpr) valuer.Valuer {
+func (t *thread) evalVariableExpr(expr *ast.VariableExpr) valuer.Valuer {
+	var v valuer.Valuer
+	var ok bool
 	if expr.Distance >= 0 {
-		if v, ok := env.GetAt(expr.Distance, expr.Name); ok {
-			return v
-		}
+		v, ok = t.env.GetAt(expr.Distance, expr.Name)
 	} else {
-		if v, ok := globals.Get(expr.Name); ok {
-			return v
-		}
+		v, ok = globals.Get(expr.Name)
+	}
+	if !ok {
+		errors.Error(token.Identifier, fmt.Sprintf("Undefined variable %s.", expr.Name))
 	}
+	if v == hole {
+		errors.Error(token.Identifier, fmt.Sprintf("Cannot access %q before initialization.", expr.Name))
+	}
+	return v
+}
 
-	errors.Error(token.Identifier, fmt.Sprintf("Undefined variable %s.", expr.Name))
-	return nil
+func (t *thread) evalAssignExpr(expr *ast.AssignExpr) valuer.Valuer {
+	v := t.Eval(expr.Value)
+	t.assignVariable(expr.Left, v)
+	return v
 }
 
-func evalAssignExpr(expr *ast.AssignExpr) valuer.Valuer {
-	v := Eval(expr.Value)
-	name, distance := expr.Left.Name, expr.Left.Distance
+func (t *thread) assignVariable(expr *ast.VariableExpr, v valuer.Valuer) {
+	name, distance := expr.Name, expr.Distance
+	var old valuer.Valuer
 	if distance >= 0 {
-		if ok := env.AssignAt(distance, name, v); ok {
-			return v
+		old, _ = t.env.GetAt(distance, name)
+	} else {
+		old, _ = globals.Get(name)
+	}
+	if old == hole {
+		errors.Error(token.Equal, fmt.Sprintf("Cannot access %q before initialization.", name))
+	}
+	if distance >= 0 {
+		if ok := t.env.AssignAt(distance, name, v); ok {
+			return
 		}
 	} else {
 		if ok := globals.Assign(name, v); ok {
-			return v
+			return
 		}
 	}
-	errors.Error(token.Equal, fmt.Sprintf("Undefined variable %s.", expr.Left))
-	return nil
+	errors.Error(token.Equal, fmt.Sprintf("Undefined variable %s.", expr))
 }
 
-func evalLogicalExpr(expr *ast.LogicalExpr) valuer.Valuer {
-	left := Eval(expr.Left)
+func (t *thread) evalLogicalExpr(expr *ast.LogicalExpr) valuer.Valuer {
+	left := t.Eval(expr.Left)
 	switch expr.Operator {
 	default:
 		panic(fmt.Sprintf("unknown operator %s", expr.Operator))
@@ -351,57 +560,143 @@ func evalLogicalExpr(expr *ast.LogicalExpr) valuer.Valuer {
 			return left
 		}
 	}
-	return Eval(expr.Right)
+	return t.Eval(expr.Right)
 }
 
-func evalCallExpr(expr *ast.CallExpr) valuer.Valuer {
-	callee := Eval(expr.Callee)
-	callableValue, ok := callee.(valuer.Callable)
-	if !ok {
+func (t *thread) evalCallExpr(expr *ast.CallExpr) valuer.Valuer {
+	callee := t.Eval(expr.Callee)
+	args, named := t.evalArguments(expr.Arguments)
+	return t.call(callee, args, named)
+}
+
+// evalArguments evaluates the arguments of a call, spread arguments are expanded
+// and keyword arguments are collected into named.
+func (t *thread) evalArguments(arguments []ast.Expr) (args []valuer.Valuer, named map[string]valuer.Valuer) {
+	args = make([]valuer.Valuer, 0, len(arguments))
+	for _, arg := range arguments {
+		switch a := arg.(type) {
+		case *ast.SpreadExpr:
+			array, ok := t.Eval(a.Expression).(*valuer.Array)
+			if !ok {
+				errors.Error(token.Ellipsis, "Only arrays can be spread.")
+			}
+			args = append(args, array.Snapshot()...)
+		case *ast.NamedArgExpr:
+			if named == nil {
+				named = make(map[string]valuer.Valuer)
+			}
+			named[a.Name] = t.Eval(a.Value)
+		default:
+			args = append(args, t.Eval(arg))
+		}
+	}
+	return args, named
+}
+
+// call calls callee with the evaluated arguments.
+func (t *thread) call(callee valuer.Valuer, args []valuer.Valuer, named map[string]valuer.Valuer) valuer.Valuer {
+	switch n := callee.(type) {
+	case *valuer.Function:
+		return t.callFunction(n, args, named)
+	case *valuer.ClassValue:
+		return t.constructInstance(n, args, named)
+	case *valuer.Builtin:
+		return t.callBuiltin(n, args, named)
+	case *valuer.Instance:
+		if method, ok := specialMethod(n, "__call__"); ok {
+			return t.callFunction(method, args, named)
+		}
 		errors.Error(token.LeftParen, "Can only call functions and classes.")
 		return nil
-	}
-	if l, l1 := callableValue.Arity(), len(expr.Arguments); l != l1 {
-		errors.Error(token.LeftParen, fmt.Sprintf("Expected %d arguments but got %d", l, l1))
+	default:
+		errors.Error(token.LeftParen, "Can only call functions and classes.")
 		return nil
 	}
+}
 
-	switch n := callee.(type) {
+// bindArguments matches the arguments to the params of function, the result
+// holds the value of each param and nil for a param taking its default value.
+func bindArguments(function *valuer.Function, args []valuer.Valuer, named map[string]valuer.Valuer) []valuer.Valuer {
+	min, max := function.Arity()
+	if len(args) > max && max >= 0 || len(args) < min && len(named) == 0 {
+		errors.Error(token.LeftParen, arityMessage(min, max, len(args)))
+	}
+
+	values := make([]valuer.Valuer, len(function.Params))
+	for i, param := range function.Params {
+		if param.Rest {
+			rest := make([]valuer.Valuer, 0)
+			if i < len(args) {
+				rest = append(rest, args[i:]...)
+			}
+			values[i] = &valuer.Array{Elements: rest}
+		} else if i < len(args) {
+			values[i] = args[i]
+		}
+	}
+	for name, v := range named {
+		i := 0
+		for i < len(function.Params) && (function.Params[i].Name != name || function.Params[i].Rest) {
+			i++
+		}
+		if i == len(function.Params) {
+			errors.Error(token.LeftParen, fmt.Sprintf("%s got an unexpected keyword argument %q.", function, name))
+		}
+		if values[i] != nil {
+			errors.Error(token.LeftParen, fmt.Sprintf("%s got multiple values for argument %q.", function, name))
+		}
+		values[i] = v
+	}
+	for i, param := range function.Params {
+		if values[i] == nil && param.Default == nil {
+			errors.Error(token.LeftParen, fmt.Sprintf("%s missing argument %q.", function, param))
+		}
+	}
+	return values
+}
+
+func arityMessage(min, max, got int) string {
+	switch {
+	case min == max:
+		return fmt.Sprintf("Expected %d arguments but got %d", min, got)
+	case max < 0:
+		return fmt.Sprintf("Expected at least %d arguments but got %d", min, got)
 	default:
-		panic("invaid type")
-	case *valuer.Function:
-		return callFunction(n, expr.Arguments)
-	case *valuer.ClassValue:
-		return constructInstance(n, expr.Arguments)
+		return fmt.Sprintf("Expected %d to %d arguments but got %d", min, max, got)
 	}
 }
 
-func constructInstance(c *valuer.ClassValue, arguments []ast.Expr) *valuer.Instance {
+func (t *thread) constructInstance(c *valuer.ClassValue, args []valuer.Valuer, named map[string]valuer.Valuer) *valuer.Instance {
 	instance := &valuer.Instance{Klass: c}
+	// the construction takes a frame like a call, so that a class constructing
+	// itself in a field initializer overflows the call stack.
+	t.pushFrame(&valuer.Function{Name: c.Name})
+	defer t.popFrame()
+	if len(c.Fields) > 0 {
+		environment := valuer.NewEnclosing(c.Closure)
+		environment.Define("this", instance)
+		for _, field := range c.Fields {
+			var v valuer.Valuer = Nil
+			if field.Initializer != nil {
+				v = t.evalWith(field.Initializer, environment)
+			}
+			instance.Set(field.Name, v)
+		}
+	}
 	initializer := c.FindMethod("init")
 	if initializer != nil {
-		callFunction(initializer.Bind(instance), arguments)
+		t.callFunction(initializer.Bind(instance), args, named)
+	} else if len(args) > 0 || len(named) > 0 {
+		errors.Error(token.LeftParen, arityMessage(0, 0, len(args)+len(named)))
 	}
 	return instance
 }
 
-func callNativeFunc(function *valuer.Function, arguments []ast.Expr) valuer.Valuer {
-	var values = make([]reflect.Value, 0, len(arguments))
-	for _, v := range arguments {
-		switch v.(type) {
-		case *ast.Literal:
-			if v.(*ast.Literal).Token == token.String {
-				values = append(values, reflect.ValueOf(v.(*ast.Literal).Value))
-				continue
-			} else if v.(*ast.Literal).Token == token.Number {
-				// 暂不支持浮点类型
-				val, err := strconv.ParseInt(v.(*ast.Literal).Value, 10, 32)
-				if err != nil {
-					errors.Error(token.Function, "Invalid number.")
-				}
-				values = append(values, reflect.ValueOf(val))
-			}
-		}
+func callNativeFunc(function *valuer.Function, args []valuer.Valuer) valuer.Valuer {
+	typ := function.NativeFunc.Type()
+	var values = make([]reflect.Value, 0, len(args))
+	for i, arg := range args {
+		values = append(values, toNativeValue(function, arg, typ.In(i)))
 	}
 	result := function.NativeFunc.Call(values)
 	if len(result) == 0 {
@@ -412,10 +707,8 @@ func callNativeFunc(function *valuer.Function, arguments []ast.Expr) valuer.Valu
 		switch result[0].Kind() {
 		case reflect.Bool:
 			return &valuer.Boolean{Value: result[0].Bool()}
-		case reflect.Int:
-			return &valuer.Number{Value: float64(result[0].Int())}
-		case reflect.Int64:
-			return &valuer.Number{Value: float64(result[0].Int())}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return &valuer.Int{Value: result[0].Int()}
 		case reflect.Float64:
 			return &valuer.Number{Value: result[0].Float()}
 		case reflect.String:
@@ -433,16 +726,79 @@ func callNativeFunc(function *valuer.Function, arguments []ast.Expr) valuer.Valu
 	return Nil
 }
 
-func callFunction(function *valuer.Function, arguments []ast.Expr) valuer.Valuer {
+// toNativeValue converts arg to the type of the native function param.
+func toNativeValue(function *valuer.Function, arg valuer.Valuer, typ reflect.Type) reflect.Value {
+	switch typ.Kind() {
+	case reflect.String:
+		if s, ok := arg.(*valuer.String); ok {
+			return reflect.ValueOf(s.Value)
+		}
+	case reflect.Bool:
+		if b, ok := arg.(*valuer.Boolean); ok {
+			return reflect.ValueOf(b.Value)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch n := arg.(type) {
+		case *valuer.Int:
+			if v := reflect.ValueOf(n.Value).Convert(typ); v.Int() == n.Value {
+				return v
+			}
+			errors.Error(token.Function, fmt.Sprintf("%s argument %d overflows %s.", function, n.Value, typ))
+		case *valuer.Number:
+			if n.Value == math.Trunc(n.Value) {
+				return reflect.ValueOf(int64(n.Value)).Convert(typ)
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		if v, ok := toFloat(arg); ok {
+			return reflect.ValueOf(v).Convert(typ)
+		}
+	}
+	errors.Error(token.Function, fmt.Sprintf("%s expects %s argument but got %s.", function, typ, arg.Type()))
+	return reflect.Value{}
+}
+
+// callFunction calls function in a new frame, a tail call returned by the
+// function replaces it in the same frame when the callee is a function too.
+func (t *thread) callFunction(function *valuer.Function, args []valuer.Valuer, named map[string]valuer.Valuer) valuer.Valuer {
+	t.pushFrame(function)
+	defer t.popFrame()
+	for {
+		v := t.runFunction(function, args, named)
+		call, ok := v.(*tailCall)
+		if !ok {
+			return v
+		}
+		function, args, named = call.callee, call.args, call.named
+		t.frames[len(t.frames)-1].function = function
+	}
+}
+
+func (t *thread) runFunction(function *valuer.Function, args []valuer.Valuer, named map[string]valuer.Valuer) valuer.Valuer {
+	values := bindArguments(function, args, named)
 	if function.NativeFunc.IsValid() { // 是否是内置函数
-		return callNativeFunc(function, arguments)
+		return callNativeFunc(function, values)
 	}
-	environment := function.Closure
-	environment = valuer.NewEnclosing(function.Closure)
+	environment := valuer.NewEnclosing(function.Closure)
 	for i, param := range function.Params {
-		environment.Define(param.Name, Eval(arguments[i]))
+		v := values[i]
+		if v == nil {
+			// 默认值在函数作用域内求值，可以引用之前的参数
+			v = t.evalWith(param.Default, environment)
+		}
+		if param.Pattern != nil {
+			t.bindPattern(param.Pattern, v, environment.Define)
+		} else {
+			environment.Define(param.Name, v)
+		}
 	}
-	v := executeBlock(function.Body, environment)
+	if function.IsAsync {
+		return runAsync(function, environment)
+	}
+	if function.IsGenerator {
+		return newGenerator(function, environment)
+	}
+	v := t.executeBlock(function.Body, environment)
 	if function.IsInitializer {
 		// lookup this in function.Closure
 		if v, ok := function.Closure.GetAt(0, "this"); ok {
@@ -457,93 +813,170 @@ func callFunction(function *valuer.Function, arguments []ast.Expr) valuer.Valuer
 	return v
 }
 
-func evalGetExpr(expr *ast.GetExpr) valuer.Valuer {
-	object := Eval(expr.Object)
+func (t *thread) evalGetExpr(expr *ast.GetExpr) valuer.Valuer {
+	return t.getProperty(t.Eval(expr.Object), expr.Name)
+}
 
+func (t *thread) getProperty(object valuer.Valuer, name string) valuer.Valuer {
+	t.checkPrivate(object, name)
 	switch object.(type) {
 	case *valuer.Instance:
 		instance, _ := object.(*valuer.Instance)
-		if v, ok := instance.Get(expr.Name); ok {
+		if v, ok := t.instanceProperty(instance, name); ok {
 			return v
 		}
-		errors.Error(token.Identifier, fmt.Sprintf("Undefined propterty %s.", expr.Name))
+		errors.Error(token.Identifier, fmt.Sprintf("Undefined propterty %s.", name))
+	case *valuer.ClassValue:
+		class, _ := object.(*valuer.ClassValue)
+		if v, ok := class.GetStatic(name); ok {
+			return v
+		}
+		errors.Error(token.Identifier, fmt.Sprintf("Undefined propterty %s.", name))
 	case *valuer.Array: // 为数组添加length属性
 		array, _ := object.(*valuer.Array)
-		switch expr.Name {
+		switch name {
 		case "length":
-			return &valuer.Number{Value: float64(len(array.Elements))}
+			return &valuer.Int{Value: int64(array.Len())}
 		default:
-			errors.Error(token.Identifier, fmt.Sprintf("Undefined propterty %s.", expr.Name))
+			errors.Error(token.Identifier, fmt.Sprintf("Undefined propterty %s.", name))
 		}
+	case *valuer.Generator:
+		return generatorProperty(object.(*valuer.Generator), name)
+	case *valuer.Task:
+		return taskProperty(object.(*valuer.Task), name)
+	case *valuer.Channel:
+		return channelProperty(object.(*valuer.Channel), name)
+	case *valuer.Promise:
+		return promiseProperty(object.(*valuer.Promise), name)
+	case *valuer.Enum:
+		return enumProperty(object.(*valuer.Enum), name)
+	case *valuer.EnumValue:
+		return enumValueProperty(object.(*valuer.EnumValue), name)
+	case *valuer.Map:
+		return t.mapProperty(object.(*valuer.Map), name)
 	default:
 		errors.Error(token.Identifier, "Only instances or array have properties.")
 	}
 	return nil
 }
 
-func evalSetExpr(expr *ast.SetExpr) valuer.Valuer {
-	object := Eval(expr.Object)
-	instance, ok := object.(*valuer.Instance)
-	if !ok {
+func (t *thread) evalSetExpr(expr *ast.SetExpr) valuer.Valuer {
+	object := t.Eval(expr.Object)
+	v := t.Eval(expr.Value)
+	t.setProperty(object, expr.Name, v)
+	return v
+}
+
+func (t *thread) setProperty(object valuer.Valuer, name string, v valuer.Valuer) {
+	t.checkPrivate(object, name)
+	switch o := object.(type) {
+	case *valuer.Instance:
+		if setter := o.Klass.FindSetter(name); setter != nil {
+			t.callFunction(setter.Bind(o), []valuer.Valuer{v}, nil)
+			return
+		}
+		if o.Klass.FindGetter(name) != nil {
+			errors.Error(token.Identifier, fmt.Sprintf("Cannot set property %s which has only a getter.", name))
+		}
+		o.Set(name, v)
+	case *valuer.ClassValue:
+		o.SetStatic(name, v)
+	default:
 		errors.Error(token.Identifier, "Only instances have properties.")
-		return nil
 	}
-	v := Eval(expr.Value)
-	instance.Set(expr.Name, v)
-	return v
 }
 
-func evalThisExpr(expr *ast.ThisExpr) valuer.Valuer {
-	if v, ok := env.Get("this"); ok {
+// checkPrivate raises an error unless the private member name is accessed
+// through this of a class declaring it.
+func (t *thread) checkPrivate(object valuer.Valuer, name string) {
+	if !strings.HasPrefix(name, "#") {
+		return
+	}
+	this, ok := t.env.Get("this")
+	instance, isInstance := object.(*valuer.Instance)
+	if !ok || this != object || !isInstance {
+		errors.Error(token.PrivateName, fmt.Sprintf("Private member %s can only be accessed through this.", name))
+	}
+	if !instance.Klass.Declares(name) {
+		errors.Error(token.PrivateName, fmt.Sprintf("Private member %s is not declared in class %s.", name, instance.Klass.Name))
+	}
+}
+
+// instanceProperty returns the value of a getter, a field or a bound method of instance.
+func (t *thread) instanceProperty(instance *valuer.Instance, name string) (valuer.Valuer, bool) {
+	if getter := instance.Klass.FindGetter(name); getter != nil {
+		return t.callFunction(getter.Bind(instance), nil, nil), true
+	}
+	return instance.Get(name)
+}
+
+func (t *thread) evalThisExpr(expr *ast.ThisExpr) valuer.Valuer {
+	if v, ok := t.env.Get("this"); ok {
 		return v
 	}
 	errors.Error(token.This, "Cannot use 'this' outside of a class.")
 	return nil
 }
 
-func evalExprStmt(stmt *ast.ExprStmt) valuer.Valuer {
-	return Eval(stmt.Expression)
+func (t *thread) evalExprStmt(stmt *ast.ExprStmt) valuer.Valuer {
+	return t.Eval(stmt.Expression)
 }
 
-func evalVarStmt(stmt *ast.VarStmt) {
+func (t *thread) evalVarStmt(stmt *ast.VarStmt) {
 	name := stmt.Name.Name
 	var v valuer.Valuer
 	if stmt.Initializer != nil {
-		v = Eval(stmt.Initializer)
+		v = t.Eval(stmt.Initializer)
 	} else {
 		v = Nil
 	}
-	env.Define(name, v)
+	t.env.Define(name, v)
 }
 
-func evalLetStmt(stmt *ast.LetStmt) {
+func (t *thread) evalLetStmt(stmt *ast.LetStmt) {
 	name := stmt.Name.Name
 	var v valuer.Valuer
 	if stmt.Initializer != nil {
-		v = Eval(stmt.Initializer)
+		v = t.Eval(stmt.Initializer)
 	} else {
 		v = Nil
 	}
-	env.Define(name, v)
+	t.env.Define(name, v)
 }
 
-func evalPrintStmt(stmt *ast.PrintStmt) {
-	v := Eval(stmt.Expression)
-	fmt.Println(v)
+func (t *thread) evalConstStmt(stmt *ast.ConstStmt) {
+	t.env.Define(stmt.Name.Name, t.Eval(stmt.Initializer))
 }
 
-func evalBlockStmt(block *ast.BlockStmt) valuer.Valuer {
-	return executeBlock(block.Statements, valuer.NewEnclosing(env))
+func (t *thread) evalPrintStmt(stmt *ast.PrintStmt) {
+	// the string is made before printing so that an error raised by toString
+	// is not swallowed by fmt.
+	fmt.Println(t.display(t.Eval(stmt.Expression)))
 }
 
-func executeBlock(statements []ast.Stmt, environment *valuer.Environment) valuer.Valuer {
-	previous := env
-	env = environment
+// evalWith evaluates node in environment.
+func (t *thread) evalWith(node ast.Node, environment *valuer.Environment) valuer.Valuer {
+	previous := t.env
+	t.env = environment
 	defer func() {
-		env = previous
+		t.env = previous
 	}()
+	return t.Eval(node)
+}
+
+func (t *thread) evalBlockStmt(block *ast.BlockStmt) valuer.Valuer {
+	return t.executeBlock(block.Statements, valuer.NewEnclosing(t.env))
+}
+
+func (t *thread) executeBlock(statements []ast.Stmt, environment *valuer.Environment) valuer.Valuer {
+	previous := t.env
+	t.env = environment
+	defer func() {
+		t.env = previous
+	}()
+	hoistDeclarations(statements, environment)
 	for _, stmt := range statements {
-		result := Eval(stmt)
+		result := t.Eval(stmt)
 		if result != nil {
 			if rt := result.Type(); rt == valuer.ReturnType {
 				return result
@@ -553,19 +986,19 @@ func executeBlock(statements []ast.Stmt, environment *valuer.Environment) valuer
 	return Nil
 }
 
-func evalIfStmt(stmt *ast.IfStmt) valuer.Valuer {
-	condition := Eval(stmt.Condition)
+func (t *thread) evalIfStmt(stmt *ast.IfStmt) valuer.Valuer {
+	condition := t.Eval(stmt.Condition)
 	if isTruthy(condition) {
-		return Eval(stmt.ThenBranch)
+		return t.Eval(stmt.ThenBranch)
 	} else if stmt.ElseBranch != nil {
-		return Eval(stmt.ElseBranch)
+		return t.Eval(stmt.ElseBranch)
 	}
 	return Nil
 }
 
-func evalWhileStmt(stmt *ast.WhileStmt) valuer.Valuer {
-	for isTruthy(Eval(stmt.Condition)) {
-		result := Eval(stmt.Body)
+func (t *thread) evalWhileStmt(stmt *ast.WhileStmt) valuer.Valuer {
+	for isTruthy(t.Eval(stmt.Condition)) {
+		result := t.Eval(stmt.Body)
 		if result != nil {
 			if rt := result.Type(); rt == valuer.ReturnType {
 				return result
@@ -575,20 +1008,33 @@ func evalWhileStmt(stmt *ast.WhileStmt) valuer.Valuer {
 	return Nil
 }
 
-func evalFunctionStmt(stmt *ast.FunctionStmt) {
+func (t *thread) evalFunctionStmt(stmt *ast.FunctionStmt) {
 	fn := &valuer.Function{
-		Name:    stmt.Name,
-		Params:  stmt.Params,
-		Body:    stmt.Body,
-		Closure: env,
+		Name:        stmt.Name,
+		Params:      stmt.Params,
+		Body:        stmt.Body,
+		Closure:     t.env,
+		IsGenerator: stmt.IsGenerator,
+		IsAsync:     stmt.IsAsync,
 	}
-	env.Define(stmt.Name, fn)
+	t.env.Define(stmt.Name, fn)
 }
 
-func evalReturnStmt(stmt *ast.ReturnStmt) valuer.Valuer {
+func (t *thread) evalReturnStmt(stmt *ast.ReturnStmt) valuer.Valuer {
 	var v valuer.Valuer = Nil
-	if stmt.Value != nil {
-		v = Eval(stmt.Value)
+	if call, ok := stmt.Value.(*ast.CallExpr); ok && t.canTailCall() {
+		callee := t.Eval(call.Callee)
+		args, named := t.evalArguments(call.Arguments)
+		if function, ok := callee.(*valuer.Function); ok {
+			// the call is made by callFunction after this frame is left.
+			v = &tailCall{callee: function, args: args, named: named}
+		} else {
+			// built-ins and classes are called in place, on the environment
+			// and the frame of the caller.
+			v = t.call(callee, args, named)
+		}
+	} else if stmt.Value != nil {
+		v = t.Eval(stmt.Value)
 	}
 	return &valuer.ReturnValue{
 		Value: v,
@@ -604,91 +1050,91 @@ func evalImportStmt(stmt *ast.ImportStmt) {
 	globals.Define(stmt.Name, instance)
 }
 
-func evalClassStmt(stmt *ast.ClassStmt) {
-	methods := make(map[string]*valuer.Function, len(stmt.Methods))
-	for _, method := range stmt.Methods {
-		fn := &valuer.Function{
-			Name:          method.Name,
-			Params:        method.Params,
-			Body:          method.Body,
-			Closure:       env,
-			IsInitializer: method.IsInitializer,
-		}
-		methods[method.Name] = fn
-	}
+func (t *thread) evalClassStmt(stmt *ast.ClassStmt) {
 	cl := &valuer.ClassValue{
 		Name:    stmt.Name,
-		Mehtods: methods,
+		Mehtods: t.classMethods(stmt.Methods),
+		Getters: t.classMethods(stmt.Getters),
+		Setters: t.classMethods(stmt.Setters),
+		Fields:  stmt.Fields,
+		Closure: t.env,
 	}
-	env.Define(stmt.Name, cl)
-}
+	t.mixTraits(cl, stmt)
+	t.env.Define(stmt.Name, cl)
 
-func checkNumberOperand(operator token.Token, right valuer.Valuer) float64 {
-	a, ok := right.(*valuer.Number)
-	if !ok {
-		errors.Error(operator, "Operand must be a number.")
+	// static members see the class as this, static fields are initialized in order
+	// after the class is defined so that they can refer to it.
+	for name, method := range t.classMethods(stmt.StaticMethods) {
+		cl.SetStatic(name, method.Bind(cl))
+	}
+	environment := valuer.NewEnclosing(t.env)
+	environment.Define("this", cl)
+	for _, field := range stmt.StaticFields {
+		var v valuer.Valuer = Nil
+		if field.Initializer != nil {
+			v = t.evalWith(field.Initializer, environment)
+		}
+		cl.SetStatic(field.Name, v)
 	}
-	return a.Value
 }
 
-func checkNumberOperands(operator token.Token, left, right valuer.Valuer) (float64, float64) {
-	a, ok := left.(*valuer.Number)
-	b, ok1 := right.(*valuer.Number)
-	if !(ok && ok1) {
-		errors.Error(operator, "Operands must be numbers.")
+func (t *thread) classMethods(stmts []*ast.FunctionStmt) map[string]*valuer.Function {
+	methods := make(map[string]*valuer.Function, len(stmts))
+	for _, method := range stmts {
+		methods[method.Name] = &valuer.Function{
+			Name:          method.Name,
+			Params:        method.Params,
+			Body:          method.Body,
+			Closure:       t.env,
+			IsInitializer: method.IsInitializer,
+			IsGenerator:   method.IsGenerator,
+			IsAsync:       method.IsAsync,
+		}
 	}
-	return a.Value, b.Value
+	return methods
 }
 
 func doPlusOperation(left, right valuer.Valuer) valuer.Valuer {
-	switch l := left.(type) {
-	case *valuer.Number, *valuer.String:
-		switch r := right.(type) {
-		case *valuer.Number:
-			if n, ok := l.(*valuer.Number); ok {
-				return &valuer.Number{Value: n.Value + r.Value}
-			}
-			s, _ := l.(*valuer.String)
-			return &valuer.String{
-				Value: s.Value + r.String(),
-			}
-		case *valuer.String:
-			if n, ok := l.(*valuer.Number); ok {
-				return &valuer.String{
-					Value: n.String() + r.Value,
-				}
-			}
-			s, _ := l.(*valuer.String)
-			return &valuer.String{Value: s.Value + r.Value}
-		}
+	if isNumber(left) && isNumber(right) {
+		return arithmetic(token.Plus, left, right)
+	}
+	_, lok := left.(*valuer.String)
+	_, rok := right.(*valuer.String)
+	if (lok || isNumber(left)) && (rok || isNumber(right)) {
+		return &valuer.String{Value: left.String() + right.String()}
 	}
 
 	errors.Error(token.Plus, "Operands must be numbers or strings.")
 	return nil
 }
 
-func isEqual(a, b valuer.Valuer) bool {
-	_, ok := a.(*valuer.Boolean)
-	_, ok1 := b.(*valuer.Boolean)
+// isEqual implements ==, values of different types are never equal except
+// numbers, arrays and maps are equal only to themselves.
+func (t *thread) isEqual(a, b valuer.Valuer) bool {
+	_, ok := a.(*valuer.Instance)
+	_, ok1 := b.(*valuer.Instance)
 	if ok || ok1 {
-		return isTruthy(a) == isTruthy(b)
+		return t.instancesEqual(a, b)
 	}
 
+	if isNumber(a) && isNumber(b) {
+		return numbersEqual(a, b)
+	}
 	switch a1 := a.(type) {
-	case *valuer.Number:
-		if b1, ok := b.(*valuer.Number); ok {
-			return a1.Value == b1.Value
-		}
 	case *valuer.Nil:
-		if _, ok := b.(*valuer.Nil); ok {
-			return true
-		}
+		_, ok := b.(*valuer.Nil)
+		return ok
+	case *valuer.Boolean:
+		b1, ok := b.(*valuer.Boolean)
+		return ok && a1.Value == b1.Value
 	case *valuer.String:
-		if b1, ok := b.(*valuer.String); ok {
-			return a1.Value == b1.Value
-		}
+		b1, ok := b.(*valuer.String)
+		return ok && a1.Value == b1.Value
+	case *valuer.EnumValue:
+		b1, ok := b.(*valuer.EnumValue)
+		return ok && t.enumValuesEqual(a1, b1)
 	}
-	return false
+	return a == b
 }
 
 func isTruthy(value valuer.Valuer) bool {
@@ -700,6 +1146,12 @@ func isTruthy(value valuer.Valuer) bool {
 		return v.Value
 	case *valuer.Number:
 		return v.Value != float64(0)
+	case *valuer.Int:
+		return v.Value != 0
+	case *valuer.BigInt:
+		return v.Value.Sign() != 0
+	case *valuer.Decimal:
+		return v.Unscaled.Sign() != 0
 	case *valuer.Nil:
 		return false
 	case *valuer.String:
@@ -2,9 +2,13 @@ package interpreter
 
 import (
 	"io/ioutil"
+	"math"
 	"os"
+	"runtime"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"tiny-script/errors"
 	"tiny-script/parser"
@@ -69,13 +73,20 @@ func TestEvalBoolean(t *testing.T) {
 
 		{"nil == nil", true},
 		{"nil != nil", false},
-		{"nil == false", true},
+		{"nil == false", false},
 		{"nil == true", false},
 		{"0 == true", false},
 
-		{"1 == true", true},
+		{"1 == true", false},
 		{`"" == true`, false},
-		{`"x" == true`, true},
+		{`"x" == true`, false},
+		{"1 == 1.0", true},
+		{"1 === 1.0", false},
+		{"1 === 1", true},
+		{`"a" === "a"`, true},
+		{"nil !== false", true},
+		{"[1] == [1]", false},
+		{"[1] !== [1]", true},
 	}
 
 	for i, test := range tests {
@@ -258,12 +269,12 @@ func TestEvalClass(t *testing.T) {
 	b.fn();
 	b.x.fn();`
 	expected := []string{
-		"A instance", // print a;
-		"a.fn",       // a.fn();
-		"1",          // print b.x.y;
-		"2",          // print b.x.y1;
-		"b.fn",       // b.fn();
-		"a.fn",       // b.x.fn();
+		"A{}",  // print a;
+		"a.fn", // a.fn();
+		"1",    // print b.x.y;
+		"2",    // print b.x.y1;
+		"b.fn", // b.fn();
+		"a.fn", // b.x.fn();
 	}
 	testEvalPrintStmt(t, input, expected)
 }
@@ -292,6 +303,1536 @@ func TestEvalThisAndInit(t *testing.T) {
 	testEvalPrintStmt(t, input, expected)
 }
 
+func TestEvalIndexExpr(t *testing.T) {
+	input := `let grid = [[0, 0], [0, 0]];
+	let i = 0;
+	grid[i][i + 1] = 1;
+	grid[1][0] = grid[0][1] + 1;
+	print grid;
+	function f() {
+		return [10, 20, 30];
+	}
+	print f()[2];
+	class A {
+		init() {
+			this.items = ["x", "y"];
+		}
+	}
+	let a = A();
+	a.items[1] = "z";
+	print a.items[1];
+	print "hello"[1];
+	print grid[0][1] = 5;`
+	expected := []string{
+		"[[0, 1], [2, 0]]", // print grid;
+		"30",               // print f()[2];
+		"z",                // print a.items[1];
+		"e",                // print "hello"[1];
+		"5",                // print grid[0][1] = 5;
+	}
+	testEvalPrintStmt(t, input, expected)
+}
+
+func TestEvalSliceExpr(t *testing.T) {
+	input := `let a = [0, 1, 2, 3, 4, 5];
+	print a[-1];
+	print a[1:3];
+	print a[:2];
+	print a[4:];
+	print a[::2];
+	print a[::-1];
+	print a[-2:];
+	print a[5:1:-2];
+	print a[-100:100];
+	print a[3:1];
+	let s = "hello";
+	print s[-1];
+	print s[1:4];
+	print s[::-1];`
+	expected := []string{
+		"5",                  // print a[-1];
+		"[1, 2]",             // print a[1:3];
+		"[0, 1]",             // print a[:2];
+		"[4, 5]",             // print a[4:];
+		"[0, 2, 4]",          // print a[::2];
+		"[5, 4, 3, 2, 1, 0]", // print a[::-1];
+		"[4, 5]",             // print a[-2:];
+		"[5, 3]",             // print a[5:1:-2];
+		"[0, 1, 2, 3, 4, 5]", // print a[-100:100];
+		"[]",                 // print a[3:1];
+		"o",                  // print s[-1];
+		"ell",                // print s[1:4];
+		"olleh",              // print s[::-1];
+	}
+	testEvalPrintStmt(t, input, expected)
+}
+
+func TestEvalIndexError(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+	}{
+		{"[1, 2][2]", "Index 2 out of range for length 2."},
+		{"[1, 2][-3]", "Index -3 out of range for length 2."},
+		{"[1, 2][0.5]", "Index must be an integer."},
+		{"[1, 2][::0]", "Slice step cannot be zero."},
+		{`"ab"["a"]`, "Index must be an integer."},
+		{"nil[0]", "Only arrays and strings can be indexed."},
+	}
+	for i, test := range tests {
+		_, err := evalExprFromInput(test.input)
+		if err == nil {
+			t.Fatalf("test [%d] should fail.", i)
+		}
+		if err.Error() != test.msg {
+			t.Fatalf("test [%d] expected error is %q. got %q", i, test.msg, err.Error())
+		}
+	}
+}
+
+func TestEvalLetAndConst(t *testing.T) {
+	input := `const a = 1;
+	let b = 2;
+	var c = 3;
+	var c = 4;
+	{
+		let b = a + 10;
+		print b;
+	}
+	{
+		const a = 20;
+		print a;
+	}
+	print b;
+	function f() {
+		const x = "const";
+		let y = x;
+		y = y + "!";
+		return y;
+	}
+	print f();
+	for (let i = 0; i < 2; i = i + 1) {
+		let b = i;
+		print b;
+	}
+	print c;`
+	expected := []string{"11", "20", "2", "const!", "0", "1", "4"}
+	testEvalPrintStmt(t, input, expected)
+}
+
+func TestEvalLetAndConstError(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+	}{
+		{`const a = 1; a = 2;`, `Assignment to constant variable "a".`},
+		{`function f() { const a = 1; { a = 2; } }`, `Assignment to constant variable "a".`},
+		{`function h() { k = 2; } const k = 1; h(); print k;`, `Assignment to constant variable "k".`},
+		{`let a = 1; let a = 2;`, `variable name "a" has been already delcared in this scope.`},
+		{`var a = 1; let a = 2;`, `variable name "a" has been already delcared in this scope.`},
+		{`{ let a = 1; var a = 2; }`, `variable name "a" has been already delcared in this scope.`},
+		{`{ print a; let a = 1; }`, `Cannot access "a" before initialization.`},
+		{`let a = "outer";
+		{
+			function f() {
+				return a;
+			}
+			print f();
+			let a = "inner";
+		}`, `Cannot access "a" before initialization.`},
+		{`function f() { b = 1; } f(); let b = 2;`, `Cannot access "b" before initialization.`},
+	}
+	for _, test := range tests {
+		testEvalError(t, test.input, test.msg)
+	}
+}
+
+func TestEvalFunctionParams(t *testing.T) {
+	input := `function f(a, b = a * 10, ...rest) {
+		print [a, b, rest];
+	}
+	f(1);
+	f(1, 2);
+	f(1, 2, 3, 4);
+	f(b: 5, a: 6);
+	let args = [7, 8, 9];
+	f(...args);
+	f(0, ...args);
+	class Point {
+		init(x = 0, y = x) {
+			this.x = x;
+			this.y = y;
+		}
+		move(dx, dy = 0) {
+			return Point(this.x + dx, this.y + dy);
+		}
+	}
+	let p = Point(y: 2);
+	print p.x + "," + p.y;
+	p = p.move(1);
+	print p.x + "," + p.y;
+	p = Point(3).move(dy: 1, dx: 1);
+	print p.x + "," + p.y;`
+	expected := []string{
+		"[1, 10, []]",
+		"[1, 2, []]",
+		"[1, 2, [3, 4]]",
+		"[6, 5, []]",
+		"[7, 8, [9]]",
+		"[0, 7, [8, 9]]",
+		"0,2",
+		"1,2",
+		"4,4",
+	}
+	testEvalPrintStmt(t, input, expected)
+}
+
+func TestEvalFunctionParamsError(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+	}{
+		{"function f(a, b) {} f(1);", "Expected 2 arguments but got 1"},
+		{"function f(a, b = 1) {} f(1, 2, 3);", "Expected 1 to 2 arguments but got 3"},
+		{"function f(a, ...b) {} f();", "Expected at least 1 arguments but got 0"},
+		{"function f(a) {} f(b: 1);", `<fn f> got an unexpected keyword argument "b".`},
+		{"function f(a) {} f(1, a: 1);", `<fn f> got multiple values for argument "a".`},
+		{"function f(a, b) {} f(b: 1);", `<fn f> missing argument "a".`},
+		{"function f(...a) {} f(a: 1);", `<fn f> got an unexpected keyword argument "a".`},
+		{"function f(a) {} f(...1);", "Only arrays can be spread."},
+		{"class A {} A(1);", "Expected 0 arguments but got 1"},
+	}
+	for _, test := range tests {
+		testEvalError(t, test.input, test.msg)
+	}
+}
+
+func TestEvalNumberLiterals(t *testing.T) {
+	input := `print 0xFF;
+	print 0o755;
+	print 0b1010;
+	print 1_000_000;
+	print .5 + 0.25;
+	print 1_0.5e1;
+	print [0x10][0];`
+	expected := []string{"255", "493", "10", "1000000", "0.75", "105", "16"}
+	testEvalPrintStmt(t, input, expected)
+}
+
+func TestEvalInt(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected valuer.Valuer
+	}{
+		{"9007199254740993", &valuer.Int{Value: 9007199254740993}},
+		{"9007199254740993 + 1", &valuer.Int{Value: 9007199254740994}},
+		{"-9223372036854775807 - 1", &valuer.Int{Value: math.MinInt64}},
+		{"0x7FFF_FFFF_FFFF_FFFF", &valuer.Int{Value: math.MaxInt64}},
+		{"8 / 2", &valuer.Int{Value: 4}},
+		{"7 / 2", &valuer.Number{Value: 3.5}},
+		{"3 * 1.0", &valuer.Number{Value: 3}},
+		{"1 + 2.5", &valuer.Number{Value: 3.5}},
+		{"-(2 - 5)", &valuer.Int{Value: 3}},
+		{"int(3.9)", &valuer.Int{Value: 3}},
+		{"int(-3.9)", &valuer.Int{Value: -3}},
+		{`int(" 42 ")`, &valuer.Int{Value: 42}},
+		{"int(true)", &valuer.Int{Value: 1}},
+		{"float(3)", &valuer.Number{Value: 3}},
+		{`float("2.5")`, &valuer.Number{Value: 2.5}},
+		{"3 == 3.0", True},
+		{"2 < 2.5", True},
+		{"9007199254740993 > 9007199254740992", True},
+		{`"n=" + 5`, &valuer.String{Value: "n=5"}},
+	}
+	for i, test := range tests {
+		v, err := evalExprFromInput(test.input)
+		if err != nil {
+			t.Fatalf("test [%d] failed. error: %s", i, err.Error())
+		}
+		if v.Type() != test.expected.Type() || v.String() != test.expected.String() {
+			t.Errorf("test [%d] %s: expected %s %s. got %s %s", i, test.input, test.expected.Type(), test.expected, v.Type(), v)
+		}
+	}
+}
+
+func TestEvalIntError(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+	}{
+		{"print 9223372036854775807 + 1;", "Integer overflow."},
+		{"print -9223372036854775807 - 2;", "Integer overflow."},
+		{"print 4611686018427387904 * 2;", "Integer overflow."},
+		{"print -(-9223372036854775807 - 1);", "Integer overflow."},
+		{"print (-9223372036854775807 - 1) / -1;", "Integer overflow."},
+		{"print 9223372036854775808;", "Integer literal 9223372036854775808 overflows int, use the suffix n for a bigint."},
+		{"print 1 / 0;", "Divisor can't be 0."},
+		{`print int("x");`, "Cannot convert string x to int."},
+		{`print float(nil);`, "Cannot convert nil nil to float."},
+		{"print int(1e19);", "to int."},
+		{"print int(1, 2);", "Expected 1 arguments but got 2"},
+	}
+	for _, test := range tests {
+		testEvalError(t, test.input, test.msg)
+	}
+}
+
+func TestEvalBigIntAndDecimal(t *testing.T) {
+	input := `print 9223372036854775807n + 1;
+	print 2n * 9223372036854775807;
+	print 10n / 5;
+	print 10n / 4n;
+	print 12.30d + 1;
+	print 0.1d + 0.2d == 0.3d;
+	print 1.10d * 1.10d;
+	print 1d / 3;
+	print -12.5d < 1;
+	print 3n == 3.0;
+	print "total: " + 12.50d;
+	print int(12.9d);
+	print float(1.25d);
+	print bigint("123456789012345678901234567890") * 10;
+	print decimal("19.99") * 3;
+	print decimal(0.1);
+	decimalContext(2, "half_up");
+	print 10d / 3;
+	print 2.5d * 1.005d;
+	decimalContext(0, "floor");
+	print -7d / 2;`
+	expected := []string{
+		"9223372036854775808",
+		"18446744073709551614",
+		"2",
+		"2.5",
+		"13.30",
+		"true",
+		"1.2100",
+		"0.33333333333333333333",
+		"true",
+		"true",
+		"total: 12.50",
+		"12",
+		"1.25",
+		"1234567890123456789012345678900",
+		"59.97",
+		"0.1",
+		"3.33",
+		"2.51",
+		"-4",
+	}
+	testEvalPrintStmt(t, input, expected)
+}
+
+func TestEvalBigIntAndDecimalError(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+	}{
+		{"print 1.5d + 1.5;", "Cannot mix decimal and float, convert one of them explicitly."},
+		{"print 0.5 * 1n;", "Cannot mix float and bigint, convert one of them explicitly."},
+		{"print 1d / 0;", "Divisor can't be 0."},
+		{"print 1n / 0n;", "Divisor can't be 0."},
+		{"print int(9223372036854775808n);", "Cannot convert bigint 9223372036854775808 to int."},
+		{`print decimal("1.2.3");`, "Cannot convert string 1.2.3 to decimal."},
+		{"decimalContext(-1);", "Decimal precision must be an int between 0 and 1000, got -1."},
+		{`decimalContext(2, "nearest");`, "Unknown rounding mode nearest"},
+	}
+	for _, test := range tests {
+		testEvalError(t, test.input, test.msg)
+	}
+}
+
+func TestEvalGenerator(t *testing.T) {
+	input := `function count(n) {
+		let i = 0;
+		while (i < n) {
+			yield i;
+			i = i + 1;
+		}
+		return "end";
+	}
+	let g = count(2);
+	for (let i in [1, 2, 3, 4]) {
+		let r = g.next();
+		print [r.value, r.done];
+	}
+	for (let x in count(3)) print x;
+	function naturals() {
+		let i = 0;
+		while (true) {
+			yield i;
+			i = i + 1;
+		}
+	}
+	let [a, b, c] = naturals();
+	print [a, b, c];
+	function find() {
+		for (let x in naturals()) {
+			if (x > 5) return x;
+		}
+	}
+	print find();
+	function echo() {
+		let got = yield "ready";
+		while (true) {
+			got = yield "got " + got;
+		}
+	}
+	let e = echo();
+	print e.next().value;
+	print e.next(1).value;
+	e.close();
+	print e.next().done;
+	class Tree {
+		init(items) {
+			this.items = items;
+		}
+		each() {
+			for (let x in this.items) yield x * 10;
+		}
+	}
+	print [...Tree([1, 2]).each()];`
+	expected := []string{
+		"[0, false]",
+		"[1, false]",
+		`["end", true]`,
+		"[nil, true]",
+		"0",
+		"1",
+		"2",
+		"[0, 1, 2]",
+		"6",
+		"ready",
+		"got 1",
+		"true",
+		"[10, 20]",
+	}
+	testEvalPrintStmt(t, input, expected)
+}
+
+func TestEvalGeneratorError(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+	}{
+		{"yield 1;", "Cannot yield outside of a function."},
+		{"class A { init() { yield 1; } }", "Cannot yield from an initializer."},
+		{"function f() { yield 1; print x; } let g = f(); g.next(); g.next();", "Undefined variable x."},
+		{"function f() { yield g.next(); } let g = f(); g.next();", "Generator is already running."},
+		{"function f() { yield 1; } f().prev();", "Undefined propterty prev."},
+	}
+	for _, test := range tests {
+		testEvalError(t, test.input, test.msg)
+	}
+}
+
+func TestGeneratorNotLeak(t *testing.T) {
+	before := runtime.NumGoroutine()
+	input := `function naturals() {
+		let i = 0;
+		while (true) {
+			yield i;
+			i = i + 1;
+		}
+	}
+	function first(g) {
+		for (let x in g) return x;
+	}
+	for (let i in [1, 2, 3, 4, 5]) {
+		first(naturals());
+		let [a] = naturals();
+		let g = naturals();
+		g.next();
+		g.close();
+		naturals().next();
+	}
+	print "done";`
+	testEvalPrintStmt(t, input, []string{"done"})
+	// the generators abandoned without close are closed after collected by GC.
+	for i := 0; i < 50 && runtime.NumGoroutine() > before; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+		closeAbandoned()
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("goroutines of generators leaked, %d before and %d after.", before, n)
+	}
+}
+
+func TestGeneratorReleasedAfterInterpret(t *testing.T) {
+	before := runtime.NumGoroutine()
+	input := `function naturals() {
+		let i = 0;
+		while (true) {
+			yield i;
+			i = i + 1;
+		}
+	}
+	let n = 0;
+	while (n < 200) {
+		naturals().next();
+		n = n + 1;
+	}
+	print n;`
+	testEvalPrintStmt(t, input, []string{"200"})
+	// no generator is created afterwards, Interpret closes the abandoned ones.
+	for i := 0; i < 50 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("goroutines of generators leaked, %d before and %d after.", before, n)
+	}
+	if n := atomic.LoadInt64(&liveGenerators); n != 0 {
+		t.Errorf("expected no live generator after Interpret. got %d", n)
+	}
+}
+
+func TestEvalSpawn(t *testing.T) {
+	input := `function produce(ch, n) {
+		for (let i = 0; i < n; i = i + 1) ch.send(i);
+		ch.close();
+		return n * 10;
+	}
+	let ch = chan();
+	let task = spawn produce(ch, 3);
+	for (let v in ch) print v;
+	print task.wait();
+	print ch.recv();
+	let results = chan(10);
+	let counter = [0];
+	function square(x) {
+		results.send(x * x);
+		return x;
+	}
+	let tasks = [spawn square(1), spawn square(2), spawn square(3)];
+	let sum = 0;
+	for (let task in tasks) sum = sum + task.wait() + results.recv();
+	print sum;
+	let a = chan(1);
+	let b = chan(1);
+	b.send("b");
+	select {
+		case let v = a.recv() { print "a"; }
+		case let v = b.recv() { print v; }
+	}
+	select {
+		case a.recv() { print "a"; }
+		default { print "default"; }
+	}
+	select {
+		case a.send("sent") {}
+	}
+	print a.recv();
+	a.close();
+	select {
+		case let v = a.recv() { print v; }
+	}`
+	expected := []string{
+		"0",
+		"1",
+		"2",
+		"30",
+		"nil",
+		"20",
+		"b",
+		"default",
+		"sent",
+		"nil",
+	}
+	testEvalPrintStmt(t, input, expected)
+}
+
+func TestEvalSpawnSharedState(t *testing.T) {
+	input := `var total = 0;
+	let counts = [0, 0, 0, 0];
+	let lock = chan(1);
+	lock.send(nil);
+	function add(i) {
+		for (let n = 0; n < 100; n = n + 1) {
+			lock.recv();
+			total = total + 1;
+			counts[i] = counts[i] + 1;
+			lock.send(nil);
+		}
+	}
+	let tasks = [spawn add(0), spawn add(1), spawn add(2), spawn add(3)];
+	for (let task in tasks) task.wait();
+	print total;
+	print counts;`
+	testEvalPrintStmt(t, input, []string{"400", "[100, 100, 100, 100]"})
+}
+
+func TestEvalSpawnError(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+	}{
+		{"function f() { return nil + 1; } let task = spawn f(); task.wait();", "Operands must be numbers or strings."},
+		{"function f() { return nil + 1; } spawn f();", "Operands must be numbers or strings."},
+		{"spawn f();", "Undefined variable f."},
+		{"let ch = chan(); ch.close(); ch.send(1);", "Send on closed channel."},
+		{"let ch = chan(); ch.close(); ch.close();", "Close of closed channel."},
+		{"let ch = chan(-1);", "Channel capacity must not be negative."},
+		{"let x = 1; select { case x.recv() {} }", "Only channels can be selected."},
+		{"function f() {} (spawn f()).result;", "Undefined propterty result."},
+		{"let ch = chan(); ch.recv();", "Deadlock, all threads are blocked."},
+		{"let ch = chan(); ch.send(1);", "Deadlock, all threads are blocked."},
+		{"let ch = chan(); select { case ch.recv() {} }", "Deadlock, all threads are blocked."},
+		{"function f(ch) { ch.recv(); } let ch = chan(); let task = spawn f(ch); task.wait();", "Deadlock, all threads are blocked."},
+	}
+	for _, test := range tests {
+		testEvalError(t, test.input, test.msg)
+	}
+}
+
+// fakeClock advances its time when sleeping instead of blocking.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(d time.Duration) { c.now = c.now.Add(d) }
+
+func withFakeClock(t *testing.T) *fakeClock {
+	fake := &fakeClock{now: time.Unix(0, 0)}
+	SetClock(fake)
+	t.Cleanup(func() { SetClock(systemClock{}) })
+	return fake
+}
+
+func TestEvalTimers(t *testing.T) {
+	fake := withFakeClock(t)
+	input := `function log(msg) { print msg; }
+	setTimeout(log, 30, "timeout 30");
+	setTimeout(log, 10, "timeout 10");
+	setTimeout(log, 10, "timeout 10 again");
+	let n = 0;
+	var id = nil;
+	function tick() {
+		n = n + 1;
+		print "tick " + n;
+		if (n == 3) clearInterval(id);
+	}
+	id = setInterval(tick, 8);
+	clearTimeout(setTimeout(log, 1, "cancelled"));
+	print "sync";`
+	expected := []string{
+		"sync",
+		"tick 1",
+		"timeout 10",
+		"timeout 10 again",
+		"tick 2",
+		"tick 3",
+		"timeout 30",
+	}
+	testEvalPrintStmt(t, input, expected)
+	if elapsed := fake.now.Sub(time.Unix(0, 0)); elapsed != 30*time.Millisecond {
+		t.Errorf("the script should end after 30ms. got %s", elapsed)
+	}
+}
+
+func TestEvalAsync(t *testing.T) {
+	fake := withFakeClock(t)
+	input := `function log(msg) { print msg; }
+	async function double(x) {
+		await sleep(100);
+		return x * 2;
+	}
+	async function main() {
+		print "main start";
+		let a = await double(1);
+		let b = await double(a);
+		print "main got " + b;
+		return b;
+	}
+	main().then(log);
+	function rejectBad(resolve, reject) { reject("bad"); }
+	function recover(reason) {
+		print "caught " + reason;
+		return "recovered";
+	}
+	Promise(rejectBad).catch(recover).then(log);
+	function resolveLater(resolve, reject) { setTimeout(resolve, 50, "resolved"); }
+	Promise(resolveLater).then(log);
+	async function fail() {
+		return nil + 1;
+	}
+	async function tryFail() {
+		await fail();
+		print "unreachable";
+	}
+	tryFail().then(log, recover);
+	async function plain() { return await 1; }
+	print plain();
+	print "sync end";`
+	expected := []string{
+		"main start",
+		"<promise pending>",
+		"sync end",
+		"caught bad",
+		"recovered",
+		"caught Operands must be numbers or strings.",
+		"resolved",
+		"main got 4",
+		"4",
+	}
+	testEvalPrintStmt(t, input, expected)
+	if elapsed := fake.now.Sub(time.Unix(0, 0)); elapsed != 200*time.Millisecond {
+		t.Errorf("the script should end after 200ms. got %s", elapsed)
+	}
+}
+
+func TestEvalAsyncError(t *testing.T) {
+	withFakeClock(t)
+	tests := []struct {
+		input string
+		msg   string
+	}{
+		{"await 1;", "Cannot use await outside of an async function."},
+		{"async function f() { function g() { await 1; } }", "Cannot use await outside of an async function."},
+		{"async function f() { yield 1; }", "Cannot yield in an async function."},
+		{"class A { async init() {} }", "An initializer cannot be async."},
+		{"async function f() { return nil + 1; } f();", "Uncaught (in promise) Operands must be numbers or strings."},
+		{"function f(resolve, reject) { reject(\"bad\"); } Promise(f).then(f);", "Uncaught (in promise) bad"},
+		{"setTimeout(1, 10);", "Timer callback must be a function, got int."},
+		{"function f() { print nil + 1; } setTimeout(f, 10);", "Operands must be numbers or strings."},
+	}
+	for _, test := range tests {
+		testEvalError(t, test.input, test.msg)
+	}
+}
+
+func TestEvalMatch(t *testing.T) {
+	input := `class Point {
+		init(x, y) {
+			this.x = x;
+			this.y = y;
+		}
+	}
+	class Circle {
+		init(r) {
+			this.r = r;
+		}
+	}
+	function describe(v) {
+		match (v) {
+			0 => return "zero";
+			1 | 2 | 3 => return "small";
+			-5..0 => return "negative";
+			4..=10 => return "medium";
+			"hello" => return "greeting";
+			"a".."n" => return "early letter";
+			true => return "yes";
+			nil => return "nothing";
+			[] => return "empty";
+			[x] => return "one " + x;
+			[first, ...rest] if first > 100 => return "rest " + rest.length;
+			[_, second, ..._] => return "second " + second;
+			Point{x: 0, y} => return "on y axis at " + y;
+			Point{x, y} if x == y => return "diagonal " + x;
+			Circle{r} => return "circle " + r;
+			{x} => return "has x " + x;
+		}
+		return "other";
+	}
+	let values = [0, 2, -3, 7, "hello", "c", true, false, nil, [], [9], [200, 1, 2], [1, 2, 3],
+		Point(0, 4), Point(2, 2), Point(1, 2), Circle(5), "z", 11, Map([["x", 8]]), Map([["y", 1]])];
+	for (let v in values) print describe(v);
+	let x = "outer";
+	let name = match (3) { n if n > 5 => "big", n => "n is " + n, };
+	print name;
+	print x;`
+	expected := []string{
+		"zero",
+		"small",
+		"negative",
+		"medium",
+		"greeting",
+		"early letter",
+		"yes",
+		"other",
+		"nothing",
+		"empty",
+		"one 9",
+		"rest 2",
+		"second 2",
+		"on y axis at 4",
+		"diagonal 2",
+		"has x 1",
+		"circle 5",
+		"other",
+		"other",
+		"has x 8",
+		"other",
+		"n is 3",
+		"outer",
+	}
+	testEvalPrintStmt(t, input, expected)
+}
+
+func TestEvalMatchError(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+	}{
+		{"let v = match (1) { 2 => 2 };", "No match arm matches 1."},
+		{"match (1) { [a, a] => print a; }", "has been already delcared"},
+		{"match (1) { [a] | b => print 1; }", "Alternatives of a pattern must bind the same names."},
+		{"match (1) { x => {} } print x;", "Undefined variable x."},
+		{"let P = 1; class A {} match (A()) { P{} => print 1; }", "P is not a class."},
+	}
+	for _, test := range tests {
+		testEvalError(t, test.input, test.msg)
+	}
+}
+
+func TestEvalEnum(t *testing.T) {
+	input := `enum Color { Red, Green, Blue }
+	enum Status { Active = 10, Paused, Gone = "gone" }
+	enum Shape { Circle(r), Rect(w, h), Empty }
+	print Color.Red;
+	print Color.values();
+	print [Color.Blue.value, Status.Paused.value, Status.Gone.value, Color.Green.name];
+	print [Color.Red == Color.Red, Color.Red == Color.Green, Color.Red == 0];
+	print [Shape.Circle(2) == Shape.Circle(2), Shape.Circle(2) == Shape.Circle(3)];
+	let rect = Shape.Rect(2, 3);
+	print rect;
+	print [rect.w, rect.h];
+	function area(s) {
+		return match (s) {
+			Shape.Circle(r) => 3 * r * r,
+			Shape.Rect(w, h) if w == h => "square",
+			Shape.Rect(w, h) => w * h,
+			Shape.Empty => 0,
+		};
+	}
+	for (let s in [Shape.Circle(1), Shape.Rect(2, 2), rect, Shape.Empty]) print area(s);
+	for (let c in Color.values()) {
+		match (c) {
+			Color.Red => print "stop";
+			Color.Green | Color.Blue => print "go " + c.name;
+		}
+	}`
+	expected := []string{
+		"Color.Red",
+		"[Color.Red, Color.Green, Color.Blue]",
+		`[2, 11, "gone", "Green"]`,
+		"[true, false, false]",
+		"[true, false]",
+		"Shape.Rect(2, 3)",
+		"[2, 3]",
+		"3",
+		"square",
+		"6",
+		"0",
+		"stop",
+		"go Green",
+		"go Blue",
+	}
+	testEvalPrintStmt(t, input, expected)
+}
+
+func TestEvalEnumError(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+	}{
+		{"enum Color { Red } print Color.Purple;", "Enum Color has no variant Purple."},
+		{"enum Color { Red } Color = 1;", "Assignment to constant variable"},
+		{"enum Color { Red = 1, Green = 1 }", "Enum variants Red and Green have the same value 1."},
+		{"enum Color { Red = \"r\", Green }", "Enum variant Color.Green needs an explicit value."},
+		{"enum Shape { Circle(r) } Shape.Circle();", "Expected 1 arguments but got 0"},
+		{"enum Shape { Circle(r) } print Shape.Circle(1).d;", "Undefined propterty d."},
+		{"enum Shape { Circle(r) } match (1) { Shape.Circle(a, b) => {} }", "Shape.Circle has 1 fields, but the pattern has 2."},
+		{"let Shape = 1; match (1) { Shape.Circle => {} }", "Shape is not an enum."},
+	}
+	for _, test := range tests {
+		testEvalError(t, test.input, test.msg)
+	}
+}
+
+func TestEvalClassMembers(t *testing.T) {
+	input := `class Counter {
+		count = 0;
+		step = 1;
+		history = [];
+		static created = 0;
+		static zero = Counter();
+		static withStep(step) {
+			let c = Counter();
+			c.step = step;
+			return c;
+		}
+		init() {
+			Counter.created = Counter.created + 1;
+		}
+		get double() { return this.count * 2; }
+		get value() { return this.count; }
+		set value(v) { this.count = v * this.step; }
+		tick() { this.count = this.count + this.step; return this; }
+	}
+	let a = Counter();
+	let b = Counter.withStep(5);
+	a.tick().tick();
+	b.tick();
+	print [a.count, b.count, a.double];
+	b.value = 2;
+	print b.value;
+	print a.history == b.history;
+	print [Counter.created, Counter.zero.count];
+	let {double} = a;
+	print double;
+	print match (b) { {value: 10} => "ten", _ => "other" };`
+	expected := []string{
+		"[2, 5, 4]",
+		"10",
+		"false",
+		"[3, 0]",
+		"4",
+		"ten",
+	}
+	testEvalPrintStmt(t, input, expected)
+}
+
+func TestEvalClassMembersError(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+	}{
+		{"class A { get x() { return 1; } } A().x = 2;", "Cannot set property x which has only a getter."},
+		{"class A { static f() {} } A().f();", "Undefined propterty f."},
+		{"class A { f() {} } A.f();", "Undefined propterty f."},
+		{"class A { x = y; } A();", "Undefined variable y."},
+	}
+	for _, test := range tests {
+		testEvalError(t, test.input, test.msg)
+	}
+}
+
+func TestEvalPrivateMembers(t *testing.T) {
+	input := `class Account {
+		#balance = 0;
+		owner;
+		init(owner) {
+			this.owner = owner;
+		}
+		deposit(n) {
+			this.#balance = this.#balance + this.#checked(n);
+			return this;
+		}
+		#checked(n) {
+			if (n <= 0) return 0;
+			return n;
+		}
+		get balance() { return this.#balance; }
+	}
+	let a = Account("ann").deposit(5).deposit(-1).deposit(7);
+	print a.balance;
+	let deposit = a.deposit;
+	deposit(1);
+	print [a.owner, a.balance];`
+	expected := []string{
+		"12",
+		`["ann", 13]`,
+	}
+	testEvalPrintStmt(t, input, expected)
+}
+
+func TestEvalPrivateMembersError(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+	}{
+		{"class A { #x = 1; } print A().#x;", "Private member #x can only be accessed through this."},
+		{"class A { #x = 1; } A().#x = 2;", "Private member #x can only be accessed through this."},
+		{"class A { #x = 1; get(o) { return o.#x; } } A().get(A());", "Private member #x can only be accessed through this."},
+		{"class A { f() { return this.#y; } }", "Private member #y is not declared in class A."},
+		{"class A { #x = 1; static f() { return this.#x; } } A.f();", "Private member #x can only be accessed through this."},
+		{"class A { #f() {} } A().#f();", "Private member #f can only be accessed through this."},
+	}
+	for _, test := range tests {
+		testEvalError(t, test.input, test.msg)
+	}
+}
+
+func TestEvalOperatorOverloading(t *testing.T) {
+	input := `class Vec {
+		init(x, y) {
+			this.x = x;
+			this.y = y;
+		}
+		__add__(o) { return Vec(this.x + o.x, this.y + o.y); }
+		__sub__(o) { return Vec(this.x - o.x, this.y - o.y); }
+		__mul__(k) { return Vec(this.x * k, this.y * k); }
+		__neg__() { return Vec(-this.x, -this.y); }
+		__eq__(o) { return this.x == o.x & this.y == o.y; }
+		__lt__(o) { return this.x * this.x + this.y * this.y < o.x * o.x + o.y * o.y; }
+		__index__(i) {
+			if (i == 0) return this.x;
+			return this.y;
+		}
+		__setindex__(i, v) {
+			if (i == 0) this.x = v;
+			else this.y = v;
+		}
+		__call__(k) { return this.x * k; }
+		__str__() { return "Vec(" + this.x + ", " + this.y + ")"; }
+	}
+	let a = Vec(1, 2);
+	let b = Vec(3, 4);
+	print a + b;
+	print [a - b, a * 3, -a];
+	print [a == Vec(1, 2), a != b, a < b, a > b, b > a];
+	a[1] = 9;
+	print [a[0], a[1], a(10)];
+	class Plain {}
+	let p = Plain();
+	print [p == p, p == Plain(), p];`
+	expected := []string{
+		"Vec(4, 6)",
+		"[Vec(-2, -2), Vec(3, 6), Vec(-1, -2)]",
+		"[true, true, true, false, true]",
+		"[1, 9, 10]",
+		"[true, false, Plain{}]",
+	}
+	testEvalPrintStmt(t, input, expected)
+}
+
+func TestEvalOperatorOverloadingError(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+	}{
+		{"class A {} A() + 1;", "Operands must be numbers or strings."},
+		{"class A { __lt__(o) { return true; } } A() >= A();", "Operands must be numbers."},
+		{"class A {} A()[0];", "Only arrays and strings can be indexed."},
+		{"class A {} A()();", "Can only call functions and classes."},
+		{"class A { __add__() { return 1; } } A() + 1;", "Expected 0 arguments but got 1"},
+	}
+	for _, test := range tests {
+		testEvalError(t, test.input, test.msg)
+	}
+}
+
+func TestEvalTrait(t *testing.T) {
+	input := `trait Shape {
+		area();
+		name() { return "shape"; }
+		describe() { return this.name() + " " + this.area(); }
+	}
+	trait Printable {
+		show() { print this.describe(); }
+	}
+	class Square with Shape, Printable {
+		init(s) {
+			this.s = s;
+		}
+		area() { return this.s * this.s; }
+		name() { return "square"; }
+	}
+	class Circle with Shape {
+		init(r) {
+			this.r = r;
+		}
+		area() { return 3 * this.r * this.r; }
+	}
+	let sq = Square(3);
+	sq.show();
+	print Circle(1).describe();
+	print [sq is Shape, sq is Printable, sq is Square, sq is Circle, Circle(1) is Printable, 1 is Shape];
+	enum Color { Red }
+	print [Color.Red is Color, Shape];`
+	expected := []string{
+		"square 9",
+		"shape 3",
+		"[true, true, true, false, false, false]",
+		"[true, <trait Shape>]",
+	}
+	testEvalPrintStmt(t, input, expected)
+}
+
+func TestEvalTraitError(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+	}{
+		{"trait T { f(); } class A with T {}", "Class A must implement method f required by trait T."},
+		{"trait T { f() {} } trait U { f() {} } class A with T, U {}", "Class A gets method f from both traits T and U, it must override it."},
+		{"let T = 1; class A with T {}", "T is not a trait."},
+		{"trait T {} class A with T, T {}", "Trait T is used twice by class A."},
+		{"print 1 is 2;", "Right operand of 'is' must be a class, a trait or an enum."},
+		{"trait T {} T = 1;", "Assignment to constant variable"},
+	}
+	for _, test := range tests {
+		testEvalError(t, test.input, test.msg)
+	}
+}
+
+func TestEvalIntrospection(t *testing.T) {
+	input := `class Point {
+		#secret = 0;
+		x = 1;
+		y = 2;
+		norm() { return this.x + this.y; }
+		#helper() {}
+		get size() { return 2; }
+	}
+	trait T {}
+	class Fn with T { __call__() { return 1; } }
+	let p = Point();
+	print [typeof(1), typeof(1.5), typeof(2n), typeof("s"), typeof(nil), typeof(true), typeof([1])];
+	print [typeof(p), typeof(Point), typeof(typeof), typeof(T)];
+	print [fields(p), methods(Point), methods(Fn())];
+	print [hasField(p, "x"), hasField(p, "z"), hasField(p, "#secret"), hasField(1, "x")];
+	setField(p, "z", 3);
+	print [getField(p, "z"), getField(p, "size"), p.z, fields(p)];
+	print [className(p), className(Point)];
+	print [callable(Fn()), callable(p), callable(Point), callable(typeof), callable(1)];
+	print [instanceof(p, Point), instanceof(Fn(), T), instanceof(p, Fn)];`
+	expected := []string{
+		`["int", "float", "bigint", "string", "nil", "bool", "array"]`,
+		`["instance", "class", "function", "trait"]`,
+		`[["x", "y"], ["norm"], ["__call__"]]`,
+		"[true, false, false, false]",
+		`[3, 2, 3, ["x", "y", "z"]]`,
+		`["Point", "Point"]`,
+		"[true, false, true, true, false]",
+		"[true, true, false]",
+	}
+	testEvalPrintStmt(t, input, expected)
+}
+
+func TestEvalIntrospectionError(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+	}{
+		{"class A { #x = 1; } getField(A(), \"#x\");", "getField cannot access private member #x."},
+		{"class A { #x = 1; } setField(A(), \"#x\", 2);", "setField cannot access private member #x."},
+		{"class A { #x = 1; get() { return getField(this, \"#x\"); } } A().get();", "getField cannot access private member #x."},
+		{"class A { #x = 1; set() { setField(this, \"#x\", 1); } } A().set();", "setField cannot access private member #x."},
+		{"class A {} getField(A(), 1);", "getField expects a property name string, got int."},
+		{"fields(1);", "fields expects an instance, got int."},
+		{"methods([]);", "methods expects a class or an instance, got array."},
+		{"className(nil);", "className expects a class or an instance, got nil."},
+		{"class A {} getField(A(), \"x\");", "Undefined propterty x."},
+	}
+	for _, test := range tests {
+		testEvalError(t, test.input, test.msg)
+	}
+}
+
+func TestEvalEquality(t *testing.T) {
+	input := `let a = [1, [2, 3]];
+	print [a == a, a === a, equals(a, [1, [2, 3]]), equals(a, [1, [2, 4]]), equals(1, 1.0), equals(1, true)];
+	let c = [1];
+	c[0] = c;
+	print equals(c, c);
+	print [hash([1, 2]) == hash([1, 2]), hash(1) == hash(1.0), hash(2n) == hash(2), hash("a") == hash("b")];
+	class Key {
+		init(id) {
+			this.id = id;
+		}
+		__eq__(o) { return this.id == o.id; }
+		__hash__() { return this.id; }
+	}
+	print [equals(Key(1), Key(1)), hash(Key(1)) == hash(Key(1))];
+	print [equals(Map([[1, 2], [3, 4]]), Map([[3, 4], [1, 2]])), equals(Map([[1, 2]]), Map([[1, 3]]))];`
+	expected := []string{
+		"[true, true, true, false, true, false]",
+		"true",
+		"[true, true, true, false]",
+		"[true, true]",
+		"[true, false]",
+	}
+	testEvalPrintStmt(t, input, expected)
+}
+
+func TestEvalMap(t *testing.T) {
+	input := `class P {}
+	class Key {
+		init(id) {
+			this.id = id;
+		}
+		__eq__(o) { return this.id == o.id; }
+		__hash__() { return this.id; }
+	}
+	let p = P();
+	let m = Map([[[1, 2], "pair"], [p, "p"]]);
+	m["k"] = 3;
+	m.set(1, "one").set(Key(7), "seven");
+	print [m[[1, 2]], m[p], m[P()], m.get(1.0), m[Key(7)], m.size];
+	print [m.has("k"), m.delete("k"), m.has("k"), m.delete("k")];
+	print m.keys();
+	print m.values();
+	for (let [k, v] in Map([["a", 1], ["b", 2]])) print k + v;
+	print Map(Map([[1, 2]]));`
+	expected := []string{
+		`["pair", "p", nil, "one", "seven", 5]`,
+		"[true, true, false, false]",
+		"[[1, 2], P{}, 1, Key{id: 7}]",
+		`["pair", "p", "one", "seven"]`,
+		"a1",
+		"b2",
+		"{1: 2}",
+	}
+	testEvalPrintStmt(t, input, expected)
+}
+
+func TestEvalSort(t *testing.T) {
+	input := `print sort([3, "b", nil, [1], true, 1.5, "a", false, [0, 9], 2n]);
+	function desc(a, b) { return b - a; }
+	let xs = [3, 1, 2];
+	print [sort(xs, desc), xs];
+	class V {
+		init(n) {
+			this.n = n;
+		}
+		__lt__(o) { return this.n < o.n; }
+		__str__() { return "V" + this.n; }
+	}
+	print sort([V(2), V(3), V(1)]);
+	enum E { A, B }
+	print sort([E.B, E.A]);`
+	expected := []string{
+		`[nil, false, true, 1.5, 2n, 3, "a", "b", [0, 9], [1]]`,
+		"[[3, 2, 1], [3, 1, 2]]",
+		"[V1, V2, V3]",
+		"[E.A, E.B]",
+	}
+	testEvalPrintStmt(t, input, expected)
+}
+
+func TestEvalMapError(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+	}{
+		{"Map(1);", "Map expects an array of [key, value] pairs."},
+		{"Map([[1]]);", "Map expects an array of [key, value] pairs."},
+		{"print Map().length;", "Undefined propterty length."},
+		{"class A { __hash__() { return nil; } } hash(A());", "__hash__ must return an int."},
+		{"sort(1);", "sort expects an array, got int."},
+		{"function f(a, b) { return nil; } sort([1, 2], f);", "Compare function must return a number."},
+	}
+	for _, test := range tests {
+		testEvalError(t, test.input, test.msg)
+	}
+}
+
+func TestEvalTailCall(t *testing.T) {
+	input := `print maxCallDepth(100);
+	function count(n, acc) {
+		if (n == 0) return acc;
+		return count(n - 1, acc: acc + 1);
+	}
+	function isEven(n) { if (n == 0) return true; return isOdd(n - 1); }
+	function isOdd(n) { if (n == 0) return false; return isEven(n - 1); }
+	class Counter {
+		down(n) {
+			if (n == 0) return "done";
+			return this.down(n - 1);
+		}
+	}
+	function toInt(s) { return int(s); }
+	print count(100000, 0);
+	print isEven(10001);
+	print Counter().down(5000);
+	print toInt("42");`
+	expected := []string{
+		"10000",
+		"100000",
+		"false",
+		"done",
+		"42",
+	}
+	testEvalPrintStmt(t, input, expected)
+}
+
+func TestEvalStackOverflow(t *testing.T) {
+	input := `maxCallDepth(50);
+	function deep(n) { return 1 + deep(n + 1); }
+	deep(0);`
+	testEvalError(t, input, "stack overflow: maximum call depth of 50 exceeded.\n    at deep\n    at deep")
+	testEvalError(t, input, "... 41 more")
+	testEvalError(t, "maxCallDepth(0);", "Maximum call depth must be a positive int, got 0.")
+	callbacks := []string{
+		"function cmp(a, b) { sort([1, 2], cmp); return 0; } sort([1, 2], cmp);",
+		"class K { __eq__(o) { return equals([this], [o]); } } K() == K();",
+		"class P { get x() { return getField(this, \"x\"); } } P().x;",
+	}
+	for _, input := range callbacks {
+		testEvalError(t, "maxCallDepth(50);"+input, "stack overflow: maximum call depth of 50 exceeded.")
+	}
+	testEvalError(t, "maxCallDepth(50); class A { x = A(); } A();", "stack overflow: maximum call depth of 50 exceeded.\n    at A\n    at A")
+	// a built-in in a return statement is called on the frame of the caller.
+	input = `maxCallDepth(1);
+	function zero(a, b) { return 0; }
+	function f() { return sort([1, 2], zero); }
+	f();`
+	testEvalError(t, input, "stack overflow: maximum call depth of 1 exceeded.\n    at zero\n    at f")
+}
+
+func TestEvalDefer(t *testing.T) {
+	input := `function log(s) { print s; }
+	function f(n) {
+		defer log("first");
+		defer log("second " + n);
+		if (n > 0) {
+			let x = "block";
+			defer log(x);
+			return "early";
+		}
+		n = 5;
+		return "end";
+	}
+	function count(n) {
+		defer log("left " + n);
+		if (n == 0) return 0;
+		return count(n - 1);
+	}
+	function numbers() {
+		defer log("closed");
+		yield 1;
+		yield 2;
+	}
+	function fail() {
+		defer log("cleanup");
+		return 1 + nil;
+	}
+	print f(1);
+	print f(0);
+	print count(2);
+	let it = numbers();
+	print it.next().value;
+	it.close();
+	fail();
+	print "unreachable";`
+	expected := []string{
+		"block",
+		"second 1",
+		"first",
+		"early",
+		"second 0",
+		"first",
+		"end",
+		"left 0",
+		"left 1",
+		"left 2",
+		"0",
+		"1",
+		"closed",
+		"cleanup",
+	}
+	testEvalPrintStmt(t, input, expected)
+	// the callee and the arguments of a deferred call are evaluated by the
+	// defer statement, other expressions when the function returns.
+	input = `function log(s) { print s; }
+	function loop() {
+		for (let i = 0; i < 3; i = i + 1) defer log(i);
+	}
+	let seen = 0;
+	function last() {
+		let x = 1;
+		defer seen = x;
+		x = 2;
+	}
+	loop();
+	last();
+	print seen;`
+	testEvalPrintStmt(t, input, []string{"2", "1", "0", "2"})
+	testEvalError(t, `function f() { defer nil(); defer g(); }
+	function g() { print "still runs"; }
+	f();`, "Can only call functions and classes.")
+}
+
+func TestEvalRepr(t *testing.T) {
+	input := `class Point {
+		#secret = 0;
+		init(x, y) {
+			this.x = x;
+			this.y = y;
+		}
+	}
+	class Money {
+		init(n) {
+			this.n = n;
+		}
+		toString() { return "$" + this.n; }
+	}
+	print [1, "two", [3, "f\"our"], Point(1, "y"), Money(5)];
+	print "plain";
+	print repr("plain");
+	let c = [1];
+	c[0] = c;
+	print c;
+	let p = Point(1, 2);
+	p.self = p;
+	print p;
+	print Money(2);
+	class Node {
+		init() { this.next = nil; }
+		toString() { return "Node(" + repr(this.next) + ")"; }
+	}
+	let n = Node();
+	n.next = Node();
+	n.next.next = n;
+	print n;
+	print repr([1, Map([["k", []]]), Point(1, 2)], 2);
+	print repr(1.0);
+	print repr(1.5);
+	print repr(2n);
+	print repr(2.50d);
+	print 1.0;
+	print [1.0, 2n, 3d];`
+	expected := []string{
+		`[1, "two", [3, "f\"our"], Point{x: 1, y: "y"}, $5]`,
+		"plain",
+		`"plain"`,
+		"[[...]]",
+		"Point{self: Point{...}, x: 1, y: 2}",
+		"$2",
+		"Node(Node(Node{...}))",
+		"[",
+		"  1,",
+		"  {",
+		`    "k": [],`,
+		"  },",
+		"  Point{",
+		"    x: 1,",
+		"    y: 2,",
+		"  },",
+		"]",
+		"1.0",
+		"1.5",
+		"2n",
+		"2.50d",
+		"1",
+		"[1.0, 2n, 3d]",
+	}
+	testEvalPrintStmt(t, input, expected)
+	testEvalError(t, "class T { toString() { return this; } } print T();", "toString must return a string.")
+	testEvalError(t, "class T { __str__() { return nil + 1; } } print [T()];", "Operands must be numbers or strings.")
+}
+
+func TestEvalDestructuring(t *testing.T) {
+	input := `let [a, b, ...rest] = [1, 2, 3, 4];
+	print [a, b, rest];
+	let [c, d, ...e] = [5];
+	print [c, d, e];
+	var x = 1;
+	var y = 2;
+	[x, y] = [y, x];
+	print [x, y];
+	class Point {
+		init(x, y) {
+			this.x = x;
+			this.y = y;
+		}
+	}
+	let {x: px, y: [py]} = Point(3, [4]);
+	print [px, py];
+	const {length} = [1, 2, 3];
+	print length;
+	function sumdiff(a, b) {
+		return a + b, a - b;
+	}
+	let [s, t] = sumdiff(7, 2);
+	print [s, t];
+	function sum([a, b], {x} = Point(10, 0)) {
+		return a + b + x;
+	}
+	print sum([1, 2]);
+	print sum([1, 2], Point(3, 0));
+	let p = Point(0, 0);
+	let xs = [0, 0];
+	[p.x, xs[1]] = [5, 6];
+	print [p.x, xs];
+	print [0, ...xs, ...[7]];
+	let {x: mx, z: mz} = Map([["x", 1]]);
+	print [mx, mz];`
+	expected := []string{
+		"[1, 2, [3, 4]]",
+		"[5, nil, []]",
+		"[2, 1]",
+		"[3, 4]",
+		"3",
+		"[9, 5]",
+		"13",
+		"6",
+		"[5, [0, 6]]",
+		"[0, 0, 6, 7]",
+		"[1, nil]",
+	}
+	testEvalPrintStmt(t, input, expected)
+}
+
+func TestEvalForIn(t *testing.T) {
+	input := `for (let x in [1, 2, 3]) {
+		print x;
+	}
+	for (var [k, v] in [["a", 1], ["b", 2]]) print k + v;
+	for (const c in "hé") print c;
+	let fns = [];
+	for (let i in [1, 2]) {
+		function get() {
+			return i;
+		}
+		fns = [...fns, get];
+	}
+	print fns[0]() + fns[1]();
+	function find(xs, target) {
+		for (let x in xs) {
+			if (x == target) return "found";
+		}
+		return "missing";
+	}
+	print find([1, 2], 2);
+	print find([1, 2], 3);`
+	expected := []string{"1", "2", "3", "a1", "b2", "h", "é", "3", "found", "missing"}
+	testEvalPrintStmt(t, input, expected)
+}
+
+func TestEvalDestructuringError(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+	}{
+		{"let [a] = 1;", "int is not iterable."},
+		{"for (let x in nil) {}", "nil is not iterable."},
+		{"const [a] = [1]; [a] = [2];", `Assignment to constant variable "a".`},
+		{"let {x} = 1;", "Only instances or array have properties."},
+	}
+	for _, test := range tests {
+		testEvalError(t, test.input, test.msg)
+	}
+}
+
+func TestEvalTemplate(t *testing.T) {
+	input := strings.ReplaceAll(`let name = "world";
+	let n = 3;
+	print 'hello ${name}!';
+	print '${n} + 1 = ${n + 1}';
+	print '${[1, 2]} ${nil} ${true}';
+	print '${'inner ${name + "}"}'} \${name}';
+	function f() {
+		let x = "local";
+		return '${x}
+${name}';
+	}
+	print f();`, "'", "`")
+	expected := []string{
+		"hello world!",
+		"3 + 1 = 4",
+		"[1, 2] nil true",
+		"inner world} ${name}",
+		"local",
+		"world",
+	}
+	testEvalPrintStmt(t, input, expected)
+}
+
 func TestResolveError(t *testing.T) {
 	tests := []struct {
 		input string
@@ -299,6 +1840,7 @@ func TestResolveError(t *testing.T) {
 	}{
 		{"return 123;", "Cannot return from top-level."},
 		{"print this;", "Cannot use this outside of a class."},
+		{"defer clock();", "Cannot defer from top-level code."},
 		{`class A {
 			init() {
 				return "x";
@@ -343,13 +1885,18 @@ func evalExprFromInput(input string) (v valuer.Valuer, err error) {
 }
 
 func testNumberValuer(t *testing.T, val valuer.Valuer, expected float64) bool {
-	v, ok := val.(*valuer.Number)
-	if !ok {
-		t.Errorf("expected type is Number. got %T (%+[1]v)", val)
+	var value float64
+	switch v := val.(type) {
+	case *valuer.Number:
+		value = v.Value
+	case *valuer.Int:
+		value = float64(v.Value)
+	default:
+		t.Errorf("expected type is Number or Int. got %T (%+[1]v)", val)
 		return false
 	}
-	if v.Value != expected {
-		t.Errorf("expected value is %f. got %f", expected, v.Value)
+	if value != expected {
+		t.Errorf("expected value is %f. got %f", expected, value)
 		return false
 	}
 	return true
@@ -404,14 +1951,36 @@ func testEvalPrintStmt(t *testing.T, input string, expected []string) {
 	}
 }
 
-// https://stackoverflow.com/a/47281683
+func testEvalError(t *testing.T, input string, msg string) {
+	stmts, err := parser.ParseStmts(input)
+	if err != nil {
+		t.Fatalf("parse failed. error: %s", err.Error())
+	}
+	initEnv()
+	s := captureStderr(func() {
+		Interpret(stmts)
+	})
+	if !strings.Contains(s, msg) {
+		t.Errorf("expected error is %q. got %q", msg, strings.TrimSpace(s))
+	}
+}
+
 func captureStdout(fn func()) string {
-	rescueStdout := os.Stdout
+	return capture(&os.Stdout, fn)
+}
+
+func captureStderr(fn func()) string {
+	return capture(&os.Stderr, fn)
+}
+
+// https://stackoverflow.com/a/47281683
+func capture(file **os.File, fn func()) string {
+	rescue := *file
 	r, w, err := os.Pipe()
 	if err != nil {
 		panic(err)
 	}
-	os.Stdout = w
+	*file = w
 
 	fn()
 
@@ -424,7 +1993,7 @@ func captureStdout(fn func()) string {
 		ch <- string(b)
 	}()
 	w.Close()
-	os.Stdout = rescueStdout
+	*file = rescue
 	s := <-ch
 	return s
 }
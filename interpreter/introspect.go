@@ -0,0 +1,150 @@
+package interpreter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"tiny-script/errors"
+	"tiny-script/token"
+	"tiny-script/valuer"
+)
+
+// builtinTypeof returns the name of the type of a value, such as int or instance.
+func builtinTypeof(args []valuer.Valuer) valuer.Valuer {
+	return &valuer.String{Value: args[0].Type().String()}
+}
+
+func builtinInstanceof(args []valuer.Valuer) valuer.Valuer {
+	return toBooleanValuer(isInstanceOf(args[0], args[1]))
+}
+
+// builtinClassName returns the name of a class or of the class of an instance.
+func builtinClassName(args []valuer.Valuer) valuer.Valuer {
+	return &valuer.String{Value: classOf("className", args[0]).Name}
+}
+
+// builtinFields returns the sorted names of the public fields of an instance.
+func builtinFields(args []valuer.Valuer) valuer.Valuer {
+	instance, ok := args[0].(*valuer.Instance)
+	if !ok {
+		errors.Error(token.LeftParen, fmt.Sprintf("fields expects an instance, got %s.", args[0].Type()))
+	}
+	return publicNames(instance.FieldNames())
+}
+
+// builtinMethods returns the sorted names of the public methods of a class or
+// of the class of an instance, including the methods mixed in by traits.
+func builtinMethods(args []valuer.Valuer) valuer.Valuer {
+	class := classOf("methods", args[0])
+	names := make([]string, 0, len(class.Mehtods))
+	for name := range class.Mehtods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return publicNames(names)
+}
+
+func builtinHasField(args []valuer.Valuer) valuer.Valuer {
+	name := propertyName("hasField", args[1])
+	instance, ok := args[0].(*valuer.Instance)
+	return toBooleanValuer(ok && !strings.HasPrefix(name, "#") && instance.HasField(name))
+}
+
+// builtinGetField reads a property by name as obj.name does, private members
+// cannot be read, even through this.
+func (t *thread) builtinGetField(args []valuer.Valuer) valuer.Valuer {
+	return t.getProperty(args[0], publicPropertyName("getField", args[1]))
+}
+
+func (t *thread) builtinSetField(args []valuer.Valuer) valuer.Valuer {
+	t.setProperty(args[0], publicPropertyName("setField", args[1]), args[2])
+	return args[2]
+}
+
+// builtinCallable reports whether a value can be called.
+func builtinCallable(args []valuer.Valuer) valuer.Valuer {
+	switch v := args[0].(type) {
+	case *valuer.Function, *valuer.Builtin, *valuer.ClassValue:
+		return toBooleanValuer(true)
+	case *valuer.Instance:
+		return toBooleanValuer(v.Klass.FindMethod("__call__") != nil)
+	}
+	return toBooleanValuer(false)
+}
+
+func classOf(fn string, v valuer.Valuer) *valuer.ClassValue {
+	switch v := v.(type) {
+	case *valuer.ClassValue:
+		return v
+	case *valuer.Instance:
+		return v.Klass
+	}
+	errors.Error(token.LeftParen, fmt.Sprintf("%s expects a class or an instance, got %s.", fn, v.Type()))
+	return nil
+}
+
+func propertyName(fn string, v valuer.Valuer) string {
+	name, ok := v.(*valuer.String)
+	if !ok {
+		errors.Error(token.LeftParen, fmt.Sprintf("%s expects a property name string, got %s.", fn, v.Type()))
+	}
+	return name.Value
+}
+
+// publicPropertyName returns the property name v, which must not name a
+// private member.
+func publicPropertyName(fn string, v valuer.Valuer) string {
+	name := propertyName(fn, v)
+	if strings.HasPrefix(name, "#") {
+		errors.Error(token.LeftParen, fmt.Sprintf("%s cannot access private member %s.", fn, name))
+	}
+	return name
+}
+
+// publicNames returns the names as an array of strings, leaving out private ones.
+func publicNames(names []string) *valuer.Array {
+	elements := make([]valuer.Valuer, 0, len(names))
+	for _, name := range names {
+		if !strings.HasPrefix(name, "#") {
+			elements = append(elements, &valuer.String{Value: name})
+		}
+	}
+	return &valuer.Array{Elements: elements}
+}
+
+// builtinRepr formats a value as a literal, strings are quoted, and the
+// elements are indented by the given number of spaces on their own lines.
+func (t *thread) builtinRepr(args []valuer.Valuer) valuer.Valuer {
+	indent := 0
+	if len(args) > 1 {
+		indent = toInteger(args[1], "Indent must be an integer.")
+		if indent < 0 {
+			errors.Error(token.LeftParen, "Indent must not be negative.")
+		}
+	}
+	return &valuer.String{Value: valuer.Repr(args[0], indent, t.stringMethod)}
+}
+
+// display formats v as print shows it, calling toString and __str__ on t.
+func (t *thread) display(v valuer.Valuer) string {
+	return valuer.Display(v, t.stringMethod)
+}
+
+// stringMethod calls the toString or __str__ method of instance, which must
+// return a string. It returns false if t is already calling it for instance,
+// as printing the instance inside the method would call it forever.
+func (t *thread) stringMethod(instance *valuer.Instance, method *valuer.Function) (string, bool) {
+	for _, i := range t.printing {
+		if i == instance {
+			return "", false
+		}
+	}
+	t.printing = append(t.printing, instance)
+	defer func() { t.printing = t.printing[:len(t.printing)-1] }()
+	s, ok := t.callFunction(method.Bind(instance), nil, nil).(*valuer.String)
+	if !ok {
+		errors.Error(token.LeftParen, method.Name+" must return a string.")
+	}
+	return s.Value, true
+}
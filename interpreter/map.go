@@ -0,0 +1,105 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"tiny-script/errors"
+	"tiny-script/token"
+	"tiny-script/valuer"
+)
+
+// builtinMap makes a map, optionally from an array of [key, value] pairs or
+// from another map. Keys are compared by equals, so arrays with the same
+// elements are the same key.
+func (t *thread) builtinMap(args []valuer.Valuer) valuer.Valuer {
+	m := &valuer.Map{}
+	if len(args) == 0 {
+		return m
+	}
+	switch init := args[0].(type) {
+	case *valuer.Map:
+		for _, e := range init.Entries() {
+			t.mapSet(m, e.Key, e.Value)
+		}
+	case *valuer.Array:
+		for _, p := range init.Snapshot() {
+			entry, ok := p.(*valuer.Array)
+			if !ok || entry.Len() != 2 {
+				errors.Error(token.LeftParen, "Map expects an array of [key, value] pairs.")
+			}
+			t.mapSet(m, entry.Get(0), entry.Get(1))
+		}
+	default:
+		errors.Error(token.LeftParen, "Map expects an array of [key, value] pairs.")
+	}
+	return m
+}
+
+func (t *thread) keyEqual(key valuer.Valuer) func(valuer.Valuer) bool {
+	return func(other valuer.Valuer) bool { return t.equals(key, other) }
+}
+
+func (t *thread) mapGet(m *valuer.Map, key valuer.Valuer) (valuer.Valuer, bool) {
+	return m.Get(t.hashValue(key), t.keyEqual(key))
+}
+
+func (t *thread) mapSet(m *valuer.Map, key, value valuer.Valuer) {
+	m.Set(t.hashValue(key), key, value, t.keyEqual(key))
+}
+
+// mapIndex returns the value of key, or nil if the map doesn't have it.
+func (t *thread) mapIndex(m *valuer.Map, key valuer.Valuer) valuer.Valuer {
+	if v, ok := t.mapGet(m, key); ok {
+		return v
+	}
+	return Nil
+}
+
+// mapProperty returns the size or a method of a map.
+func (t *thread) mapProperty(m *valuer.Map, name string) valuer.Valuer {
+	method := func(min, max int, fn func(args []valuer.Valuer) valuer.Valuer) valuer.Valuer {
+		return &valuer.Builtin{Name: name, Min: min, Max: max, Fn: fn}
+	}
+	switch name {
+	case "size":
+		return &valuer.Int{Value: int64(m.Len())}
+	case "get":
+		return method(1, 1, func(args []valuer.Valuer) valuer.Valuer { return t.mapIndex(m, args[0]) })
+	case "set":
+		return method(2, 2, func(args []valuer.Valuer) valuer.Valuer {
+			t.mapSet(m, args[0], args[1])
+			return m
+		})
+	case "has":
+		return method(1, 1, func(args []valuer.Valuer) valuer.Valuer {
+			_, ok := t.mapGet(m, args[0])
+			return toBooleanValuer(ok)
+		})
+	case "delete":
+		return method(1, 1, func(args []valuer.Valuer) valuer.Valuer {
+			return toBooleanValuer(m.Delete(t.hashValue(args[0]), t.keyEqual(args[0])))
+		})
+	case "keys", "values", "entries":
+		return method(0, 0, func([]valuer.Valuer) valuer.Valuer {
+			entries := m.Entries()
+			elements := make([]valuer.Valuer, len(entries))
+			for i, e := range entries {
+				elements[i] = mapElement(name, e)
+			}
+			return &valuer.Array{Elements: elements}
+		})
+	}
+	errors.Error(token.Identifier, fmt.Sprintf("Undefined propterty %s.", name))
+	return nil
+}
+
+// mapElement returns the key, the value or the [key, value] pair of an entry.
+func mapElement(kind string, e valuer.MapEntry) valuer.Valuer {
+	switch kind {
+	case "keys":
+		return e.Key
+	case "values":
+		return e.Value
+	}
+	return &valuer.Array{Elements: []valuer.Valuer{e.Key, e.Value}}
+}
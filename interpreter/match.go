@@ -0,0 +1,153 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"tiny-script/ast"
+	"tiny-script/errors"
+	"tiny-script/token"
+	"tiny-script/valuer"
+)
+
+func (t *thread) evalMatchStmt(stmt *ast.MatchStmt) valuer.Valuer {
+	v := t.Eval(stmt.Value)
+	for _, arm := range stmt.Arms {
+		if environment, ok := t.matchArm(arm, v); ok {
+			return t.evalWith(arm.Body, environment)
+		}
+	}
+	return Nil
+}
+
+func (t *thread) evalMatchExpr(expr *ast.MatchExpr) valuer.Valuer {
+	v := t.Eval(expr.Value)
+	for _, arm := range expr.Arms {
+		if environment, ok := t.matchArm(arm, v); ok {
+			return t.evalWith(arm.Body, environment)
+		}
+	}
+	errors.Error(token.Match, fmt.Sprintf("No match arm matches %s.", v))
+	return nil
+}
+
+// matchArm returns the environment of arm holding the names bound by its
+// pattern, if the pattern matches v and the guard holds.
+func (t *thread) matchArm(arm *ast.MatchArm, v valuer.Valuer) (*valuer.Environment, bool) {
+	environment := valuer.NewEnclosing(t.env)
+	if !t.matchPattern(arm.Pattern, v, environment) {
+		return nil, false
+	}
+	if arm.Guard != nil && !isTruthy(t.evalWith(arm.Guard, environment)) {
+		return nil, false
+	}
+	return environment, true
+}
+
+func (t *thread) matchPattern(pattern ast.MatchPattern, v valuer.Valuer, environment *valuer.Environment) bool {
+	switch p := pattern.(type) {
+	case *ast.WildcardPattern:
+		return true
+	case *ast.BindingPattern:
+		environment.Define(p.Name, v)
+		return true
+	case *ast.ValuePattern:
+		return t.sameValue(v, t.Eval(p.Value))
+	case *ast.RangePattern:
+		return inRange(v, t.Eval(p.Low), t.Eval(p.High), p.Inclusive)
+	case *ast.OrPattern:
+		for _, alt := range p.Alternatives {
+			if t.matchPattern(alt, v, environment) {
+				return true
+			}
+		}
+		return false
+	case *ast.ListPattern:
+		array, ok := v.(*valuer.Array)
+		if !ok {
+			return false
+		}
+		elements := array.Snapshot()
+		if len(elements) < len(p.Elements) || p.Rest == nil && len(elements) != len(p.Elements) {
+			return false
+		}
+		for i, e := range p.Elements {
+			if !t.matchPattern(e, elements[i], environment) {
+				return false
+			}
+		}
+		if p.Rest != nil {
+			rest := append([]valuer.Valuer{}, elements[len(p.Elements):]...)
+			return t.matchPattern(p.Rest, &valuer.Array{Elements: rest}, environment)
+		}
+		return true
+	case *ast.FieldsPattern:
+		if m, ok := v.(*valuer.Map); ok && p.Class == nil {
+			return t.matchMapFields(p, m, environment)
+		}
+		instance, ok := v.(*valuer.Instance)
+		if !ok {
+			return false
+		}
+		if p.Class != nil {
+			class, ok := t.evalWith(p.Class, environment).(*valuer.ClassValue)
+			if !ok {
+				errors.Error(token.Identifier, fmt.Sprintf("%s is not a class.", p.Class.Name))
+			}
+			if instance.Klass != class {
+				return false
+			}
+		}
+		for _, f := range p.Fields {
+			field, ok := t.instanceProperty(instance, f.Key)
+			if !ok || !t.matchPattern(f.Pattern, field, environment) {
+				return false
+			}
+		}
+		return true
+	case *ast.EnumPattern:
+		return t.matchEnumPattern(p, v, environment)
+	}
+	return false
+}
+
+// matchMapFields matches the fields of a pattern such as {x, y: 0} against the
+// values of the string keys of m.
+func (t *thread) matchMapFields(p *ast.FieldsPattern, m *valuer.Map, environment *valuer.Environment) bool {
+	for _, f := range p.Fields {
+		value, ok := t.mapGet(m, &valuer.String{Value: f.Key})
+		if !ok || !t.matchPattern(f.Pattern, value, environment) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameValue reports whether v equals the literal of a value pattern, unlike ==
+// values of different types never match, except numbers.
+func (t *thread) sameValue(v, literal valuer.Valuer) bool {
+	if isNumber(v) && isNumber(literal) {
+		return numbersEqual(v, literal)
+	}
+	return v.Type() == literal.Type() && t.isEqual(v, literal)
+}
+
+// inRange reports whether v is a number or string between low and high.
+func inRange(v, low, high valuer.Valuer, inclusive bool) bool {
+	upper := token.Less
+	if inclusive {
+		upper = token.LessEqual
+	}
+	if isNumber(v) && isNumber(low) && isNumber(high) {
+		return compareNumbers(token.GreaterEqual, v, low) && compareNumbers(upper, v, high)
+	}
+	s, ok := v.(*valuer.String)
+	lo, ok1 := low.(*valuer.String)
+	hi, ok2 := high.(*valuer.String)
+	if !ok || !ok1 || !ok2 {
+		return false
+	}
+	if inclusive {
+		return s.Value >= lo.Value && s.Value <= hi.Value
+	}
+	return s.Value >= lo.Value && s.Value < hi.Value
+}
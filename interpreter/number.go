@@ -0,0 +1,322 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sync"
+
+	"tiny-script/errors"
+	"tiny-script/token"
+	"tiny-script/valuer"
+)
+
+// The numbers form a tower: int < bigint < decimal, an operation between
+// them promotes to the wider one. Float is inexact, mixing it with bigint or
+// decimal requires an explicit conversion.
+type numberKind int
+
+const (
+	notNumber numberKind = iota
+	intKind
+	bigIntKind
+	decimalKind
+	floatKind
+)
+
+// decimal context used by the results of decimal operations, shared by threads.
+var (
+	decimalMu        sync.RWMutex
+	decimalPrecision = 20
+	decimalRounding  = valuer.RoundHalfEven
+)
+
+func decimalContext() (int, valuer.Rounding) {
+	decimalMu.RLock()
+	defer decimalMu.RUnlock()
+	return decimalPrecision, decimalRounding
+}
+
+func setDecimalContext(precision int, rounding valuer.Rounding) {
+	decimalMu.Lock()
+	decimalPrecision, decimalRounding = precision, rounding
+	decimalMu.Unlock()
+}
+
+func kindOf(v valuer.Valuer) numberKind {
+	switch v.(type) {
+	case *valuer.Int:
+		return intKind
+	case *valuer.BigInt:
+		return bigIntKind
+	case *valuer.Decimal:
+		return decimalKind
+	case *valuer.Number:
+		return floatKind
+	}
+	return notNumber
+}
+
+func isNumber(v valuer.Valuer) bool { return kindOf(v) != notNumber }
+
+// promote returns the common kind of the operands, float and exact kinds
+// other than int cannot be mixed.
+func promote(operator token.Token, left, right valuer.Valuer) numberKind {
+	a, b := kindOf(left), kindOf(right)
+	if a == notNumber || b == notNumber {
+		errors.Error(operator, "Operands must be numbers.")
+	}
+	if a > b {
+		a, b = b, a
+	}
+	if b == floatKind && a != floatKind && a > intKind {
+		errors.Error(operator, fmt.Sprintf("Cannot mix %s and %s, convert one of them explicitly.", left.Type(), right.Type()))
+	}
+	return b
+}
+
+func arithmetic(operator token.Token, left, right valuer.Valuer) valuer.Valuer {
+	switch promote(operator, left, right) {
+	case intKind:
+		a, b, _ := intOperands(left, right)
+		return intArithmetic(operator, a, b)
+	case bigIntKind:
+		return bigIntArithmetic(operator, toBigInt(left), toBigInt(right))
+	case decimalKind:
+		return decimalArithmetic(operator, toDecimal(left), toDecimal(right))
+	}
+	a, b := checkNumberOperands(operator, left, right)
+	switch operator {
+	case token.Plus:
+		return &valuer.Number{Value: a + b}
+	case token.Minus:
+		return &valuer.Number{Value: a - b}
+	case token.Star:
+		return &valuer.Number{Value: a * b}
+	}
+	if b == float64(0) {
+		errors.Error(operator, "Divisor can't be 0.")
+	}
+	return &valuer.Number{Value: a / b}
+}
+
+func negate(operator token.Token, right valuer.Valuer) valuer.Valuer {
+	switch n := right.(type) {
+	case *valuer.Int:
+		return intArithmetic(operator, 0, n.Value)
+	case *valuer.BigInt:
+		return &valuer.BigInt{Value: new(big.Int).Neg(n.Value)}
+	case *valuer.Decimal:
+		return &valuer.Decimal{Unscaled: new(big.Int).Neg(n.Unscaled), Scale: n.Scale}
+	}
+	return &valuer.Number{Value: -checkNumberOperand(operator, right)}
+}
+
+// bigIntArithmetic divides exactly into a bigint, or into a decimal otherwise.
+func bigIntArithmetic(operator token.Token, a, b *big.Int) valuer.Valuer {
+	v := new(big.Int)
+	switch operator {
+	case token.Plus:
+		v.Add(a, b)
+	case token.Minus:
+		v.Sub(a, b)
+	case token.Star:
+		v.Mul(a, b)
+	case token.Slash:
+		if b.Sign() == 0 {
+			errors.Error(operator, "Divisor can't be 0.")
+		}
+		if _, rem := v.QuoRem(a, b, new(big.Int)); rem.Sign() != 0 {
+			return decimalArithmetic(operator, &valuer.Decimal{Unscaled: a}, &valuer.Decimal{Unscaled: b})
+		}
+	}
+	return &valuer.BigInt{Value: v}
+}
+
+// decimalArithmetic keeps the results exact, a result with more fractional digits
+// than the precision, as well as a division, is rounded by the decimal context.
+func decimalArithmetic(operator token.Token, a, b *valuer.Decimal) valuer.Valuer {
+	precision, rounding := decimalContext()
+	var v *valuer.Decimal
+	switch operator {
+	case token.Plus, token.Minus:
+		scale := a.Scale
+		if b.Scale > scale {
+			scale = b.Scale
+		}
+		a, b = a.Rescale(scale), b.Rescale(scale)
+		unscaled := new(big.Int)
+		if operator == token.Plus {
+			unscaled.Add(a.Unscaled, b.Unscaled)
+		} else {
+			unscaled.Sub(a.Unscaled, b.Unscaled)
+		}
+		v = &valuer.Decimal{Unscaled: unscaled, Scale: scale}
+	case token.Star:
+		v = &valuer.Decimal{Unscaled: new(big.Int).Mul(a.Unscaled, b.Unscaled), Scale: a.Scale + b.Scale}
+	case token.Slash:
+		if b.Unscaled.Sign() == 0 {
+			errors.Error(operator, "Divisor can't be 0.")
+		}
+		scale := a.Scale
+		if b.Scale > scale {
+			scale = b.Scale
+		}
+		if scale > precision {
+			scale = precision
+		}
+		r := new(big.Rat).Quo(a.Rat(), b.Rat())
+		return valuer.RoundRat(r, precision, rounding).Trim(scale)
+	}
+	if v.Scale > precision {
+		return valuer.RoundRat(v.Rat(), precision, rounding)
+	}
+	return v
+}
+
+func toBigInt(v valuer.Valuer) *big.Int {
+	switch n := v.(type) {
+	case *valuer.Int:
+		return big.NewInt(n.Value)
+	case *valuer.BigInt:
+		return n.Value
+	}
+	return nil
+}
+
+func toDecimal(v valuer.Valuer) *valuer.Decimal {
+	if n, ok := v.(*valuer.Decimal); ok {
+		return n
+	}
+	return &valuer.Decimal{Unscaled: toBigInt(v)}
+}
+
+// toRat returns the exact value of an int, a bigint or a decimal.
+func toRat(v valuer.Valuer) *big.Rat {
+	if n, ok := v.(*valuer.Decimal); ok {
+		return n.Rat()
+	}
+	return new(big.Rat).SetInt(toBigInt(v))
+}
+
+// compareNumbers compares left and right by operator, exact numbers are compared exactly.
+func compareNumbers(operator token.Token, left, right valuer.Valuer) bool {
+	if a, b, ok := intOperands(left, right); ok {
+		return compare(operator, float64(cmpInt(a, b)), 0)
+	}
+	if isNumber(left) && isNumber(right) && kindOf(left) != floatKind && kindOf(right) != floatKind {
+		return compare(operator, float64(toRat(left).Cmp(toRat(right))), 0)
+	}
+	a, b := checkNumberOperands(operator, left, right)
+	return compare(operator, a, b)
+}
+
+func numbersEqual(a, b valuer.Valuer) bool {
+	if kindOf(a) == floatKind || kindOf(b) == floatKind {
+		x, _ := toFloat(a)
+		y, _ := toFloat(b)
+		return x == y
+	}
+	return toRat(a).Cmp(toRat(b)) == 0
+}
+
+func checkNumberOperand(operator token.Token, right valuer.Valuer) float64 {
+	a, ok := toFloat(right)
+	if !ok {
+		errors.Error(operator, "Operand must be a number.")
+	}
+	return a
+}
+
+func checkNumberOperands(operator token.Token, left, right valuer.Valuer) (float64, float64) {
+	a, ok := toFloat(left)
+	b, ok1 := toFloat(right)
+	if !(ok && ok1) {
+		errors.Error(operator, "Operands must be numbers.")
+	}
+	return a, b
+}
+
+// toFloat converts any number to float64, bigints and decimals may lose precision.
+func toFloat(v valuer.Valuer) (float64, bool) {
+	switch n := v.(type) {
+	case *valuer.Int:
+		return float64(n.Value), true
+	case *valuer.Number:
+		return n.Value, true
+	case *valuer.BigInt:
+		f, _ := new(big.Float).SetInt(n.Value).Float64()
+		return f, true
+	case *valuer.Decimal:
+		f, _ := n.Rat().Float64()
+		return f, true
+	}
+	return 0, false
+}
+
+func intOperands(left, right valuer.Valuer) (int64, int64, bool) {
+	a, ok := left.(*valuer.Int)
+	b, ok1 := right.(*valuer.Int)
+	if !(ok && ok1) {
+		return 0, 0, false
+	}
+	return a.Value, b.Value, true
+}
+
+// intArithmetic keeps the result of ints exact, the division of ints is an int
+// only when it is exact, and an overflow raises an error instead of wrapping.
+func intArithmetic(operator token.Token, a, b int64) valuer.Valuer {
+	var v int64
+	switch operator {
+	case token.Plus:
+		v = a + b
+		if (v > a) != (b > 0) {
+			errors.Error(operator, "Integer overflow.")
+		}
+	case token.Minus:
+		v = a - b
+		if (v < a) != (b > 0) {
+			errors.Error(operator, "Integer overflow.")
+		}
+	case token.Star:
+		v = a * b
+		if a != 0 && (v/a != b || a == -1 && b == math.MinInt64) {
+			errors.Error(operator, "Integer overflow.")
+		}
+	case token.Slash:
+		if b == 0 {
+			errors.Error(operator, "Divisor can't be 0.")
+		}
+		if a%b != 0 {
+			return &valuer.Number{Value: float64(a) / float64(b)}
+		}
+		if a == math.MinInt64 && b == -1 {
+			errors.Error(operator, "Integer overflow.")
+		}
+		v = a / b
+	}
+	return &valuer.Int{Value: v}
+}
+
+func cmpInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compare(operator token.Token, a, b float64) bool {
+	switch operator {
+	case token.Greater:
+		return a > b
+	case token.GreaterEqual:
+		return a >= b
+	case token.Less:
+		return a < b
+	default:
+		return a <= b
+	}
+}
@@ -0,0 +1,74 @@
+package interpreter
+
+import (
+	"tiny-script/token"
+	"tiny-script/valuer"
+)
+
+// Instances overload the operators by special methods, a binary operator calls
+// the method of its left operand with the right one.
+var operatorMethods = map[token.Token]string{
+	token.Plus:         "__add__",
+	token.Minus:        "__sub__",
+	token.Star:         "__mul__",
+	token.Slash:        "__div__",
+	token.EqualEqual:   "__eq__",
+	token.Less:         "__lt__",
+	token.LessEqual:    "__le__",
+	token.Greater:      "__gt__",
+	token.GreaterEqual: "__ge__",
+}
+
+// reflectedOperators swap the operands of a comparison whose left operand
+// doesn't overload it, a > b is b < a.
+var reflectedOperators = map[token.Token]token.Token{
+	token.Less:         token.Greater,
+	token.LessEqual:    token.GreaterEqual,
+	token.Greater:      token.Less,
+	token.GreaterEqual: token.LessEqual,
+	token.EqualEqual:   token.EqualEqual,
+}
+
+func init() {
+	valuer.CallStringMethod = func(instance *valuer.Instance, method *valuer.Function) (string, bool) {
+		return (&thread{env: globals}).stringMethod(instance, method)
+	}
+}
+
+// specialMethod returns the special method name of v bound to it.
+func specialMethod(v valuer.Valuer, name string) (*valuer.Function, bool) {
+	instance, ok := v.(*valuer.Instance)
+	if !ok {
+		return nil, false
+	}
+	if method := instance.Klass.FindMethod(name); method != nil {
+		return method.Bind(instance), true
+	}
+	return nil, false
+}
+
+// overloadedOperator applies op by the special method of an instance operand,
+// ok is false if neither operand overloads it.
+func (t *thread) overloadedOperator(op token.Token, left, right valuer.Valuer) (v valuer.Valuer, ok bool) {
+	if method, ok := specialMethod(left, operatorMethods[op]); ok {
+		return t.callFunction(method, []valuer.Valuer{right}, nil), true
+	}
+	if reflected, ok := reflectedOperators[op]; ok {
+		if method, ok := specialMethod(right, operatorMethods[reflected]); ok {
+			return t.callFunction(method, []valuer.Valuer{left}, nil), true
+		}
+	}
+	return nil, false
+}
+
+// instancesEqual compares instances by __eq__, or by identity if neither
+// of them defines it.
+func (t *thread) instancesEqual(a, b valuer.Valuer) bool {
+	if method, ok := specialMethod(a, "__eq__"); ok {
+		return isTruthy(t.callFunction(method, []valuer.Valuer{b}, nil))
+	}
+	if method, ok := specialMethod(b, "__eq__"); ok {
+		return isTruthy(t.callFunction(method, []valuer.Valuer{a}, nil))
+	}
+	return a == b
+}
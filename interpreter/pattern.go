@@ -0,0 +1,131 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"tiny-script/ast"
+	"tiny-script/errors"
+	"tiny-script/token"
+	"tiny-script/valuer"
+)
+
+func (t *thread) evalDestructureStmt(stmt *ast.DestructureStmt) {
+	t.bindPattern(stmt.Pattern, t.Eval(stmt.Initializer), t.env.Define)
+}
+
+func (t *thread) evalPatternAssignExpr(expr *ast.PatternAssignExpr) valuer.Valuer {
+	v := t.Eval(expr.Value)
+	t.bindPattern(expr.Pattern, v, nil)
+	return v
+}
+
+func (t *thread) evalForInStmt(stmt *ast.ForInStmt) valuer.Valuer {
+	var result valuer.Valuer = Nil
+	iterate(t.Eval(stmt.Iterable), func(v valuer.Valuer) bool {
+		// 每次迭代都创建新的作用域，闭包捕获的是当次迭代的变量
+		environment := valuer.NewEnclosing(t.env)
+		t.bindPattern(stmt.Target, v, environment.Define)
+		if r := t.evalWith(stmt.Body, environment); r != nil && r.Type() == valuer.ReturnType {
+			result = r
+			return false
+		}
+		return true
+	})
+	return result
+}
+
+// bindPattern destructures v by pattern, names of a declaration are bound by define,
+// while variables, properties and indexes of an assignment are assigned.
+func (t *thread) bindPattern(pattern ast.Pattern, v valuer.Valuer, define func(string, valuer.Valuer)) {
+	switch p := pattern.(type) {
+	case *ast.Ident:
+		define(p.Name, v)
+	case *ast.VariableExpr:
+		t.assignVariable(p, v)
+	case *ast.GetExpr:
+		t.setProperty(t.Eval(p.Object), p.Name, v)
+	case *ast.IndexExpr:
+		t.setIndex(t.Eval(p.Object), t.Eval(p.Index), v)
+	case *ast.ArrayPattern:
+		var elements []valuer.Valuer
+		iterate(v, func(e valuer.Valuer) bool {
+			elements = append(elements, e)
+			// stop early so that a pattern can take the head of an infinite generator.
+			return p.Rest != nil || len(elements) < len(p.Elements)
+		})
+		for i, e := range p.Elements {
+			var element valuer.Valuer = Nil
+			if i < len(elements) {
+				element = elements[i]
+			}
+			t.bindPattern(e, element, define)
+		}
+		if p.Rest != nil {
+			rest := make([]valuer.Valuer, 0)
+			if len(p.Elements) < len(elements) {
+				rest = append(rest, elements[len(p.Elements):]...)
+			}
+			t.bindPattern(p.Rest, &valuer.Array{Elements: rest}, define)
+		}
+	case *ast.ObjectPattern:
+		for _, field := range p.Fields {
+			var value valuer.Valuer = Nil
+			switch v := v.(type) {
+			case *valuer.Instance:
+				if fv, ok := t.instanceProperty(v, field.Key); ok {
+					value = fv
+				}
+			case *valuer.Map:
+				value = t.mapIndex(v, &valuer.String{Value: field.Key})
+			default:
+				value = t.getProperty(v, field.Key)
+			}
+			t.bindPattern(field.Value, value, define)
+		}
+	default:
+		panic(fmt.Sprintf("unknown pattern type %#v.", p))
+	}
+}
+
+// iterate calls fn with each element of iterable until fn returns false.
+func iterate(iterable valuer.Valuer, fn func(valuer.Valuer) bool) {
+	switch it := iterable.(type) {
+	case *valuer.Array:
+		for i := 0; i < it.Len(); i++ {
+			if !fn(it.Get(i)) {
+				return
+			}
+		}
+	case *valuer.String:
+		for _, ch := range it.Value {
+			if !fn(&valuer.String{Value: string(ch)}) {
+				return
+			}
+		}
+	case *valuer.Generator:
+		for {
+			v, done := it.Resume(Nil)
+			if done {
+				return
+			}
+			if !fn(v) {
+				it.Close()
+				return
+			}
+		}
+	case *valuer.Map:
+		for _, e := range it.Entries() {
+			if !fn(mapElement("entries", e)) {
+				return
+			}
+		}
+	case *valuer.Channel:
+		for v := range it.C {
+			if !fn(v) {
+				return
+			}
+		}
+	default:
+		errors.Error(token.In, fmt.Sprintf("%s is not iterable.", iterable.Type()))
+	}
+}
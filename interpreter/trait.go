@@ -0,0 +1,70 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"tiny-script/ast"
+	"tiny-script/errors"
+	"tiny-script/token"
+	"tiny-script/valuer"
+)
+
+func (t *thread) evalTraitStmt(stmt *ast.TraitStmt) {
+	trait := &valuer.Trait{Name: stmt.Name, Methods: t.classMethods(stmt.Methods)}
+	for _, method := range stmt.Required {
+		trait.Required = append(trait.Required, method.Name)
+	}
+	t.env.Define(stmt.Name, trait)
+}
+
+// mixTraits copies the default methods of the traits of stmt into the class,
+// a method of the class overrides the ones of its traits. A method provided
+// by two traits must be overridden, and every required method must be provided.
+func (t *thread) mixTraits(class *valuer.ClassValue, stmt *ast.ClassStmt) {
+	provider := make(map[string]*valuer.Trait)
+	for _, expr := range stmt.Traits {
+		trait, ok := t.Eval(expr).(*valuer.Trait)
+		if !ok {
+			errors.Error(token.With, fmt.Sprintf("%s is not a trait.", expr.Name))
+		}
+		if class.Implements(trait) {
+			errors.Error(token.With, fmt.Sprintf("Trait %s is used twice by class %s.", trait.Name, class.Name))
+		}
+		class.Traits = append(class.Traits, trait)
+		for name, method := range trait.Methods {
+			if _, ok := class.Mehtods[name]; ok && provider[name] == nil {
+				continue
+			}
+			if other := provider[name]; other != nil {
+				errors.Error(token.With, fmt.Sprintf("Class %s gets method %s from both traits %s and %s, it must override it.", class.Name, name, other.Name, trait.Name))
+			}
+			provider[name] = trait
+			class.Mehtods[name] = method
+		}
+	}
+	for _, trait := range class.Traits {
+		for _, name := range trait.Required {
+			if class.FindMethod(name) == nil {
+				errors.Error(token.With, fmt.Sprintf("Class %s must implement method %s required by trait %s.", class.Name, name, trait.Name))
+			}
+		}
+	}
+}
+
+// isInstanceOf reports whether v is an instance of the class typ, of a class
+// using the trait typ, or a value of the enum typ.
+func isInstanceOf(v, typ valuer.Valuer) bool {
+	switch typ := typ.(type) {
+	case *valuer.ClassValue:
+		instance, ok := v.(*valuer.Instance)
+		return ok && instance.Klass == typ
+	case *valuer.Trait:
+		instance, ok := v.(*valuer.Instance)
+		return ok && instance.Klass.Implements(typ)
+	case *valuer.Enum:
+		value, ok := v.(*valuer.EnumValue)
+		return ok && value.Variant.Enum == typ
+	}
+	errors.Error(token.Is, "Right operand of 'is' must be a class, a trait or an enum.")
+	return false
+}
@@ -3,10 +3,10 @@ package lexer
 import (
 	"errors"
 	"fmt"
-	"os"
 	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"tiny-script/token"
 )
@@ -18,11 +18,20 @@ const (
 var (
 	// identifer error
 	errUnterminated = errors.New("unterminated string")
-	errEspace       = errors.New("invalid escape char")
+	errEscape       = errors.New("invalid escape sequence")
 	errInvalidChar  = errors.New("invalid unicode char")
 
+	// template error
+	errUnterminatedTemplate = errors.New("unterminated template")
+	errUnterminatedExpr     = errors.New("unterminated template expression")
+
 	// number error
-	errLessPower = errors.New("power is required")
+	errLessPower    = errors.New("power is required")
+	errUnderscore   = errors.New("'_' must separate successive digits")
+	errBigIntSuffix = errors.New("bigint literal cannot have fraction or exponent")
+
+	numberBases = map[rune]int{'x': 16, 'o': 8, 'b': 2}
+	baseNames   = map[int]string{2: "binary", 8: "octal", 10: "decimal", 16: "hexadecimal"}
 )
 
 // Lexer represents a lexical scanner for Lox programing language.
@@ -55,7 +64,15 @@ func (l *Lexer) consume() {
 }
 
 func (l *Lexer) peek() rune {
-	return l.str[l.currIndex]
+	return l.peekAt(0)
+}
+
+// peekAt returns the rune n positions after the next one without consuming it.
+func (l *Lexer) peekAt(n int) rune {
+	if l.currIndex+n >= len(l.str) {
+		return EOF
+	}
+	return l.str[l.currIndex+n]
 }
 
 func (l *Lexer) skip() {
@@ -77,10 +94,6 @@ func (l *Lexer) match(ch rune) bool {
 	return true
 }
 
-func (l *Lexer) error(msg string) {
-	_, _ = fmt.Fprintf(os.Stderr, "%d %s\n", l.Pos(), msg)
-}
-
 func (l *Lexer) readIdentifier() string {
 	l.tokenBuf.Reset()
 	for isAlphaNumeric(l.ch) {
@@ -90,94 +103,358 @@ func (l *Lexer) readIdentifier() string {
 	return l.tokenBuf.String()
 }
 
-func (l *Lexer) readString() (string, error) {
-	l.tokenBuf.Reset()
+// readString reads a string quoted by " or ', the quote may be tripled
+// for a multi-line string, escapes are kept as is in a raw string.
+func (l *Lexer) readString(raw bool) (string, error) {
+	quote := l.ch
+	delimiter := 1
+	if l.peek() == quote && l.peekAt(1) == quote {
+		delimiter = 3
+	}
+	start := l.currIndex + delimiter - 1
+	end := start
+	for ; !l.isStringEnd(end, quote, delimiter); end++ {
+		if end >= len(l.str) {
+			l.currIndex = len(l.str)
+			l.consume()
+			return "", errUnterminated
+		}
+		if l.str[end] == '\\' {
+			end++
+		}
+	}
+	l.currIndex = end + delimiter
 	l.consume()
-	if l.ch == '"' {
+
+	content := string(l.str[start:end])
+	if delimiter == 3 {
+		content = dedent(content)
+	}
+	if raw {
+		return content, nil
+	}
+	return unescape([]rune(content))
+}
+
+func (l *Lexer) isStringEnd(i int, quote rune, delimiter int) bool {
+	for j := 0; j < delimiter; j++ {
+		if i+j >= len(l.str) || l.str[i+j] != quote {
+			return false
+		}
+	}
+	return true
+}
+
+// dedent removes the line break after the opening quotes, the line of the
+// closing quotes and the common indentation of a multi-line string.
+func dedent(content string) string {
+	lines := strings.Split(content, "\n")
+	if len(lines) > 1 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	if len(lines) > 1 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	// the indentation is the longest whitespace prefix common to the lines
+	// that are not blank.
+	indent, seen := "", false
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		prefix := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if !seen {
+			indent, seen = prefix, true
+			continue
+		}
+		n := 0
+		for n < len(indent) && n < len(prefix) && indent[n] == prefix[n] {
+			n++
+		}
+		indent = indent[:n]
+	}
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			lines[i] = ""
+		} else {
+			lines[i] = strings.TrimPrefix(line, indent)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func unescape(s []rune) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteRune(s[i])
+			continue
+		}
+		ch, next, err := readEscape(s, i+1)
+		if err != nil {
+			return "", err
+		}
+		b.WriteRune(ch)
+		i = next - 1
+	}
+	return b.String(), nil
+}
+
+// readTemplate returns the raw content between backticks, the interpolations
+// are split out by SplitTemplate.
+func (l *Lexer) readTemplate() (string, error) {
+	start := l.currIndex
+	end, err := scanTemplate(l.str, start)
+	if err != nil {
+		l.currIndex = len(l.str)
 		l.consume()
-		return "", nil
+		return "", err
+	}
+	l.currIndex = end + 1
+	l.consume()
+	return string(l.str[start:end]), nil
+}
+
+// scanTemplate returns the index of the backtick closing the template started at i.
+func scanTemplate(s []rune, i int) (int, error) {
+	for ; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '`':
+			return i, nil
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '{':
+			end, err := scanTemplateExpr(s, i+2)
+			if err != nil {
+				return 0, err
+			}
+			i = end
+		}
 	}
+	return 0, errUnterminatedTemplate
+}
 
-	for l.ch != '"' {
-		if l.Eof() {
-			l.error(errUnterminated.Error())
-			return "", errUnterminated
-		} else if l.ch == '\\' {
-			peekCh := l.peek()
-			if peekCh == EOF {
-				l.error(errEspace.Error())
-				return "", errEspace
+// scanTemplateExpr returns the index of the brace closing the interpolation started at i,
+// skipping over nested braces, strings and templates.
+func scanTemplateExpr(s []rune, i int) (int, error) {
+	depth := 0
+	for ; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return i, nil
 			}
-			l.consume()
-			switch peekCh {
-			case '"':
-				l.tokenBuf.WriteRune('"')
-			case 'u':
-				code := make([]rune, 4)
-				for i := range code {
-					l.consume()
-					if !unicode.Is(unicode.Hex_Digit, l.ch) {
-						l.error(errInvalidChar.Error())
-						return "", errInvalidChar
-					}
-					code[i] = l.ch
+			depth--
+		case '"', '\'':
+			quote := s[i]
+			for i++; i < len(s) && s[i] != quote; i++ {
+				if s[i] == '\\' {
+					i++
 				}
-				l.tokenBuf.WriteRune(charCode2Rune(string(code)))
 			}
-		} else {
-			l.tokenBuf.WriteRune(l.ch)
+		case '`':
+			end, err := scanTemplate(s, i+1)
+			if err != nil {
+				return 0, err
+			}
+			i = end
 		}
-		l.consume()
 	}
-	// end ".
-	l.consume()
-	return l.tokenBuf.String(), nil
+	return 0, errUnterminatedExpr
 }
 
-func (l *Lexer) readNumber() (string, error) {
+// SplitTemplate splits the raw content of a template into its text parts and
+// the source of its interpolations, there is always one more text than sources.
+func SplitTemplate(raw string) (texts []string, sources []string, err error) {
+	s := []rune(raw)
+	var text strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			ch, next, err := readEscape(s, i+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			text.WriteRune(ch)
+			i = next - 1
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '{':
+			end, err := scanTemplateExpr(s, i+2)
+			if err != nil {
+				return nil, nil, err
+			}
+			texts = append(texts, text.String())
+			sources = append(sources, string(s[i+2:end]))
+			text.Reset()
+			i = end
+		default:
+			text.WriteRune(s[i])
+		}
+	}
+	texts = append(texts, text.String())
+	return texts, sources, nil
+}
 
+// readEscape decodes the escape sequence starting at s[i], just after the backslash.
+// It returns the decoded char and the index following the sequence.
+func readEscape(s []rune, i int) (rune, int, error) {
+	if i >= len(s) {
+		return 0, i, errEscape
+	}
+	switch s[i] {
+	case 'n':
+		return '\n', i + 1, nil
+	case 't':
+		return '\t', i + 1, nil
+	case 'r':
+		return '\r', i + 1, nil
+	case '0':
+		return 0, i + 1, nil
+	case '\\', '"', '\'', '`', '$':
+		return s[i], i + 1, nil
+	case 'x':
+		code, next := readHexDigits(s, i+1, 2)
+		if len(code) != 2 {
+			return 0, i, fmt.Errorf("%w \"\\x%s\", expect 2 hex digits", errEscape, code)
+		}
+		return charCode2Rune(code), next, nil
+	case 'u':
+		if i+1 < len(s) && s[i+1] == '{' {
+			code, next := readHexDigits(s, i+2, 6)
+			if len(code) == 0 || next >= len(s) || s[next] != '}' {
+				return 0, i, fmt.Errorf("%w \"\\u{%s\", expect 1 to 6 hex digits and '}'", errEscape, code)
+			}
+			ch := charCode2Rune(code)
+			if !utf8.ValidRune(ch) {
+				return 0, i, fmt.Errorf("%w \"\\u{%s}\", %w", errEscape, code, errInvalidChar)
+			}
+			return ch, next + 1, nil
+		}
+		code, next := readHexDigits(s, i+1, 4)
+		if len(code) != 4 {
+			return 0, i, fmt.Errorf("%w \"\\u%s\", expect 4 hex digits", errEscape, code)
+		}
+		ch := charCode2Rune(code)
+		if !utf8.ValidRune(ch) {
+			return 0, i, fmt.Errorf("%w \"\\u%s\", %w", errEscape, code, errInvalidChar)
+		}
+		return ch, next, nil
+	}
+	return 0, i, fmt.Errorf("%w \"\\%c\"", errEscape, s[i])
+}
+
+// readHexDigits reads at most n hex digits from s[i].
+func readHexDigits(s []rune, i, n int) (string, int) {
+	start := i
+	for ; i < len(s) && i-start < n && unicode.Is(unicode.Hex_Digit, s[i]); i++ {
+	}
+	return string(s[start:i]), i
+}
+
+// readNumber reads a decimal number with optional fraction and exponent, or
+// an integer prefixed by 0x, 0o or 0b. Digits may be separated by '_'.
+// The suffix n makes a bigint, and the suffix d makes a decimal.
+func (l *Lexer) readNumber() (string, error) {
 	l.tokenBuf.Reset()
-	for unicode.IsNumber(l.ch) {
-		l.tokenBuf.WriteRune(l.ch)
-		l.consume()
+	if l.ch == '0' {
+		if base, ok := numberBases[unicode.ToLower(l.peek())]; ok {
+			l.tokenBuf.WriteRune(l.ch)
+			l.consume()
+			l.tokenBuf.WriteRune(l.ch)
+			l.consume()
+			if err := l.readDigits(base); err != nil {
+				return "", err
+			}
+			if l.ch == 'n' {
+				l.tokenBuf.WriteRune(l.ch)
+				l.consume()
+			}
+			return l.tokenBuf.String(), l.checkNumberEnd()
+		}
+	}
+
+	if l.ch != '.' {
+		if err := l.readDigits(10); err != nil {
+			return "", err
+		}
 	}
 
 	if l.ch == '.' {
-		if !unicode.IsNumber(l.peek()) {
+		if !isDigit(l.peek()) {
 			return l.tokenBuf.String(), nil
 		}
 		l.tokenBuf.WriteRune(l.ch)
 		l.consume()
-		for unicode.IsNumber(l.ch) {
-			l.tokenBuf.WriteRune(l.ch)
-			l.consume()
+		if err := l.readDigits(10); err != nil {
+			return "", err
 		}
 	}
 
 	if l.ch == 'E' || l.ch == 'e' {
-		seenPower := false
 		l.tokenBuf.WriteRune(l.ch)
 		l.consume()
 		if l.ch == '+' || l.ch == '-' {
 			l.tokenBuf.WriteRune(l.ch)
 			l.consume()
 		}
-		for unicode.IsNumber(l.ch) {
-			seenPower = true
-			l.tokenBuf.WriteRune(l.ch)
-			l.consume()
-		}
-		if !seenPower {
-			l.error(errLessPower.Error())
+		if !isDigit(l.ch) {
 			return "", errLessPower
 		}
+		if err := l.readDigits(10); err != nil {
+			return "", err
+		}
 	}
 
-	return l.tokenBuf.String(), nil
+	// suffix n for bigint and d for decimal.
+	switch l.ch {
+	case 'n':
+		if strings.ContainsAny(l.tokenBuf.String(), ".eE") {
+			return "", errBigIntSuffix
+		}
+		fallthrough
+	case 'd':
+		l.tokenBuf.WriteRune(l.ch)
+		l.consume()
+	}
+	return l.tokenBuf.String(), l.checkNumberEnd()
+}
+
+// readDigits reads at least one digit of base, '_' is only allowed between digits.
+func (l *Lexer) readDigits(base int) error {
+	name := baseNames[base]
+	seen := false
+	for {
+		switch {
+		case l.ch == '_':
+			if !seen || digitValue(l.peek()) >= base {
+				return errUnderscore
+			}
+		case digitValue(l.ch) < base:
+			seen = true
+		case isDigit(l.ch):
+			return fmt.Errorf("invalid digit %q in %s literal", l.ch, name)
+		default:
+			if !seen {
+				return fmt.Errorf("%s literal has no digits", name)
+			}
+			return nil
+		}
+		l.tokenBuf.WriteRune(l.ch)
+		l.consume()
+	}
+}
+
+// checkNumberEnd reports the letters sticking to a number, such as 123abc.
+func (l *Lexer) checkNumberEnd() error {
+	if isAlphaNumeric(l.ch) {
+		return fmt.Errorf("invalid character %q in number literal", l.ch)
+	}
+	return nil
 }
 
 // NextToken reads and returns token and literal.
-// It returns token.Illegal for invalid string or number.
+// It returns token.Illegal with the error message as literal for invalid string or number.
 // It return token.EOF at the end of input string.
 func (l *Lexer) NextToken() (tok token.Token, literal string) {
 	l.skip()
@@ -210,8 +487,30 @@ func (l *Lexer) NextToken() (tok token.Token, literal string) {
 		tok = token.Comma
 		literal = ","
 	case '.':
-		tok = token.Dot
-		literal = "."
+		if isDigit(l.peek()) {
+			liter, err := l.readNumber()
+			if err != nil {
+				return token.Illegal, err.Error()
+			}
+			return token.Number, liter
+		} else if l.peek() == '.' && l.peekAt(1) == '.' {
+			l.consume()
+			l.consume()
+			tok = token.Ellipsis
+			literal = "..."
+		} else if l.peek() == '.' && l.peekAt(1) == '=' {
+			l.consume()
+			l.consume()
+			tok = token.DotDotEqual
+			literal = "..="
+		} else if l.peek() == '.' {
+			l.consume()
+			tok = token.DotDot
+			literal = ".."
+		} else {
+			tok = token.Dot
+			literal = "."
+		}
 	case '-':
 		tok = token.Minus
 		literal = "-"
@@ -221,6 +520,9 @@ func (l *Lexer) NextToken() (tok token.Token, literal string) {
 	case ';':
 		tok = token.Semicolon
 		literal = ";"
+	case ':':
+		tok = token.Colon
+		literal = ":"
 	case '/':
 		tok = token.Slash
 		literal = "/"
@@ -231,15 +533,30 @@ func (l *Lexer) NextToken() (tok token.Token, literal string) {
 		if l.match('=') {
 			tok = token.BangEqual
 			literal = "!="
+			if l.ch == '=' {
+				l.consume()
+				tok = token.BangEqualEqual
+				literal = "!=="
+			}
 		} else {
 			tok = token.Bang
 			literal = "!"
 		}
 		return
 	case '=':
+		if l.ch == '=' && l.peek() == '>' {
+			l.consume()
+			l.consume()
+			return token.Arrow, "=>"
+		}
 		if l.match('=') {
 			tok = token.EqualEqual
 			literal = "=="
+			if l.ch == '=' {
+				l.consume()
+				tok = token.EqualEqualEqual
+				literal = "==="
+			}
 		} else {
 			tok = token.Equal
 			literal = "="
@@ -263,26 +580,36 @@ func (l *Lexer) NextToken() (tok token.Token, literal string) {
 			literal = "<"
 		}
 		return
-	case '"':
-		liter, err := l.readString()
+	case '"', '\'':
+		return l.stringToken(false)
+	case '`':
+		liter, err := l.readTemplate()
 		if err != nil {
-			return token.Illegal, liter
+			return token.Illegal, err.Error()
 		}
-		tok = token.String
+		tok = token.Template
 		literal = liter
 		return
 	case EOF:
 		tok = token.EOF
 		return
 	default:
-		if unicode.IsLetter(l.ch) {
+		if l.ch == 'r' && (l.peek() == '"' || l.peek() == '\'') {
+			l.consume()
+			return l.stringToken(true)
+		} else if unicode.IsLetter(l.ch) || l.ch == '_' {
 			literal = l.readIdentifier()
 			tok = token.Lookup(literal)
 			return
-		} else if unicode.IsNumber(l.ch) {
+		} else if l.ch == '#' && (unicode.IsLetter(l.peek()) || l.peek() == '_') {
+			l.consume()
+			literal = "#" + l.readIdentifier()
+			tok = token.PrivateName
+			return
+		} else if isDigit(l.ch) {
 			liter, err := l.readNumber()
 			if err != nil {
-				return token.Illegal, ""
+				return token.Illegal, err.Error()
 			}
 			tok = token.Number
 			literal = liter
@@ -297,6 +624,22 @@ func (l *Lexer) NextToken() (tok token.Token, literal string) {
 	return
 }
 
+func (l *Lexer) stringToken(raw bool) (token.Token, string) {
+	literal, err := l.readString(raw)
+	if err != nil {
+		return token.Illegal, err.Error()
+	}
+	return token.String, literal
+}
+
+// PeekToken returns the next token and literal without consuming them.
+func (l *Lexer) PeekToken() (token.Token, string) {
+	saved := *l
+	tok, literal := l.NextToken()
+	*l = saved
+	return tok, literal
+}
+
 // Pos returns current position of lexer.
 func (l *Lexer) Pos() int {
 	return l.currIndex
@@ -310,6 +653,19 @@ func charCode2Rune(code string) rune {
 	return rune(v)
 }
 
+func isDigit(ch rune) bool { return '0' <= ch && ch <= '9' }
+
+// digitValue returns the value of a hex digit, or 16 for the others.
+func digitValue(ch rune) int {
+	switch {
+	case isDigit(ch):
+		return int(ch - '0')
+	case 'a' <= unicode.ToLower(ch) && unicode.ToLower(ch) <= 'f':
+		return int(unicode.ToLower(ch)-'a') + 10
+	}
+	return 16
+}
+
 func isAlphaNumeric(ch rune) bool { return unicode.IsLetter(ch) || unicode.IsNumber(ch) || ch == '_' }
 
 // New return an instance of Lexer.
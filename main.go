@@ -5,12 +5,16 @@ import (
 	"os"
 	"tiny-script/lox/repl"
 
+	"tiny-script/checker"
 	"tiny-script/interpreter"
 	"tiny-script/lexer"
 	"tiny-script/parser"
 )
 
 func main() {
+	if len(os.Args) >= 3 && os.Args[1] == "check" {
+		os.Exit(check(os.Args[2]))
+	}
 	if len(os.Args) >= 2 {
 		name := os.Args[1]
 		b, err := os.ReadFile(name)
@@ -30,3 +34,24 @@ func main() {
 	_, _ = fmt.Fprintln(os.Stdout, "Type \"exit\" to exit.")
 	repl.Start(os.Stdin, os.Stdout)
 }
+
+// check reports the type errors of a script without running it, the exit
+// code is 1 if there are any.
+func check(name string) int {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		panic(err)
+	}
+	statements, err := parser.New(lexer.New(string(b))).Parse()
+	if err != nil {
+		return 1
+	}
+	errs := checker.Check(statements)
+	for _, err := range errs {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+	}
+	if len(errs) != 0 {
+		return 1
+	}
+	return 0
+}
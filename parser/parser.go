@@ -19,6 +19,8 @@ type Parser struct {
 
 	trace  bool
 	indent int
+
+	yieldSeen bool // whether the function being parsed contains yield
 }
 
 func (p *Parser) nextToken() token.Token {
@@ -52,18 +54,37 @@ func (p *Parser) Parse() (statements []ast.Stmt, err error) {
 }
 
 func (p *Parser) parseDeclaration() ast.Stmt {
-	if p.match(token.Var) {
-		return p.parseVarDeclaration()
-	}
-	if p.match(token.Let) {
-		return p.parseLetDeclaration()
+	if kind := p.tok; p.match(token.Var, token.Let, token.Const) {
+		if p.check(token.LeftBracket) || p.check(token.LeftBrace) {
+			return p.parseDestructureDeclaration(kind, p.parsePattern())
+		}
+		switch kind {
+		case token.Var:
+			return p.parseVarDeclaration()
+		case token.Let:
+			return p.parseLetDeclaration()
+		default:
+			return p.parseConstDeclaration()
+		}
 	}
 	if p.match(token.Function) {
 		return p.parseFunDeclaration()
 	}
+	if p.match(token.Async) {
+		p.expect(token.Function, "Expect 'function' after 'async'.")
+		fun := p.parseFunDeclaration()
+		fun.IsAsync = true
+		return fun
+	}
 	if p.match(token.Class) {
 		return p.parseClassDeclaration()
 	}
+	if p.match(token.Enum) {
+		return p.parseEnumDeclaration()
+	}
+	if p.match(token.Trait) {
+		return p.parseTraitDeclaration()
+	}
 	if p.match(token.Import) {
 		return p.parseImportDeclaration()
 	}
@@ -77,6 +98,7 @@ func (p *Parser) parseLetDeclaration() *ast.LetStmt {
 		Name: &ast.Ident{
 			Name: name,
 		},
+		Type: p.parseAnnotation(),
 	}
 	var initializer ast.Expr
 	if p.match(token.Equal) {
@@ -87,6 +109,97 @@ func (p *Parser) parseLetDeclaration() *ast.LetStmt {
 	return stmt
 }
 
+func (p *Parser) parseConstDeclaration() *ast.ConstStmt {
+	name := p.lit
+	p.expect(token.Identifier, "Expect constant name.")
+	typ := p.parseAnnotation()
+	p.expect(token.Equal, "Missing initializer in const declaration.")
+	initializer := p.parseExpression()
+	p.expect(token.Semicolon, "Expect ';' after constant declaration.")
+	return &ast.ConstStmt{
+		Name: &ast.Ident{
+			Name: name,
+		},
+		Type:        typ,
+		Initializer: initializer,
+	}
+}
+
+// parseDestructureDeclaration parses the rest of declaration such as let [a, b] = arr;
+func (p *Parser) parseDestructureDeclaration(kind token.Token, pattern ast.Pattern) *ast.DestructureStmt {
+	p.expect(token.Equal, "Missing initializer in destructuring declaration.")
+	initializer := p.parseExpression()
+	p.expect(token.Semicolon, "Expect ';' after variable declaration.")
+	return &ast.DestructureStmt{
+		Kind:        kind,
+		Pattern:     pattern,
+		Initializer: initializer,
+	}
+}
+
+// parsePattern parses a declaration pattern, such as a, [a, ...rest] or {x, y: [a, b]}.
+func (p *Parser) parsePattern() ast.Pattern {
+	switch {
+	case p.match(token.LeftBracket):
+		pattern := &ast.ArrayPattern{Elements: make([]ast.Pattern, 0)}
+		for !p.check(token.RightBracket) {
+			if p.match(token.Ellipsis) {
+				pattern.Rest = p.parsePattern()
+				break
+			}
+			pattern.Elements = append(pattern.Elements, p.parsePattern())
+			if !p.match(token.Comma) {
+				break
+			}
+		}
+		p.expect(token.RightBracket, "Expect ']' after array pattern.")
+		return pattern
+	case p.match(token.LeftBrace):
+		pattern := &ast.ObjectPattern{Fields: make([]*ast.FieldPattern, 0)}
+		for !p.check(token.RightBrace) {
+			key := p.lit
+			p.expect(token.Identifier, "Expect field name in object pattern.")
+			var value ast.Pattern = &ast.Ident{Name: key}
+			if p.match(token.Colon) {
+				value = p.parsePattern()
+			}
+			pattern.Fields = append(pattern.Fields, &ast.FieldPattern{Key: key, Value: value})
+			if !p.match(token.Comma) {
+				break
+			}
+		}
+		p.expect(token.RightBrace, "Expect '}' after object pattern.")
+		return pattern
+	default:
+		name := p.lit
+		p.expect(token.Identifier, "Expect variable name.")
+		return &ast.Ident{Name: name}
+	}
+}
+
+// toAssignPattern converts the left side of [a, b] = [b, a] to a pattern.
+func (p *Parser) toAssignPattern(expr ast.Expr) ast.Pattern {
+	switch e := expr.(type) {
+	case *ast.VariableExpr, *ast.GetExpr, *ast.IndexExpr:
+		return e.(ast.Pattern)
+	case *ast.ArrayLiteralExpr:
+		pattern := &ast.ArrayPattern{Elements: make([]ast.Pattern, 0, len(e.Elements))}
+		for i, element := range e.Elements {
+			if spread, ok := element.(*ast.SpreadExpr); ok {
+				if i != len(e.Elements)-1 {
+					p.error("Rest element must be last.")
+				}
+				pattern.Rest = p.toAssignPattern(spread.Expression)
+				break
+			}
+			pattern.Elements = append(pattern.Elements, p.toAssignPattern(element))
+		}
+		return pattern
+	}
+	p.error("Invalid assignment target.")
+	return nil
+}
+
 func (p *Parser) parseVarDeclaration() *ast.VarStmt {
 	name := p.lit
 	p.expect(token.Identifier, "Expect variable name.")
@@ -94,6 +207,7 @@ func (p *Parser) parseVarDeclaration() *ast.VarStmt {
 		Name: &ast.Ident{
 			Name: name,
 		},
+		Type: p.parseAnnotation(),
 	}
 	var initializer ast.Expr
 	if p.match(token.Equal) {
@@ -107,51 +221,275 @@ func (p *Parser) parseVarDeclaration() *ast.VarStmt {
 func (p *Parser) parseFunDeclaration() *ast.FunctionStmt {
 	name := p.lit
 	p.expect(token.Identifier, "Expect function name.")
+	return p.parseFunction(name)
+}
+
+// parseFunction parses the params and the body of the function name.
+func (p *Parser) parseFunction(name string) *ast.FunctionStmt {
 	p.expect(token.LeftParen, "Expect '(' after function name.")
+	return p.parseFunctionBody(name, p.parseParams())
+}
+
+func (p *Parser) parseFunctionBody(name string, params []*ast.Param) *ast.FunctionStmt {
 	fun := &ast.FunctionStmt{
-		Name:   name,
-		Params: make([]*ast.Ident, 0),
-		Body:   make([]ast.Stmt, 0),
+		Name:       name,
+		Params:     params,
+		Body:       make([]ast.Stmt, 0),
+		ReturnType: p.parseAnnotation(),
 	}
-	if !p.match(token.RightParen) {
-		for {
-			lit := p.lit
-			p.expect(token.Identifier, "Expect parameter name.")
-			if len(fun.Params) >= 255 {
-				p.error("Cannot have more than 255 parameters.")
+	p.expect(token.LeftBrace, "Expect '{' before function body.")
+	// a function containing yield is a generator, yield of nested functions is not counted.
+	enclosingYield := p.yieldSeen
+	p.yieldSeen = false
+	fun.Body = p.parseBlockStatement().Statements
+	fun.IsGenerator = p.yieldSeen
+	p.yieldSeen = enclosingYield
+	return fun
+}
+
+// parseParams parses parameters such as (a, b = 10, ...args) after '('.
+func (p *Parser) parseParams() []*ast.Param {
+	params := make([]*ast.Param, 0)
+	if p.match(token.RightParen) {
+		return params
+	}
+	for {
+		if len(params) >= 255 {
+			p.error("Cannot have more than 255 parameters.")
+		}
+		rest := p.match(token.Ellipsis)
+		param := &ast.Param{Rest: rest}
+		pattern := p.parsePattern()
+		if ident, ok := pattern.(*ast.Ident); ok {
+			param.Name = ident.Name
+		} else {
+			param.Pattern = pattern
+		}
+		param.Type = p.parseAnnotation()
+		if rest {
+			if p.check(token.Equal) {
+				p.error("Rest parameter cannot have a default value.")
 			}
-			ident := &ast.Ident{Name: lit}
-			fun.Params = append(fun.Params, ident)
-			if !p.match(token.Comma) {
-				break
+			if !p.check(token.RightParen) {
+				p.error("Rest parameter must be last.")
 			}
+		} else if p.match(token.Equal) {
+			param.Default = p.parseExpression()
+		} else if len(params) > 0 && params[len(params)-1].Default != nil {
+			p.error("Non-default parameter follows default parameter.")
+		}
+		params = append(params, param)
+		if !p.match(token.Comma) {
+			break
 		}
-		// return fun
-		p.expect(token.RightParen, "Expect ')' after parameters.")
 	}
-	p.expect(token.LeftBrace, "Expect '{' before function body.")
-	fun.Body = p.parseBlockStatement().Statements
-	return fun
+	p.expect(token.RightParen, "Expect ')' after parameters.")
+	return params
 }
 
 func (p *Parser) parseClassDeclaration() *ast.ClassStmt {
 	name := p.lit
 	p.expect(token.Identifier, "Expect class name.")
+	class := &ast.ClassStmt{
+		Name:    name,
+		Methods: make([]*ast.FunctionStmt, 0),
+	}
+	if p.match(token.With) {
+		for {
+			class.Traits = append(class.Traits, &ast.VariableExpr{Name: p.lit, Distance: -1})
+			p.expect(token.Identifier, "Expect trait name.")
+			if !p.match(token.Comma) {
+				break
+			}
+		}
+	}
 	p.expect(token.LeftBrace, "Expect '{' after class name.")
 
-	methods := make([]*ast.FunctionStmt, 0)
-	for p.check(token.Identifier) {
-		method := p.parseFunDeclaration()
-		method.IsInitializer = method.Name == "init"
-		methods = append(methods, method)
+	// members maps the names of instance and static members to their kinds,
+	// only a getter and a setter may share a name.
+	members := map[bool]map[string]string{false: {}, true: {}}
+	declare := func(static bool, name, kind string) {
+		prev, ok := members[static][name]
+		if ok && !(prev == "get" && kind == "set" || prev == "set" && kind == "get") {
+			p.error(fmt.Sprintf("Duplicate class member %q.", name))
+		}
+		members[static][name] = kind
+	}
+	for !p.check(token.RightBrace) && !p.isAtEnd() {
+		static := p.match(token.Static)
+		async := p.match(token.Async)
+		next, _ := p.l.PeekToken()
+		switch {
+		case !async && p.check(token.Identifier) && (p.lit == "get" || p.lit == "set") && next == token.Identifier:
+			kind := p.lit
+			if static {
+				p.error("Static accessors are not supported.")
+			}
+			p.nextToken()
+			accessor := p.parseFunDeclaration()
+			declare(false, accessor.Name, kind)
+			if kind == "get" {
+				if len(accessor.Params) != 0 {
+					p.error("Getter must have no parameters.")
+				}
+				class.Getters = append(class.Getters, accessor)
+			} else {
+				if len(accessor.Params) != 1 || accessor.Params[0].Rest || accessor.Params[0].Default != nil {
+					p.error("Setter must have exactly one parameter.")
+				}
+				class.Setters = append(class.Setters, accessor)
+			}
+		case static && p.check(token.PrivateName):
+			p.error("Static members cannot be private.")
+		case !async && (p.check(token.Identifier) || p.check(token.PrivateName)) && next != token.LeftParen:
+			field := &ast.FieldDecl{Name: p.lit}
+			p.nextToken()
+			field.Type = p.parseAnnotation()
+			declare(static, field.Name, "field")
+			if p.match(token.Equal) {
+				field.Initializer = p.parseExpression()
+			}
+			p.expect(token.Semicolon, "Expect ';' after field declaration.")
+			if static {
+				class.StaticFields = append(class.StaticFields, field)
+			} else {
+				class.Fields = append(class.Fields, field)
+			}
+		default:
+			var method *ast.FunctionStmt
+			if name := p.lit; p.match(token.PrivateName) {
+				method = p.parseFunction(name)
+			} else {
+				method = p.parseFunDeclaration()
+			}
+			declare(static, method.Name, "method")
+			method.IsAsync = async
+			if static {
+				class.StaticMethods = append(class.StaticMethods, method)
+			} else {
+				method.IsInitializer = method.Name == "init"
+				class.Methods = append(class.Methods, method)
+			}
+		}
 	}
 
 	p.expect(token.RightBrace, "Expect '}' after class block.")
+	return class
+}
 
-	return &ast.ClassStmt{
-		Name:    name,
-		Methods: methods,
+// parseAnnotation parses the type annotation after ':', if any.
+func (p *Parser) parseAnnotation() ast.TypeExpr {
+	if !p.match(token.Colon) {
+		return nil
+	}
+	return p.parseType()
+}
+
+// parseType parses a type such as number, Point[], (int | string)[] or string | nil.
+func (p *Parser) parseType() ast.TypeExpr {
+	typ := p.parseArrayType()
+	if !p.check(token.Or) {
+		return typ
+	}
+	union := &ast.UnionType{Types: []ast.TypeExpr{typ}}
+	for p.match(token.Or) {
+		union.Types = append(union.Types, p.parseArrayType())
+	}
+	return union
+}
+
+func (p *Parser) parseArrayType() ast.TypeExpr {
+	var typ ast.TypeExpr
+	switch {
+	case p.match(token.LeftParen):
+		typ = p.parseType()
+		p.expect(token.RightParen, "Expect ')' after type.")
+	case p.check(token.Identifier) || p.check(token.Nil) || p.check(token.Function) || p.check(token.Enum) || p.check(token.Class) || p.check(token.Trait):
+		typ = &ast.NamedType{Name: p.lit}
+		p.nextToken()
+	default:
+		p.error("Expect type.")
+	}
+	for p.match(token.LeftBracket) {
+		p.expect(token.RightBracket, "Expect ']' after '[' in array type.")
+		typ = &ast.ArrayType{Element: typ}
 	}
+	return typ
+}
+
+// parseTraitDeclaration parses a trait, a method without a body ends with ';'
+// and must be implemented by the classes using the trait.
+func (p *Parser) parseTraitDeclaration() *ast.TraitStmt {
+	trait := &ast.TraitStmt{Name: p.lit}
+	p.expect(token.Identifier, "Expect trait name.")
+	p.expect(token.LeftBrace, "Expect '{' after trait name.")
+	seen := make(map[string]bool)
+	for !p.check(token.RightBrace) && !p.isAtEnd() {
+		async := p.match(token.Async)
+		name := p.lit
+		p.expect(token.Identifier, "Expect method name.")
+		if name == "init" {
+			p.error("A trait cannot declare an initializer.")
+		}
+		if seen[name] {
+			p.error(fmt.Sprintf("Duplicate trait method %q.", name))
+		}
+		seen[name] = true
+		p.expect(token.LeftParen, "Expect '(' after method name.")
+		params := p.parseParams()
+		returnType := p.parseAnnotation()
+		if p.match(token.Semicolon) {
+			if async {
+				p.error("A required method cannot be async.")
+			}
+			trait.Required = append(trait.Required, &ast.FunctionStmt{Name: name, Params: params, ReturnType: returnType})
+			continue
+		}
+		method := p.parseFunctionBody(name, params)
+		method.IsAsync = async
+		method.ReturnType = returnType
+		trait.Methods = append(trait.Methods, method)
+	}
+	p.expect(token.RightBrace, "Expect '}' after trait body.")
+	return trait
+}
+
+// parseEnumDeclaration parses enum Color { Red, Green = 2, Circle(r) } after 'enum'.
+func (p *Parser) parseEnumDeclaration() *ast.EnumStmt {
+	stmt := &ast.EnumStmt{Name: p.lit, Variants: make([]*ast.EnumVariant, 0)}
+	p.expect(token.Identifier, "Expect enum name.")
+	p.expect(token.LeftBrace, "Expect '{' after enum name.")
+	seen := make(map[string]bool)
+	for !p.check(token.RightBrace) {
+		variant := &ast.EnumVariant{Name: p.lit}
+		p.expect(token.Identifier, "Expect variant name.")
+		if seen[variant.Name] {
+			p.error(fmt.Sprintf("Duplicate enum variant %q.", variant.Name))
+		}
+		if variant.Name == "values" {
+			p.error("Enum variant cannot be named values.")
+		}
+		seen[variant.Name] = true
+		if p.match(token.LeftParen) {
+			variant.Params = make([]string, 0)
+			for !p.check(token.RightParen) {
+				variant.Params = append(variant.Params, p.lit)
+				p.expect(token.Identifier, "Expect field name of variant.")
+				if !p.match(token.Comma) {
+					break
+				}
+			}
+			p.expect(token.RightParen, "Expect ')' after variant fields.")
+		} else if p.match(token.Equal) {
+			variant.Value = p.parseExpression()
+		}
+		stmt.Variants = append(stmt.Variants, variant)
+		if !p.match(token.Comma) {
+			break
+		}
+	}
+	p.expect(token.RightBrace, "Expect '}' after enum variants.")
+	return stmt
 }
 
 func (p *Parser) parseImportDeclaration() *ast.ImportStmt {
@@ -191,6 +529,18 @@ func (p *Parser) parseStatement() ast.Stmt {
 	if p.match(token.Return) {
 		return p.parseReturnStatement()
 	}
+	if p.match(token.Defer) {
+		stmt := &ast.DeferStmt{Expression: p.parseExpression()}
+		p.expect(token.Semicolon, "Expect ';' after deferred expression.")
+		return stmt
+	}
+	if p.match(token.Select) {
+		return p.parseSelectStatement()
+	}
+	if p.match(token.Match) {
+		value, arms := p.parseMatch(false)
+		return &ast.MatchStmt{Value: value, Arms: arms}
+	}
 	if p.match(token.Import) {
 		return p.parseImportDeclaration()
 	}
@@ -235,12 +585,24 @@ func (p *Parser) parseWhileStatement() ast.Stmt {
 func (p *Parser) parseForStatement() ast.Stmt {
 	p.expect(token.LeftParen, "Expect '(' after 'for'.")
 	var initializer ast.Stmt
-	if !p.match(token.Semicolon) {
-		if p.match(token.Var, token.Let) {
+	if kind := p.tok; p.check(token.Var) || p.check(token.Let) || p.check(token.Const) {
+		p.nextToken()
+		if next, _ := p.l.PeekToken(); p.check(token.Identifier) && next == token.In ||
+			p.check(token.LeftBracket) || p.check(token.LeftBrace) {
+			target := p.parsePattern()
+			if p.match(token.In) {
+				return p.finishForIn(kind, target)
+			}
+			initializer = p.parseDestructureDeclaration(kind, target)
+		} else if kind == token.Var {
 			initializer = p.parseVarDeclaration()
+		} else if kind == token.Let {
+			initializer = p.parseLetDeclaration()
 		} else {
-			initializer = p.parseExprStatement()
+			initializer = p.parseConstDeclaration()
 		}
+	} else if !p.match(token.Semicolon) {
+		initializer = p.parseExprStatement()
 	}
 
 	var condition ast.Expr
@@ -289,6 +651,201 @@ func (p *Parser) parseForStatement() ast.Stmt {
 	return body
 }
 
+// finishForIn parses the rest of for (let x in iterable) body after 'in'.
+func (p *Parser) finishForIn(kind token.Token, target ast.Pattern) ast.Stmt {
+	iterable := p.parseExpression()
+	p.expect(token.RightParen, "Expect ')' after for-in clause.")
+	return &ast.ForInStmt{
+		Kind:     kind,
+		Target:   target,
+		Iterable: iterable,
+		Body:     p.parseStatement(),
+	}
+}
+
+// parseSelectStatement parses select { case let v = ch.recv() {} case ch.send(x) {} default {} }.
+func (p *Parser) parseSelectStatement() ast.Stmt {
+	p.expect(token.LeftBrace, "Expect '{' after 'select'.")
+	stmt := &ast.SelectStmt{Cases: make([]*ast.SelectCase, 0)}
+	for !p.check(token.RightBrace) && !p.isAtEnd() {
+		if p.match(token.Default) {
+			if stmt.Default != nil {
+				p.error("Multiple defaults in select.")
+			}
+			p.expect(token.LeftBrace, "Expect '{' after 'default'.")
+			stmt.Default = p.parseBlockStatement()
+			continue
+		}
+		p.expect(token.Case, "Expect 'case' or 'default' in select.")
+		c := &ast.SelectCase{}
+		if p.match(token.Let) {
+			c.Name = p.lit
+			p.expect(token.Identifier, "Expect variable name.")
+			p.expect(token.Equal, "Expect '=' after variable name.")
+		}
+		c.Comm, _ = p.parseExpression().(*ast.CallExpr)
+		if !isChannelOperation(c) {
+			p.error("Select case must be ch.recv() or ch.send(v).")
+		}
+		p.expect(token.LeftBrace, "Expect '{' after select case.")
+		c.Body = p.parseBlockStatement()
+		stmt.Cases = append(stmt.Cases, c)
+	}
+	p.expect(token.RightBrace, "Expect '}' after select.")
+	return stmt
+}
+
+// parseMatch parses (value) { pattern if guard => body ... } after 'match', the body of
+// an arm is a statement, or an expression followed by ',' in a match expression.
+func (p *Parser) parseMatch(isExpr bool) (ast.Expr, []*ast.MatchArm) {
+	p.expect(token.LeftParen, "Expect '(' after 'match'.")
+	value := p.parseExpression()
+	p.expect(token.RightParen, "Expect ')' after match value.")
+	p.expect(token.LeftBrace, "Expect '{' before match arms.")
+	arms := make([]*ast.MatchArm, 0)
+	for !p.check(token.RightBrace) && !p.isAtEnd() {
+		arm := &ast.MatchArm{Pattern: p.parseMatchPattern()}
+		if p.match(token.If) {
+			arm.Guard = p.parseExpression()
+		}
+		p.expect(token.Arrow, "Expect '=>' after match pattern.")
+		if isExpr {
+			arm.Body = p.parseExpression()
+		} else {
+			arm.Body = p.parseStatement()
+		}
+		arms = append(arms, arm)
+		if isExpr && !p.match(token.Comma) {
+			break
+		}
+	}
+	p.expect(token.RightBrace, "Expect '}' after match arms.")
+	return value, arms
+}
+
+// parseMatchPattern parses a pattern with alternatives, such as 1 | 2 | 3.
+func (p *Parser) parseMatchPattern() ast.MatchPattern {
+	pattern := p.parsePrimaryPattern()
+	if !p.check(token.Or) {
+		return pattern
+	}
+	or := &ast.OrPattern{Alternatives: []ast.MatchPattern{pattern}}
+	for p.match(token.Or) {
+		or.Alternatives = append(or.Alternatives, p.parsePrimaryPattern())
+	}
+	return or
+}
+
+func (p *Parser) parsePrimaryPattern() ast.MatchPattern {
+	switch name := p.lit; {
+	case p.match(token.LeftBracket):
+		list := &ast.ListPattern{Elements: make([]ast.MatchPattern, 0)}
+		for !p.check(token.RightBracket) {
+			if p.match(token.Ellipsis) {
+				list.Rest = p.parsePrimaryPattern()
+				switch list.Rest.(type) {
+				case *ast.BindingPattern, *ast.WildcardPattern:
+				default:
+					p.error("Rest pattern must be a name or _.")
+				}
+				break
+			}
+			list.Elements = append(list.Elements, p.parseMatchPattern())
+			if !p.match(token.Comma) {
+				break
+			}
+		}
+		p.expect(token.RightBracket, "Expect ']' after array pattern.")
+		return list
+	case p.check(token.LeftBrace):
+		return p.parseFieldsPattern(nil)
+	case p.match(token.Identifier):
+		if p.match(token.Dot) {
+			return p.parseEnumPattern(&ast.VariableExpr{Name: name, Distance: -1})
+		}
+		if p.check(token.LeftBrace) {
+			return p.parseFieldsPattern(&ast.VariableExpr{Name: name, Distance: -1})
+		}
+		if name == "_" {
+			return &ast.WildcardPattern{}
+		}
+		return &ast.BindingPattern{Name: name}
+	}
+	value := p.parsePatternValue()
+	if inclusive := p.check(token.DotDotEqual); p.match(token.DotDot, token.DotDotEqual) {
+		return &ast.RangePattern{Low: value, High: p.parsePatternValue(), Inclusive: inclusive}
+	}
+	return &ast.ValuePattern{Value: value}
+}
+
+// parseEnumPattern parses Circle(r) of Shape.Circle(r) after 'Shape.'.
+func (p *Parser) parseEnumPattern(enum *ast.VariableExpr) ast.MatchPattern {
+	pattern := &ast.EnumPattern{Enum: enum, Variant: p.lit}
+	p.expect(token.Identifier, "Expect variant name after '.'.")
+	if p.match(token.LeftParen) {
+		pattern.Args = make([]ast.MatchPattern, 0)
+		for !p.check(token.RightParen) {
+			pattern.Args = append(pattern.Args, p.parseMatchPattern())
+			if !p.match(token.Comma) {
+				break
+			}
+		}
+		p.expect(token.RightParen, "Expect ')' after variant patterns.")
+	}
+	return pattern
+}
+
+// parseFieldsPattern parses {x: 0, y} of an instance pattern, class is nil if the
+// pattern is not typed.
+func (p *Parser) parseFieldsPattern(class *ast.VariableExpr) ast.MatchPattern {
+	p.expect(token.LeftBrace, "Expect '{' before field patterns.")
+	pattern := &ast.FieldsPattern{Class: class, Fields: make([]*ast.FieldMatch, 0)}
+	for !p.check(token.RightBrace) {
+		key := p.lit
+		p.expect(token.Identifier, "Expect field name in field pattern.")
+		var value ast.MatchPattern = &ast.BindingPattern{Name: key}
+		if p.match(token.Colon) {
+			value = p.parseMatchPattern()
+		}
+		pattern.Fields = append(pattern.Fields, &ast.FieldMatch{Key: key, Pattern: value})
+		if !p.match(token.Comma) {
+			break
+		}
+	}
+	p.expect(token.RightBrace, "Expect '}' after field patterns.")
+	return pattern
+}
+
+// parsePatternValue parses the literal of a value or range pattern, numbers may be negative.
+func (p *Parser) parsePatternValue() ast.Expr {
+	if p.match(token.Minus) {
+		lit := p.lit
+		p.expect(token.Number, "Expect number after '-' in pattern.")
+		return &ast.UnaryExpr{Operator: token.Minus, Right: &ast.Literal{Token: token.Number, Value: lit}}
+	}
+	switch tok, lit := p.tok, p.lit; tok {
+	case token.Number, token.String, token.True, token.False, token.Nil:
+		p.nextToken()
+		return &ast.Literal{Token: tok, Value: lit}
+	}
+	p.error("Expect pattern.")
+	return nil
+}
+
+// isChannelOperation reports whether the case receives with ch.recv() or sends with ch.send(v),
+// only a received value can be bound.
+func isChannelOperation(c *ast.SelectCase) bool {
+	if c.Comm == nil {
+		return false
+	}
+	get, ok := c.Comm.Callee.(*ast.GetExpr)
+	if !ok {
+		return false
+	}
+	args := len(c.Comm.Arguments)
+	return get.Name == "recv" && args == 0 || get.Name == "send" && args == 1 && c.Name == ""
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStmt {
 	statements := make([]ast.Stmt, 0)
 	for !(p.check(token.RightBrace) || p.isAtEnd()) {
@@ -312,6 +869,14 @@ func (p *Parser) parseReturnStatement() ast.Stmt {
 	stmt := &ast.ReturnStmt{}
 	if !p.match(token.Semicolon) {
 		stmt.Value = p.parseExpression()
+		// return a, b; returns multiple values as an array.
+		if p.check(token.Comma) {
+			values := []ast.Expr{stmt.Value}
+			for p.match(token.Comma) {
+				values = append(values, p.parseExpression())
+			}
+			stmt.Value = &ast.ArrayLiteralExpr{Elements: values, Distance: -1}
+		}
 		p.expect(token.Semicolon, "Expect ';' after return value.")
 	}
 	return stmt
@@ -321,7 +886,21 @@ func (p *Parser) parseExpression() ast.Expr {
 	return p.parseAssignment()
 }
 
+func (p *Parser) parseYield() ast.Expr {
+	p.yieldSeen = true
+	expr := &ast.YieldExpr{}
+	switch p.tok {
+	case token.Semicolon, token.RightParen, token.RightBracket, token.RightBrace, token.Comma, token.Colon, token.EOF:
+	default:
+		expr.Value = p.parseAssignment()
+	}
+	return expr
+}
+
 func (p *Parser) parseAssignment() ast.Expr {
+	if p.match(token.Yield) {
+		return p.parseYield()
+	}
 	expr := p.parseOr()
 	if p.match(token.Equal) {
 		// recursive call.
@@ -340,33 +919,16 @@ func (p *Parser) parseAssignment() ast.Expr {
 				Name:   e.Name,
 				Value:  v,
 			}
-		}
-	} else if p.match(token.LeftBracket) {
-		index := p.parseExpression()
-		p.expect(token.RightBracket, "Expect ']' after index.")
-
-		oldExpr := expr
-
-		switch index.(type) {
-		case *ast.VariableExpr:
-			expr = &ast.IndexVariableExpr{
-				Name:  index.String(),
-				Left:  expr,
-				Index: index,
-			}
-		case *ast.Literal:
-			expr = &ast.IndexLiteralExpr{
-				Left:  expr,
-				Index: index,
+		case *ast.IndexExpr:
+			return &ast.IndexSetExpr{
+				Object: e.Object,
+				Index:  e.Index,
+				Value:  v,
 			}
-		}
-
-		if p.match(token.Equal) { // 数组赋值
-			val := p.parseAssignment()
-			return &ast.ArrayAssignExpr{
-				Left:  oldExpr.(*ast.VariableExpr),
-				Value: val,
-				Index: expr,
+		case *ast.ArrayLiteralExpr:
+			return &ast.PatternAssignExpr{
+				Pattern: p.toAssignPattern(e).(*ast.ArrayPattern),
+				Value:   v,
 			}
 		}
 	}
@@ -402,7 +964,7 @@ func (p *Parser) parseAnd() ast.Expr {
 func (p *Parser) parseEquality() ast.Expr {
 	expr := p.parseComparison()
 	operator := p.tok
-	for p.match(token.EqualEqual, token.BangEqual) {
+	for p.match(token.EqualEqual, token.BangEqual, token.EqualEqualEqual, token.BangEqualEqual) {
 		right := p.parseComparison()
 		expr = &ast.BinaryExpr{
 			Left:     expr,
@@ -417,7 +979,7 @@ func (p *Parser) parseEquality() ast.Expr {
 func (p *Parser) parseComparison() ast.Expr {
 	expr := p.parseAddition()
 	operator := p.tok
-	for p.match(token.Greater, token.GreaterEqual, token.Less, token.LessEqual) {
+	for p.match(token.Greater, token.GreaterEqual, token.Less, token.LessEqual, token.Is) {
 		right := p.parseAddition()
 		expr = &ast.BinaryExpr{
 			Left:     expr,
@@ -468,19 +1030,33 @@ func (p *Parser) parseUnary() ast.Expr {
 			Right:    right,
 		}
 	}
+	if p.match(token.Await) {
+		return &ast.AwaitExpr{Value: p.parseUnary()}
+	}
+	if p.match(token.Spawn) {
+		call, ok := p.parseCall().(*ast.CallExpr)
+		if !ok {
+			p.error("Expect function call after 'spawn'.")
+		}
+		return &ast.SpawnExpr{Call: call}
+	}
 	return p.parseCall()
 }
 
 func (p *Parser) parseCall() ast.Expr {
 	expr := p.parsePrimary()
 
-	// fn()()
+	// fn()()、a[i][j]、obj.items[0]
 	for {
 		if p.match(token.LeftParen) {
 			expr = p.finishCall(expr)
+		} else if p.match(token.LeftBracket) {
+			expr = p.finishIndex(expr)
 		} else if p.match(token.Dot) {
 			name := p.lit
-			p.expect(token.Identifier, "Expect property name after '.'.")
+			if !p.match(token.PrivateName) {
+				p.expect(token.Identifier, "Expect property name after '.'.")
+			}
 			expr = &ast.GetExpr{Object: expr, Name: name}
 		} else {
 			break
@@ -489,6 +1065,27 @@ func (p *Parser) parseCall() ast.Expr {
 	return expr
 }
 
+// finishIndex parses a[i] or a[start:end:step], any part of a slice can be omitted.
+func (p *Parser) finishIndex(expr ast.Expr) ast.Expr {
+	var start ast.Expr
+	if !p.check(token.Colon) {
+		start = p.parseExpression()
+		if p.match(token.RightBracket) {
+			return &ast.IndexExpr{Object: expr, Index: start}
+		}
+	}
+	p.expect(token.Colon, "Expect ']' after index.")
+	slice := &ast.SliceExpr{Object: expr, Start: start}
+	if !p.check(token.Colon) && !p.check(token.RightBracket) {
+		slice.End = p.parseExpression()
+	}
+	if p.match(token.Colon) && !p.check(token.RightBracket) {
+		slice.Step = p.parseExpression()
+	}
+	p.expect(token.RightBracket, "Expect ']' after slice.")
+	return slice
+}
+
 func (p *Parser) finishCall(expr ast.Expr) ast.Expr {
 	call := &ast.CallExpr{
 		Callee:    expr,
@@ -497,8 +1094,23 @@ func (p *Parser) finishCall(expr ast.Expr) ast.Expr {
 	if p.match(token.RightParen) {
 		return call
 	}
+	named := make(map[string]bool)
 	for {
-		arg := p.parseExpression()
+		var arg ast.Expr
+		if p.match(token.Ellipsis) {
+			arg = &ast.SpreadExpr{Expression: p.parseExpression()}
+		} else {
+			arg = p.parseExpression()
+		}
+		if v, ok := arg.(*ast.VariableExpr); ok && p.match(token.Colon) {
+			if named[v.Name] {
+				p.error(fmt.Sprintf("Duplicate keyword argument %q.", v.Name))
+			}
+			named[v.Name] = true
+			arg = &ast.NamedArgExpr{Name: v.Name, Value: p.parseExpression()}
+		} else if len(named) > 0 {
+			p.error("Positional argument cannot follow keyword argument.")
+		}
 		if len(call.Arguments) >= 255 {
 			p.error("Cannot have more than 255 arguments.")
 		}
@@ -517,11 +1129,22 @@ func (p *Parser) parsePrimary() (expr ast.Expr) {
 	switch tok {
 	default:
 		p.error("Expect expression.")
+	case token.Illegal:
+		if lit != "" {
+			p.error(lit)
+		}
+		p.error("Expect expression.")
+	case token.PrivateName:
+		p.error(fmt.Sprintf("Private member %s can only be accessed through this.", lit))
 	case token.LeftBracket:
 		elements := make([]ast.Expr, 0)
 		p.nextToken()
 		for !p.match(token.RightBracket) {
-			elements = append(elements, p.parseExpression())
+			if p.match(token.Ellipsis) {
+				elements = append(elements, &ast.SpreadExpr{Expression: p.parseExpression()})
+			} else {
+				elements = append(elements, p.parseExpression())
+			}
 			if p.match(token.RightBracket) {
 				break
 			} else if !p.match(token.Comma) {
@@ -538,6 +1161,8 @@ func (p *Parser) parsePrimary() (expr ast.Expr) {
 			Token: tok,
 			Value: lit,
 		}
+	case token.Template:
+		expr = p.parseTemplate(lit)
 	case token.Identifier:
 		expr = &ast.VariableExpr{
 			Name:     lit,
@@ -545,6 +1170,10 @@ func (p *Parser) parsePrimary() (expr ast.Expr) {
 		}
 	case token.This:
 		expr = &ast.ThisExpr{}
+	case token.Match:
+		p.nextToken()
+		value, arms := p.parseMatch(true)
+		return &ast.MatchExpr{Value: value, Arms: arms}
 	case token.LeftParen:
 		p.nextToken()
 		inner := p.parseExpression()
@@ -560,13 +1189,33 @@ func (p *Parser) parsePrimary() (expr ast.Expr) {
 	return expr
 }
 
+// parseTemplate parses each interpolation of the template with a sub parser.
+func (p *Parser) parseTemplate(raw string) ast.Expr {
+	texts, sources, err := lexer.SplitTemplate(raw)
+	if err != nil {
+		p.error(err.Error())
+	}
+	exprs := make([]ast.Expr, 0, len(sources))
+	for _, source := range sources {
+		sub := New(lexer.New(source))
+		exprs = append(exprs, sub.parseExpression())
+		if !sub.isAtEnd() {
+			sub.error("Expect '}' after template expression.")
+		}
+	}
+	return &ast.TemplateExpr{
+		Texts: texts,
+		Exprs: exprs,
+	}
+}
+
 func (p *Parser) synchronize() {
 	for !p.isAtEnd() {
 		switch p.tok {
 		case token.Semicolon:
 			p.nextToken()
 			return
-		case token.Class, token.Function, token.Var, token.Let, token.If, token.While, token.Print, token.Return:
+		case token.Class, token.Function, token.Var, token.Let, token.Const, token.If, token.While, token.Print, token.Return, token.Defer:
 			return
 		default:
 			p.nextToken()
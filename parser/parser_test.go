@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"strings"
 	"testing"
 
 	"tiny-script/ast"
@@ -84,6 +85,40 @@ func TestParseSetExpr(t *testing.T) {
 	testExpr(t, tests)
 }
 
+func TestParseIndexExpr(t *testing.T) {
+	tests := []parserTest{
+		{
+			input:    "a[i + 1]",
+			expected: "a[(i + 1)]",
+		},
+		{
+			input:    "grid[i][j] = 1",
+			expected: "grid[i][j] = 1",
+		},
+		{
+			input:    "obj.items[0]",
+			expected: "obj.items[0]",
+		},
+		{
+			input:    "f()[2].x",
+			expected: "f()[2].x",
+		},
+		{
+			input:    "a[1:n - 1]",
+			expected: "a[1:(n - 1)]",
+		},
+		{
+			input:    "a[::-1]",
+			expected: "a[::(-1)]",
+		},
+		{
+			input:    "a[:2][1:]",
+			expected: "a[:2][1:]",
+		},
+	}
+	testExpr(t, tests)
+}
+
 func TestParseExpressionRecover(t *testing.T) {
 	input := "123 + 456 -;123+456"
 	expected := "(123 + 456)"
@@ -224,6 +259,432 @@ func TestParseFunction(t *testing.T) {
 	testAstString(t, input, expected)
 }
 
+func TestParseParams(t *testing.T) {
+	input := `function f(a, b = a + 1, ...rest) {}
+	f(1, ...xs, b: 2);`
+	expected := []string{
+		"fun f(a, b = (a + 1), ...rest) {  }",
+		"f(1, ...xs, b: 2);",
+	}
+	testAstString(t, input, expected)
+
+	for i, input := range []string{
+		"function f(...a, b) {}",
+		"function f(...a = 1) {}",
+		"function f(a = 1, b) {}",
+		"f(a: 1, 2);",
+		"f(a: 1, a: 2);",
+	} {
+		if _, err := newParserFromInput(input).Parse(); err == nil {
+			t.Errorf("test [%d]: parser doesn't fail for %q", i, input)
+		}
+	}
+}
+
+func TestParseDestructuring(t *testing.T) {
+	input := `let [a, b, ...rest] = xs;
+	const {x, y: [p, q]} = obj;
+	[a, b] = [b, a];
+	[o.x, xs[0]] = f();
+	for (let [k, v] in pairs) print k;
+	for (var c in s) { print c; }
+	function g([a, b], {x} = o) { return a, b; }`
+	expected := []string{
+		"let [a, b, ...rest] = xs;",
+		"const {x, y: [p, q]} = obj;",
+		"[a, b] = [b,a];",
+		"[o.x, xs[0]] = f();",
+		"for (let [k, v] in pairs) print k;",
+		"for (var c in s) { print c; }",
+		"fun g([a, b], {x} = o) { return [a,b]; }",
+	}
+	testAstString(t, input, expected)
+
+	for i, input := range []string{
+		"let [a, 1] = xs;",
+		"let [...a, b] = xs;",
+		"[a + 1, b] = xs;",
+		"let {x: 1} = o;",
+	} {
+		if _, err := newParserFromInput(input).Parse(); err == nil {
+			t.Errorf("test [%d]: parser doesn't fail for %q", i, input)
+		}
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	tests := []parserTest{
+		{"0xFF", "0xFF"},
+		{"0o755", "0o755"},
+		{"0b1010", "0b1010"},
+		{"1_000_000", "1_000_000"},
+		{".5", ".5"},
+		{"1_0.2_5e1_0", "1_0.2_5e1_0"},
+		{"123n", "123n"},
+		{"0xFFn", "0xFFn"},
+		{"12.34d", "12.34d"},
+		{"1e3d", "1e3d"},
+	}
+	testExpr(t, tests)
+
+	for i, test := range []struct {
+		input string
+		msg   string
+	}{
+		{"0b102", `invalid digit '2' in binary literal`},
+		{"0o8", `invalid digit '8' in octal literal`},
+		{"0x", "hexadecimal literal has no digits"},
+		{"0x_F", "'_' must separate successive digits"},
+		{"1__0", "'_' must separate successive digits"},
+		{"1_", "'_' must separate successive digits"},
+		{"123abc", `invalid character 'a' in number literal`},
+		{"0xFFg", `invalid character 'g' in number literal`},
+		{"1e", "power is required"},
+		{"1.5n", "bigint literal cannot have fraction or exponent"},
+		{"1e3n", "bigint literal cannot have fraction or exponent"},
+		{"0b1d", `invalid character 'd' in number literal`},
+		{"1nd", `invalid character 'd' in number literal`},
+	} {
+		_, err := parseExpression(newParserFromInput(test.input))
+		if err == nil || !strings.HasSuffix(err.Error(), test.msg) {
+			t.Errorf("test [%d]: expected error %q for %q. got %v", i, test.msg, test.input, err)
+		}
+	}
+}
+
+func TestParseString(t *testing.T) {
+	tests := []parserTest{
+		{`"a\nb\tc\\d\re\0"`, "a\nb\tc\\d\re\x00"},
+		{`"\x41\u00e9\u{1F600}\"\'"`, "A\u00e9\U0001F600\"'"},
+		{`'it\'s "ok"'`, `it's "ok"`},
+		{`r"C:\path\new"`, `C:\path\new`},
+		{`r'\n'`, `\n`},
+		{`""`, ""},
+		{"\"\"\"\n    a\n      b\n    \"\"\"", "a\n  b"},
+		{"'''\n\tx\n\n\ty\\n'''", "x\n\ny\n"},
+		{"r\"\"\"\n  a\\n\n  \"\"\"", `a\n`},
+		{"\"\"\"\n\n    a\n      b\n    \"\"\"", "\na\n  b"},
+		{"\"\"\"\n\t\ta\n\t  b\n\"\"\"", "\ta\n  b"},
+	}
+	testExpr(t, tests)
+
+	for i, test := range []struct {
+		input string
+		msg   string
+	}{
+		{`"\q"`, `invalid escape sequence "\q"`},
+		{`"\x4"`, `invalid escape sequence "\x4", expect 2 hex digits`},
+		{`"\u12"`, `invalid escape sequence "\u12", expect 4 hex digits`},
+		{`"\u{}"`, `invalid escape sequence "\u{", expect 1 to 6 hex digits and '}'`},
+		{`"\u{110000}"`, `invalid escape sequence "\u{110000}", invalid unicode char`},
+		{`"abc`, "unterminated string"},
+		{`"""abc"`, "unterminated string"},
+		{`'abc"`, "unterminated string"},
+	} {
+		_, err := parseExpression(newParserFromInput(test.input))
+		if err == nil || !strings.HasSuffix(err.Error(), test.msg) {
+			t.Errorf("test [%d]: expected error %q for %q. got %v", i, test.msg, test.input, err)
+		}
+	}
+}
+
+func TestParseTemplate(t *testing.T) {
+	tests := []parserTest{
+		{"`abc`", "`abc`"},
+		{"`a${b}c`", "`a${b}c`"},
+		{"`${a + 1}${f(x)}`", "`${(a + 1)}${f(x)}`"},
+		{"`a${`b${c}`}`", "`a${`b${c}`}`"},
+		{"`${\"}\"}`", "`${}}`"},
+		{"`\\${a} \\` \\n`", "`${a} ` \n`"},
+		{"`line1\nline2`", "`line1\nline2`"},
+	}
+	testExpr(t, tests)
+
+	for i, input := range []string{
+		"`abc",
+		"`${a`",
+		"`${}`",
+		"`${a b}`",
+		"`\\q`",
+	} {
+		if _, err := parseExpression(newParserFromInput(input)); err == nil {
+			t.Errorf("test [%d]: parser doesn't fail for %q", i, input)
+		}
+	}
+}
+
+func TestParseYield(t *testing.T) {
+	input := `function gen() {
+		yield;
+		let x = yield 1 + 2;
+		x = yield x;
+		function inner() {}
+	}
+	function plain() {}`
+	stmts, err := newParserFromInput(input).Parse()
+	if err != nil {
+		t.Fatalf("parse failed. error: %s", err.Error())
+	}
+	gen := stmts[0].(*ast.FunctionStmt)
+	expected := []string{"yield;", "let x = yield (1 + 2);", "x = yield x;"}
+	for i, e := range expected {
+		if s := gen.Body[i].String(); s != e {
+			t.Errorf("test [%d]: expected %q. got %q", i, e, s)
+		}
+	}
+	if !gen.IsGenerator {
+		t.Errorf("function gen should be a generator")
+	}
+	if gen.Body[3].(*ast.FunctionStmt).IsGenerator || stmts[1].(*ast.FunctionStmt).IsGenerator {
+		t.Errorf("functions without yield should not be generators")
+	}
+}
+
+func TestParseSpawnAndSelect(t *testing.T) {
+	input := `let task = spawn worker(ch, 3);
+	select {
+		case let v = a.recv() { print v; }
+		case b.send(1) {}
+		default { print 0; }
+	}`
+	expected := []string{
+		"let task = spawn worker(ch, 3);",
+		"select { case let v = a.recv() { print v; } case b.send(1) {  } default { print 0; } }",
+	}
+	testAstString(t, input, expected)
+
+	for i, input := range []string{
+		"spawn worker;",
+		"select { case a.close() {} }",
+		"select { case let v = a.send(1) {} }",
+		"select { print 1; }",
+		"select { default {} default {} }",
+	} {
+		if _, err := newParserFromInput(input).Parse(); err == nil {
+			t.Errorf("test [%d]: parser doesn't fail for %q", i, input)
+		}
+	}
+}
+
+func TestParseAsync(t *testing.T) {
+	input := `async function f(x) { let v = await g(x); return await v; }
+	class A { async load() { await f(1); } }`
+	expected := []string{
+		"async fun f(x) { let v = await g(x);return await v; }",
+		"class A",
+	}
+	testAstString(t, input, expected)
+
+	for i, input := range []string{
+		"async f() {}",
+		"async function f() { await; }",
+	} {
+		if _, err := newParserFromInput(input).Parse(); err == nil {
+			t.Errorf("test [%d]: parser doesn't fail for %q", i, input)
+		}
+	}
+}
+
+func TestParseMatch(t *testing.T) {
+	input := `match (v) {
+		0 | 1 => print "small";
+		-5..0 => {}
+		1..=9 if v != 5 => print v;
+		[first, ...rest] => print rest;
+		Point{x: 0, y} => print y;
+		{name} => print name;
+		_ => print "other";
+	}
+	let s = match (v) { "a" => 1, _ => 2, };`
+	expected := []string{
+		`match (v) { 0 | 1 => print small; (-5)..0 => {  } 1..=9 if (v != 5) => print v; ` +
+			`[first, ...rest] => print rest; Point{x: 0, y} => print y; {name} => print name; _ => print other; }`,
+		"let s = match (v) { a => 1, _ => 2 };",
+	}
+	testAstString(t, input, expected)
+
+	for i, input := range []string{
+		"match (v) { 1 print 1; }",
+		"match v { _ => print 1; }",
+		"match (v) { [...1] => print 1; }",
+		"match (v) { a + 1 => print 1; }",
+		"let s = match (v) { 1 => 1 2 => 2 };",
+	} {
+		if _, err := newParserFromInput(input).Parse(); err == nil {
+			t.Errorf("test [%d]: parser doesn't fail for %q", i, input)
+		}
+	}
+}
+
+func TestParseEnum(t *testing.T) {
+	input := `enum Color { Red, Green = 2, Blue, }
+	enum Shape { Circle(r), Rect(w, h), Empty }
+	match (s) { Shape.Circle(r) => print r; Color.Red => {} }`
+	expected := []string{
+		"enum Color { Red, Green = 2, Blue }",
+		"enum Shape { Circle(r), Rect(w, h), Empty }",
+		"match (s) { Shape.Circle(r) => print r; Color.Red => {  } }",
+	}
+	testAstString(t, input, expected)
+
+	for i, input := range []string{
+		"enum Color { Red, Red }",
+		"enum Color { values }",
+		"enum Color { Red Green }",
+		"enum Shape { Circle(1) }",
+	} {
+		if _, err := newParserFromInput(input).Parse(); err == nil {
+			t.Errorf("test [%d]: parser doesn't fail for %q", i, input)
+		}
+	}
+}
+
+func TestParseClassMembers(t *testing.T) {
+	input := `class Point {
+		x = 1;
+		y;
+		static origin = Point();
+		static create(x) { return Point(); }
+		get norm() { return this.x; }
+		set norm(v) {}
+		get() { return 0; }
+		init() {}
+	}`
+	program, err := newParserFromInput(input).Parse()
+	if err != nil {
+		t.Fatalf("parser error: %s", err)
+	}
+	class := program[0].(*ast.ClassStmt)
+	var fields, statics []string
+	for _, f := range class.Fields {
+		fields = append(fields, f.String())
+	}
+	for _, f := range class.StaticFields {
+		statics = append(statics, f.String())
+	}
+	if got, want := strings.Join(fields, " "), "x = 1; y;"; got != want {
+		t.Errorf("fields = %q, want %q", got, want)
+	}
+	if got, want := strings.Join(statics, " "), "origin = Point();"; got != want {
+		t.Errorf("static fields = %q, want %q", got, want)
+	}
+	if len(class.StaticMethods) != 1 || len(class.Getters) != 1 || len(class.Setters) != 1 || len(class.Methods) != 2 {
+		t.Errorf("unexpected members %d statics, %d getters, %d setters, %d methods",
+			len(class.StaticMethods), len(class.Getters), len(class.Setters), len(class.Methods))
+	}
+
+	for i, input := range []string{
+		"class A { x = 1; x = 2; }",
+		"class A { x; x() {} }",
+		"class A { get x(a) {} }",
+		"class A { set x() {} }",
+		"class A { x = 1 }",
+		"class A { static get x() {} }",
+	} {
+		if _, err := newParserFromInput(input).Parse(); err == nil {
+			t.Errorf("test [%d]: parser doesn't fail for %q", i, input)
+		}
+	}
+}
+
+func TestParsePrivateMembers(t *testing.T) {
+	input := `class A { #x = 1; #f() { return this.#x; } }`
+	program, err := newParserFromInput(input).Parse()
+	if err != nil {
+		t.Fatalf("parser error: %s", err)
+	}
+	class := program[0].(*ast.ClassStmt)
+	if class.Fields[0].Name != "#x" || class.Methods[0].Name != "#f" {
+		t.Errorf("unexpected private members %q, %q", class.Fields[0].Name, class.Methods[0].Name)
+	}
+
+	for i, input := range []string{
+		"print #x;",
+		"class A { static #x = 1; }",
+		"class A { #x; #x() {} }",
+		"let #x = 1;",
+	} {
+		if _, err := newParserFromInput(input).Parse(); err == nil {
+			t.Errorf("test [%d]: parser doesn't fail for %q", i, input)
+		}
+	}
+}
+
+func TestParseTrait(t *testing.T) {
+	input := `trait Shape { area(); describe() { return this.area(); } }
+	class Square with Shape, Printable {}
+	print a is Shape;`
+	expected := []string{
+		"trait Shape",
+		"class Square with Shape, Printable",
+		"print (a is Shape);",
+	}
+	testAstString(t, input, expected)
+
+	program, _ := newParserFromInput(input).Parse()
+	trait := program[0].(*ast.TraitStmt)
+	if len(trait.Required) != 1 || trait.Required[0].Name != "area" || len(trait.Methods) != 1 {
+		t.Errorf("unexpected trait methods %v, %v", trait.Required, trait.Methods)
+	}
+
+	for i, input := range []string{
+		"trait T { f(); f() {} }",
+		"trait T { init() {} }",
+		"trait T { async f(); }",
+		"trait T { x = 1; }",
+		"class A with {}",
+	} {
+		if _, err := newParserFromInput(input).Parse(); err == nil {
+			t.Errorf("test [%d]: parser doesn't fail for %q", i, input)
+		}
+	}
+}
+
+func TestParseTypeAnnotations(t *testing.T) {
+	input := `let x: number = 1;
+	var xs: (int | string)[];
+	function f(a: int, b: Point = p, ...rest: int[]): bool | nil { return true; }
+	trait T { area(): number; }`
+	expected := []string{
+		"let x: number = 1;",
+		"var xs: (int | string)[];",
+		"fun f(a: int, b: Point = p, ...rest: int[]): bool | nil { return true; }",
+		"trait T",
+	}
+	testAstString(t, input, expected)
+
+	program, _ := newParserFromInput(input).Parse()
+	if typ := program[3].(*ast.TraitStmt).Required[0].ReturnType; typ == nil || typ.String() != "number" {
+		t.Errorf("expected return type number of required method. got %v", typ)
+	}
+	program, _ = newParserFromInput("class P { x: int = 0; }").Parse()
+	if typ := program[0].(*ast.ClassStmt).Fields[0].Type; typ == nil || typ.String() != "int" {
+		t.Errorf("expected field type int. got %v", typ)
+	}
+
+	for i, input := range []string{
+		"let x: = 1;",
+		"let x: int[ = 1;",
+		"function f(a:) {}",
+	} {
+		if _, err := newParserFromInput(input).Parse(); err == nil {
+			t.Errorf("test [%d]: parser doesn't fail for %q", i, input)
+		}
+	}
+}
+
+func TestParseDefer(t *testing.T) {
+	input := `function f() { defer file.close(); defer log("done", 1); }`
+	expected := []string{
+		`fun f() { defer file.close();defer log(done, 1); }`,
+	}
+	testAstString(t, input, expected)
+
+	if _, err := newParserFromInput("function f() { defer log() }").Parse(); err == nil {
+		t.Errorf("parser doesn't fail for a defer without ';'")
+	}
+}
+
 func TestParseClass(t *testing.T) {
 	input := `class A {}
 	class B {}
@@ -1,6 +1,10 @@
 package resolver
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+
 	"tiny-script/ast"
 	"tiny-script/errors"
 	"tiny-script/token"
@@ -26,8 +30,37 @@ var (
 	scopes          = NewScopes()
 	curFunctionType = FunctionNone
 	curClassType    = ClassNone
+	curClass        *ast.ClassStmt // the innermost class being resolved
+	curAsync        = false        // whether the function being resolved is async
+
+	// globalKinds records how the top-level variables were declared,
+	// top-level variables are not tracked by scopes.
+	globalKinds = make(map[string]Kind)
+	// hoistedKinds records how the top-level variables of a program are
+	// declared before their declarations are resolved.
+	hoistedKinds = make(map[string]Kind)
 )
 
+// Reset forgets all the top-level declarations resolved before.
+func Reset() {
+	scopes = NewScopes()
+	curFunctionType = FunctionNone
+	curClassType = ClassNone
+	curClass = nil
+	curAsync = false
+	globalKinds = make(map[string]Kind)
+	hoistedKinds = make(map[string]Kind)
+}
+
+// Hoist records the kinds of the top-level variables declared by statements
+// before they are resolved, so that a function declared ahead of a const
+// cannot assign to it, as resolveBlock does for the variables of a block.
+func Hoist(statements []ast.Stmt) {
+	declarations(statements, func(name string, kind Kind) {
+		hoistedKinds[name] = kind
+	})
+}
+
 func Resolve(node ast.Node) {
 	switch n := node.(type) {
 	default:
@@ -36,8 +69,6 @@ func Resolve(node ast.Node) {
 		resolveVariableExpr(n)
 	case *ast.AssignExpr:
 		resolveAssignExpr(n)
-	case *ast.ArrayAssignExpr:
-		resolveArrayAssignExpr(n)
 	case *ast.BinaryExpr:
 		resolveBinaryExpr(n)
 	case *ast.UnaryExpr:
@@ -62,6 +93,14 @@ func Resolve(node ast.Node) {
 		resolveVarStmt(n)
 	case *ast.LetStmt:
 		resolveLetStmt(n)
+	case *ast.ConstStmt:
+		resolveConstStmt(n)
+	case *ast.DestructureStmt:
+		resolveDestructureStmt(n)
+	case *ast.ForInStmt:
+		resolveForInStmt(n)
+	case *ast.PatternAssignExpr:
+		resolvePatternAssignExpr(n)
 	case *ast.FunctionStmt:
 		resolveFunctionStmt(n)
 	case *ast.ExprStmt:
@@ -74,25 +113,65 @@ func Resolve(node ast.Node) {
 		resolvePrintStmt(n)
 	case *ast.ReturnStmt:
 		resolveReturnStmt(n)
+	case *ast.DeferStmt:
+		resolveDeferStmt(n)
 	case *ast.ClassStmt:
 		resolveClassStmt(n)
 	case *ast.ImportStmt:
-		// do nothing.
+		declare(n.Name, KindVar)
 	case *ast.ArrayLiteralExpr:
 		resolveArrayLiteralExpr(n)
-	case *ast.IndexLiteralExpr:
+	case *ast.IndexExpr:
 		resolveIndexExpr(n)
-	case *ast.IndexVariableExpr:
-		resolveIndexVariableExpr(n)
+	case *ast.IndexSetExpr:
+		resolveIndexSetExpr(n)
+	case *ast.SliceExpr:
+		resolveSliceExpr(n)
+	case *ast.SpreadExpr:
+		Resolve(n.Expression)
+	case *ast.TemplateExpr:
+		for _, expr := range n.Exprs {
+			Resolve(expr)
+		}
+	case *ast.YieldExpr:
+		resolveYieldExpr(n)
+	case *ast.SpawnExpr:
+		Resolve(n.Call)
+	case *ast.AwaitExpr:
+		resolveAwaitExpr(n)
+	case *ast.SelectStmt:
+		resolveSelectStmt(n)
+	case *ast.MatchStmt:
+		resolveMatch(n.Value, n.Arms)
+	case *ast.MatchExpr:
+		resolveMatch(n.Value, n.Arms)
+	case *ast.EnumStmt:
+		resolveEnumStmt(n)
+	case *ast.TraitStmt:
+		resolveTraitStmt(n)
+	case *ast.NamedArgExpr:
+		Resolve(n.Value)
 	}
 }
 
-func resolveIndexVariableExpr(n *ast.IndexVariableExpr) {
-	resolveLocal(n, n.Name)
+func resolveIndexExpr(expr *ast.IndexExpr) {
+	Resolve(expr.Object)
+	Resolve(expr.Index)
+}
+
+func resolveIndexSetExpr(expr *ast.IndexSetExpr) {
+	Resolve(expr.Object)
+	Resolve(expr.Index)
+	Resolve(expr.Value)
 }
 
-func resolveIndexExpr(n *ast.IndexLiteralExpr) {
-	Resolve(n.Left)
+func resolveSliceExpr(expr *ast.SliceExpr) {
+	Resolve(expr.Object)
+	for _, e := range []ast.Expr{expr.Start, expr.End, expr.Step} {
+		if e != nil {
+			Resolve(e)
+		}
+	}
 }
 
 func resolveArrayLiteralExpr(stmt *ast.ArrayLiteralExpr) {
@@ -103,6 +182,9 @@ func resolveArrayLiteralExpr(stmt *ast.ArrayLiteralExpr) {
 
 func resolveVariableExpr(expr *ast.VariableExpr) {
 	if exist, init := scopes.check(expr.Name); exist && !init {
+		if scopes.lookup(expr.Name).kind != KindVar {
+			errors.Error(token.Identifier, fmt.Sprintf("Cannot access %q before initialization.", expr.Name))
+		}
 		errors.Error(token.Identifier, "Cannot read local variable in its own initializer.")
 		return
 	}
@@ -116,6 +198,7 @@ func resolveLocal(expr ast.Expr, name string) {
 		for i := len(scopes) - 1; i >= 0; i-- {
 			if _, ok := scopes[i][name]; ok {
 				n.Distance = len(scopes) - 1 - i
+				break
 			}
 		}
 	case *ast.ThisExpr:
@@ -132,19 +215,50 @@ func resolveLocal(expr ast.Expr, name string) {
 	}
 }
 
-func resolveArrayAssignExpr(expr *ast.ArrayAssignExpr) {
+func resolveAssignExpr(expr *ast.AssignExpr) {
 	Resolve(expr.Value)
+	checkAssignable(expr.Left.Name)
 	resolveLocal(expr.Left, expr.Left.Name)
-	val, ok := expr.Index.(*ast.IndexVariableExpr)
-	if ok {
-		e := val.Index.(*ast.VariableExpr)
-		resolveLocal(e, e.Name)
+}
+
+// checkAssignable reports an error if name refers to a const variable.
+func checkAssignable(name string) {
+	kind, ok := globalKinds[name]
+	if !ok {
+		kind, ok = hoistedKinds[name]
+	}
+	if b := scopes.lookup(name); b != nil {
+		kind, ok = b.kind, true
+	}
+	if ok && kind == KindConst {
+		errors.Error(token.Equal, fmt.Sprintf("Assignment to constant variable %q.", name))
 	}
 }
 
-func resolveAssignExpr(expr *ast.AssignExpr) {
+func resolvePatternAssignExpr(expr *ast.PatternAssignExpr) {
 	Resolve(expr.Value)
-	resolveLocal(expr.Left, expr.Left.Name)
+	resolveAssignPattern(expr.Pattern)
+}
+
+// resolveAssignPattern resolves the targets of a destructuring assignment.
+func resolveAssignPattern(pattern ast.Pattern) {
+	switch p := pattern.(type) {
+	case *ast.VariableExpr:
+		checkAssignable(p.Name)
+		resolveLocal(p, p.Name)
+	case *ast.GetExpr:
+		resolveGetExpr(p)
+	case *ast.IndexExpr:
+		Resolve(p.Object)
+		Resolve(p.Index)
+	case *ast.ArrayPattern:
+		for _, e := range p.Elements {
+			resolveAssignPattern(e)
+		}
+		if p.Rest != nil {
+			resolveAssignPattern(p.Rest)
+		}
+	}
 }
 
 func resolveBinaryExpr(expr *ast.BinaryExpr) {
@@ -175,13 +289,29 @@ func resolveCallExpr(expr *ast.CallExpr) {
 
 func resolveGetExpr(expr *ast.GetExpr) {
 	Resolve(expr.Object)
+	resolvePrivateName(expr.Object, expr.Name)
 }
 
 func resolveSetExpr(expr *ast.SetExpr) {
 	Resolve(expr.Object)
+	resolvePrivateName(expr.Object, expr.Name)
 	Resolve(expr.Value)
 }
 
+// resolvePrivateName checks that a private member is accessed through this
+// and declared by the innermost class.
+func resolvePrivateName(object ast.Expr, name string) {
+	if !strings.HasPrefix(name, "#") {
+		return
+	}
+	if _, ok := object.(*ast.ThisExpr); !ok || curClass == nil {
+		errors.Error(token.PrivateName, fmt.Sprintf("Private member %s can only be accessed through this.", name))
+	}
+	if !curClass.Declares(name) {
+		errors.Error(token.PrivateName, fmt.Sprintf("Private member %s is not declared in class %s.", name, curClass.Name))
+	}
+}
+
 func resolveThisExpr(expr *ast.ThisExpr) {
 	if curClassType == ClassNone {
 		errors.Error(token.This, "Cannot use 'this' outside of a class.")
@@ -197,14 +327,50 @@ func resolveBlockStmt(block *ast.BlockStmt) {
 }
 
 func resolveBlock(statements []ast.Stmt) {
+	declarations(statements, func(name string, kind Kind) {
+		if kind != KindVar {
+			scopes.hoist(name, kind)
+		}
+	})
 	for _, stmt := range statements {
 		Resolve(stmt)
 	}
 }
 
+// declarations calls fn with each variable declared by statements.
+func declarations(statements []ast.Stmt, fn func(name string, kind Kind)) {
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *ast.VarStmt:
+			fn(s.Name.Name, KindVar)
+		case *ast.LetStmt:
+			fn(s.Name.Name, KindLet)
+		case *ast.ConstStmt:
+			fn(s.Name.Name, KindConst)
+		case *ast.DestructureStmt:
+			for _, name := range ast.PatternNames(s.Pattern) {
+				fn(name, kindOf(s.Kind))
+			}
+		}
+	}
+}
+
+// declare declares name in the innermost scope, or in the global scope at top level.
+// Only var declarations may be repeated in the global scope.
+func declare(name string, kind Kind) {
+	if !scopes.isEmpty() {
+		scopes.declareAs(name, kind)
+		return
+	}
+	if prev, ok := globalKinds[name]; ok && (prev != KindVar || kind != KindVar) {
+		errors.Error(token.Let, fmt.Sprintf("variable name %q has been already delcared in this scope.", name))
+	}
+	globalKinds[name] = kind
+}
+
 func resolveVarStmt(stmt *ast.VarStmt) {
 	name := stmt.Name.Name
-	scopes.declare(name)
+	declare(name, KindVar)
 	if stmt.Initializer != nil {
 		Resolve(stmt.Initializer)
 	}
@@ -213,30 +379,194 @@ func resolveVarStmt(stmt *ast.VarStmt) {
 
 func resolveLetStmt(stmt *ast.LetStmt) {
 	name := stmt.Name.Name
-	scopes.declare(name)
+	declare(name, KindLet)
 	if stmt.Initializer != nil {
 		Resolve(stmt.Initializer)
 	}
 	scopes.define(name)
 }
 
+// kindOf returns the Kind declared by var, let or const token.
+func kindOf(tok token.Token) Kind {
+	switch tok {
+	case token.Let:
+		return KindLet
+	case token.Const:
+		return KindConst
+	default:
+		return KindVar
+	}
+}
+
+func resolveDestructureStmt(stmt *ast.DestructureStmt) {
+	names := ast.PatternNames(stmt.Pattern)
+	for _, name := range names {
+		declare(name, kindOf(stmt.Kind))
+	}
+	Resolve(stmt.Initializer)
+	for _, name := range names {
+		scopes.define(name)
+	}
+}
+
+func resolveForInStmt(stmt *ast.ForInStmt) {
+	Resolve(stmt.Iterable)
+	// each iteration binds the target in a new scope.
+	scopes.begin()
+	for _, name := range ast.PatternNames(stmt.Target) {
+		scopes.declareAs(name, kindOf(stmt.Kind))
+		scopes.define(name)
+	}
+	Resolve(stmt.Body)
+	scopes.end()
+}
+
+func resolveSelectStmt(stmt *ast.SelectStmt) {
+	for _, c := range stmt.Cases {
+		Resolve(c.Comm)
+		if c.Name == "" {
+			Resolve(c.Body)
+			continue
+		}
+		// the received value is bound in a new scope around the body.
+		scopes.begin()
+		scopes.declareAs(c.Name, KindLet)
+		scopes.define(c.Name)
+		Resolve(c.Body)
+		scopes.end()
+	}
+	if stmt.Default != nil {
+		Resolve(stmt.Default)
+	}
+}
+
+// resolveTraitStmt resolves the default methods of a trait like the methods
+// of a class, this is the instance of the class using the trait.
+func resolveTraitStmt(stmt *ast.TraitStmt) {
+	declare(stmt.Name, KindConst)
+	scopes.define(stmt.Name)
+
+	enclosingClass, enclosingStmt := curClassType, curClass
+	curClassType, curClass = Class, nil
+	defer func() {
+		curClassType, curClass = enclosingClass, enclosingStmt
+	}()
+
+	scopes.begin()
+	scopes.declare("this")
+	scopes.define("this")
+	for _, method := range stmt.Methods {
+		resolveFunction(method, Method)
+	}
+	scopes.end()
+}
+
+func resolveEnumStmt(stmt *ast.EnumStmt) {
+	declare(stmt.Name, KindConst)
+	for _, variant := range stmt.Variants {
+		if variant.Value != nil {
+			Resolve(variant.Value)
+		}
+	}
+	scopes.define(stmt.Name)
+}
+
+func resolveMatch(value ast.Expr, arms []*ast.MatchArm) {
+	Resolve(value)
+	for _, arm := range arms {
+		// the names bound by the pattern are scoped to the arm.
+		scopes.begin()
+		resolveMatchPattern(arm.Pattern, true)
+		if arm.Guard != nil {
+			Resolve(arm.Guard)
+		}
+		Resolve(arm.Body)
+		scopes.end()
+	}
+}
+
+// resolveMatchPattern resolves the classes of pattern, and declares the names
+// it binds if bind is true.
+func resolveMatchPattern(pattern ast.MatchPattern, bind bool) {
+	switch p := pattern.(type) {
+	case *ast.BindingPattern:
+		if bind {
+			scopes.declareAs(p.Name, KindLet)
+			scopes.define(p.Name)
+		}
+	case *ast.OrPattern:
+		names := sortedNames(ast.MatchPatternNames(p.Alternatives[0]))
+		for i, alt := range p.Alternatives {
+			if sortedNames(ast.MatchPatternNames(alt)) != names {
+				errors.Error(token.Or, "Alternatives of a pattern must bind the same names.")
+			}
+			// the alternatives bind the same names, which are declared once.
+			resolveMatchPattern(alt, bind && i == 0)
+		}
+	case *ast.ListPattern:
+		for _, e := range p.Elements {
+			resolveMatchPattern(e, bind)
+		}
+		if p.Rest != nil {
+			resolveMatchPattern(p.Rest, bind)
+		}
+	case *ast.FieldsPattern:
+		if p.Class != nil {
+			Resolve(p.Class)
+		}
+		for _, f := range p.Fields {
+			resolveMatchPattern(f.Pattern, bind)
+		}
+	case *ast.EnumPattern:
+		Resolve(p.Enum)
+		for _, arg := range p.Args {
+			resolveMatchPattern(arg, bind)
+		}
+	}
+}
+
+func sortedNames(names []string) string {
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func resolveConstStmt(stmt *ast.ConstStmt) {
+	name := stmt.Name.Name
+	declare(name, KindConst)
+	Resolve(stmt.Initializer)
+	scopes.define(name)
+}
+
 func resolveFunctionStmt(stmt *ast.FunctionStmt) {
-	scopes.declare(stmt.Name)
+	declare(stmt.Name, KindVar)
 	scopes.define(stmt.Name)
 	resolveFunction(stmt, Function)
 }
 
 func resolveFunction(function *ast.FunctionStmt, typ functionType) {
-	enclosingFunction := curFunctionType
-	curFunctionType = typ
+	enclosingFunction, enclosingAsync := curFunctionType, curAsync
+	curFunctionType, curAsync = typ, function.IsAsync
 	defer func() {
-		curFunctionType = enclosingFunction
+		curFunctionType, curAsync = enclosingFunction, enclosingAsync
 	}()
+	if function.IsAsync && typ == Initializer {
+		errors.Error(token.Async, "An initializer cannot be async.")
+	}
 
 	scopes.begin()
 	for _, param := range function.Params {
-		scopes.declare(param.Name)
-		scopes.define(param.Name)
+		// default values are evaluated in the function scope and may refer to the former parameters.
+		if param.Default != nil {
+			Resolve(param.Default)
+		}
+		names := []string{param.Name}
+		if param.Pattern != nil {
+			names = ast.PatternNames(param.Pattern)
+		}
+		for _, name := range names {
+			scopes.declare(name)
+			scopes.define(name)
+		}
 	}
 	resolveBlock(function.Body)
 	scopes.end()
@@ -263,6 +593,24 @@ func resolvePrintStmt(stmt *ast.PrintStmt) {
 	Resolve(stmt.Expression)
 }
 
+func resolveYieldExpr(expr *ast.YieldExpr) {
+	if curFunctionType == FunctionNone {
+		errors.Error(token.Yield, "Cannot yield outside of a function.")
+		return
+	}
+	if curFunctionType == Initializer {
+		errors.Error(token.Yield, "Cannot yield from an initializer.")
+		return
+	}
+	if curAsync {
+		errors.Error(token.Yield, "Cannot yield in an async function.")
+		return
+	}
+	if expr.Value != nil {
+		Resolve(expr.Value)
+	}
+}
+
 func resolveReturnStmt(stmt *ast.ReturnStmt) {
 	if curFunctionType == FunctionNone {
 		errors.Error(token.Return, "Cannot return from top-level code.")
@@ -277,14 +625,33 @@ func resolveReturnStmt(stmt *ast.ReturnStmt) {
 	}
 }
 
+func resolveDeferStmt(stmt *ast.DeferStmt) {
+	if curFunctionType == FunctionNone {
+		errors.Error(token.Defer, "Cannot defer from top-level code.")
+		return
+	}
+	Resolve(stmt.Expression)
+}
+
+func resolveAwaitExpr(expr *ast.AwaitExpr) {
+	if !curAsync {
+		errors.Error(token.Await, "Cannot use await outside of an async function.")
+		return
+	}
+	Resolve(expr.Value)
+}
+
 func resolveClassStmt(stmt *ast.ClassStmt) {
-	scopes.declare(stmt.Name)
+	for _, trait := range stmt.Traits {
+		Resolve(trait)
+	}
+	declare(stmt.Name, KindVar)
 	scopes.define(stmt.Name)
 
-	enclosingClass := curClassType
-	curClassType = Class
+	enclosingClass, enclosingStmt := curClassType, curClass
+	curClassType, curClass = Class, stmt
 	defer func() {
-		curClassType = enclosingClass
+		curClassType, curClass = enclosingClass, enclosingStmt
 	}()
 
 	scopes.begin()
@@ -297,5 +664,17 @@ func resolveClassStmt(stmt *ast.ClassStmt) {
 		}
 		resolveFunction(method, typ)
 	}
+	for _, methods := range [][]*ast.FunctionStmt{stmt.Getters, stmt.Setters, stmt.StaticMethods} {
+		for _, method := range methods {
+			resolveFunction(method, Method)
+		}
+	}
+	for _, fields := range [][]*ast.FieldDecl{stmt.Fields, stmt.StaticFields} {
+		for _, field := range fields {
+			if field.Initializer != nil {
+				Resolve(field.Initializer)
+			}
+		}
+	}
 	scopes.end()
 }
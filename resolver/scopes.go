@@ -7,21 +7,49 @@ import (
 	"tiny-script/token"
 )
 
+// Kind represents how a variable was declared.
+type Kind int
+
+const (
+	KindVar   Kind = iota // var, function, class, parameter
+	KindLet               // let
+	KindConst             // const
+)
+
+// binding represents a declared variable in a scope.
+type binding struct {
+	kind Kind
+	// defined reports whether the initializer of the variable has been resolved.
+	defined bool
+	// hoisted reports whether the variable was declared ahead of its let/const statement.
+	hoisted bool
+}
+
 // Scopes represents variable scopes.
-type Scopes []map[string]bool
+type Scopes []map[string]*binding
 
 func (s *Scopes) check(name string) (exist bool, init bool) {
 	if !s.isEmpty() {
 		scope := s.peek()
-		if _, ok := scope[name]; ok {
-			return true, ok
+		if b, ok := scope[name]; ok {
+			return true, b.defined
 		}
 	}
 	return false, false
 }
 
+// lookup returns the nearest binding of name, or nil for a global variable.
+func (s Scopes) lookup(name string) *binding {
+	for i := len(s) - 1; i >= 0; i-- {
+		if b, ok := s[i][name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
 func (s *Scopes) begin() {
-	scope := make(map[string]bool)
+	scope := make(map[string]*binding)
 	*s = append(*s, scope)
 }
 
@@ -29,7 +57,7 @@ func (s *Scopes) end() {
 	s.pop()
 }
 
-func (s Scopes) peek() map[string]bool {
+func (s Scopes) peek() map[string]*binding {
 	if s.isEmpty() {
 		panic("scope peek error: empty scopes")
 	}
@@ -48,14 +76,34 @@ func (s Scopes) isEmpty() bool {
 }
 
 func (s Scopes) declare(name string) {
+	s.declareAs(name, KindVar)
+}
+
+// declareAs declares name with the given kind, the let/const declaration
+// hoisted by hoist is completed instead of being reported as redeclared.
+func (s Scopes) declareAs(name string, kind Kind) {
 	if s.isEmpty() {
 		return
 	}
 	scope := s.peek()
-	if _, ok := scope[name]; ok {
+	if b, ok := scope[name]; ok {
+		if b.hoisted && b.kind == kind {
+			b.hoisted = false
+			return
+		}
 		errors.Error(token.Let, fmt.Sprintf("variable name %q has been already delcared in this scope.", name))
 	}
-	scope[name] = false
+	scope[name] = &binding{kind: kind}
+}
+
+// hoist declares a let/const variable at the beginning of its block,
+// so that it shadows outer variables before its declaration (temporal dead zone).
+func (s Scopes) hoist(name string, kind Kind) {
+	if s.isEmpty() {
+		return
+	}
+	s.declareAs(name, kind)
+	s.peek()[name].hoisted = true
 }
 
 func (s Scopes) define(name string) {
@@ -63,10 +111,10 @@ func (s Scopes) define(name string) {
 		return
 	}
 	scope := s.peek()
-	scope[name] = true
+	scope[name].defined = true
 }
 
 // NewScopes returns Scopes instance.
 func NewScopes() Scopes {
-	return make([]map[string]bool, 0)
+	return make([]map[string]*binding, 0)
 }
@@ -19,27 +19,36 @@ const (
 	RightBrace   // }
 	Comma        // ,
 	Dot          // .
+	Ellipsis     // ...
+	DotDot       // ..
+	DotDotEqual  // ..=
+	Arrow        // =>
 	Minus        // -
 	Plus         // +
 	Semicolon    // ;
+	Colon        // :
 	Slash        // /
 	Star         // *
 
-	Bang         // !
-	BangEqual    // !=
-	Equal        // =
-	EqualEqual   // ==
-	Greater      // >
-	GreaterEqual // >=
-	Less         // <
-	LessEqual    // <=
+	Bang            // !
+	BangEqual       // !=
+	BangEqualEqual  // !==
+	Equal           // =
+	EqualEqual      // ==
+	EqualEqualEqual // ===
+	Greater         // >
+	GreaterEqual    // >=
+	Less            // <
+	LessEqual       // <=
 
 	And // &
 	Or  // |
 
-	Identifier // abc
-	String     // "abc"
-	Number     // 123
+	Identifier  // abc
+	String      // "abc"
+	Number      // 123
+	Template    // `a${b}c`
+	PrivateName // #abc
 
 	keywordBegin
 
@@ -48,6 +57,7 @@ const (
 	False    // false
 	Function // function
 	For      // for
+	In       // in
 	If       // if
 	Nil      // nil
 	Print    // print
@@ -57,57 +67,97 @@ const (
 	True     // true
 	Var      // var
 	Let      // let
+	Const    // const
 	While    // while
 	Import   // import
+	Yield    // yield
+	Spawn    // spawn
+	Select   // select
+	Case     // case
+	Default  // default
+	Async    // async
+	Await    // await
+	Match    // match
+	Enum     // enum
+	Static   // static
+	Trait    // trait
+	With     // with
+	Is       // is
+	Defer    // defer
 
 	keywordEnd
 )
 
 var tokens = [...]string{
-	Illegal:      "illegal",
-	EOF:          "EOF",
-	LeftParen:    "(",
-	RightParen:   ")",
-	LeftBracket:  "[",
-	RightBracket: "]",
-	LeftBrace:    "{",
-	RightBrace:   "}",
-	Comma:        ",",
-	Dot:          ".",
-	Minus:        "-",
-	Plus:         "+",
-	Semicolon:    ";",
-	Slash:        "/",
-	Star:         "*",
-	Bang:         "!",
-	BangEqual:    "!=",
-	Equal:        "=",
-	EqualEqual:   "==",
-	Greater:      ">",
-	GreaterEqual: ">=",
-	Less:         "<",
-	LessEqual:    "<=",
-	Identifier:   "identifier",
-	String:       "string",
-	Number:       "number",
-	And:          "&",
-	Class:        "class",
-	Else:         "else",
-	False:        "false",
-	Function:     "function",
-	For:          "for",
-	If:           "if",
-	Nil:          "nil",
-	Or:           "|",
-	Print:        "print",
-	Return:       "return",
-	Super:        "super",
-	This:         "this",
-	True:         "true",
-	Var:          "var",
-	Let:          "let",
-	While:        "while",
-	Import:       "import",
+	Illegal:         "illegal",
+	EOF:             "EOF",
+	LeftParen:       "(",
+	RightParen:      ")",
+	LeftBracket:     "[",
+	RightBracket:    "]",
+	LeftBrace:       "{",
+	RightBrace:      "}",
+	Comma:           ",",
+	Dot:             ".",
+	Ellipsis:        "...",
+	DotDot:          "..",
+	DotDotEqual:     "..=",
+	Arrow:           "=>",
+	Minus:           "-",
+	Plus:            "+",
+	Semicolon:       ";",
+	Colon:           ":",
+	Slash:           "/",
+	Star:            "*",
+	Bang:            "!",
+	BangEqual:       "!=",
+	BangEqualEqual:  "!==",
+	Equal:           "=",
+	EqualEqual:      "==",
+	EqualEqualEqual: "===",
+	Greater:         ">",
+	GreaterEqual:    ">=",
+	Less:            "<",
+	LessEqual:       "<=",
+	Identifier:      "identifier",
+	String:          "string",
+	Number:          "number",
+	Template:        "template",
+	PrivateName:     "private name",
+	And:             "&",
+	Class:           "class",
+	Else:            "else",
+	False:           "false",
+	Function:        "function",
+	For:             "for",
+	In:              "in",
+	If:              "if",
+	Nil:             "nil",
+	Or:              "|",
+	Print:           "print",
+	Return:          "return",
+	Super:           "super",
+	This:            "this",
+	True:            "true",
+	Var:             "var",
+	Let:             "let",
+	Const:           "const",
+	While:           "while",
+	Import:          "import",
+	Yield:           "yield",
+	Spawn:           "spawn",
+	Select:          "select",
+	Case:            "case",
+	Default:         "default",
+	Async:           "async",
+	Await:           "await",
+	Match:           "match",
+	Enum:            "enum",
+	Static:          "static",
+	Trait:           "trait",
+	With:            "with",
+	Is:              "is",
+	Defer:           "defer",
 }
 
 var keywords = map[string]Token{}
@@ -0,0 +1,164 @@
+package valuer
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// BigInt is an arbitrary-precision integer, such as 123n.
+type BigInt struct {
+	Value *big.Int
+}
+
+// Type returns its Type.
+func (*BigInt) Type() Type { return BigIntType }
+
+func (b *BigInt) String() string { return b.Value.String() }
+
+// Decimal is an exact decimal number, such as 12.34d, its value is Unscaled * 10^-Scale.
+type Decimal struct {
+	Unscaled *big.Int
+	Scale    int
+}
+
+// Type returns its Type.
+func (*Decimal) Type() Type { return DecimalType }
+
+func (d *Decimal) String() string {
+	digits := new(big.Int).Abs(d.Unscaled).String()
+	sign := ""
+	if d.Unscaled.Sign() < 0 {
+		sign = "-"
+	}
+	if d.Scale <= 0 {
+		return sign + digits + strings.Repeat("0", -d.Scale)
+	}
+	if len(digits) <= d.Scale {
+		digits = strings.Repeat("0", d.Scale-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-d.Scale] + "." + digits[len(digits)-d.Scale:]
+}
+
+// Rat returns the exact value of d.
+func (d *Decimal) Rat() *big.Rat {
+	r := new(big.Rat).SetInt(d.Unscaled)
+	if d.Scale > 0 {
+		return r.Quo(r, new(big.Rat).SetInt(pow10(d.Scale)))
+	}
+	return r.Mul(r, new(big.Rat).SetInt(pow10(-d.Scale)))
+}
+
+// Rescale returns d with the given scale, which must not be less than the scale of d.
+func (d *Decimal) Rescale(scale int) *Decimal {
+	if scale <= d.Scale {
+		return d
+	}
+	unscaled := new(big.Int).Mul(d.Unscaled, pow10(scale-d.Scale))
+	return &Decimal{Unscaled: unscaled, Scale: scale}
+}
+
+// Rounding is the rounding mode of decimals.
+type Rounding string
+
+const (
+	RoundHalfEven Rounding = "half_even"
+	RoundHalfUp   Rounding = "half_up"
+	RoundHalfDown Rounding = "half_down"
+	RoundUp       Rounding = "up"   // away from zero
+	RoundDown     Rounding = "down" // toward zero
+	RoundCeiling  Rounding = "ceiling"
+	RoundFloor    Rounding = "floor"
+)
+
+// Roundings are the supported rounding modes.
+var Roundings = []Rounding{RoundHalfEven, RoundHalfUp, RoundHalfDown, RoundUp, RoundDown, RoundCeiling, RoundFloor}
+
+var errInvalidDecimal = errors.New("invalid decimal")
+
+// ParseDecimal parses a decimal such as 12.34, -1.5e3 or 100.
+func ParseDecimal(s string) (*Decimal, error) {
+	s = strings.TrimSpace(s)
+	exp := 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, ok := new(big.Int).SetString(s[i+1:], 10)
+		if !ok || !e.IsInt64() || e.Int64() > 1<<20 || e.Int64() < -1<<20 {
+			return nil, errInvalidDecimal
+		}
+		s, exp = s[:i], int(e.Int64())
+	}
+	scale := 0
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		scale = len(s) - i - 1
+		s = s[:i] + s[i+1:]
+	}
+	if s == "" || s == "+" || s == "-" || strings.ContainsAny(s[1:], "+-") {
+		return nil, errInvalidDecimal
+	}
+	unscaled, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return nil, errInvalidDecimal
+	}
+	d := &Decimal{Unscaled: unscaled, Scale: scale - exp}
+	if d.Scale < 0 {
+		d = d.Rescale(0)
+	}
+	return d, nil
+}
+
+// RoundRat rounds r to a decimal with scale fractional digits by mode.
+func RoundRat(r *big.Rat, scale int, mode Rounding) *Decimal {
+	num := new(big.Int).Mul(r.Num(), pow10(scale))
+	den := r.Denom()
+	q, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Sign() != 0 {
+		// compare the remainder with the half of the divisor.
+		half := new(big.Int).Abs(rem)
+		half.Mul(half, big.NewInt(2))
+		c := half.Cmp(den)
+		negative := num.Sign() < 0
+		var away bool
+		switch mode {
+		case RoundHalfUp:
+			away = c >= 0
+		case RoundHalfDown:
+			away = c > 0
+		case RoundUp:
+			away = true
+		case RoundDown:
+			away = false
+		case RoundCeiling:
+			away = !negative
+		case RoundFloor:
+			away = negative
+		default:
+			away = c > 0 || c == 0 && q.Bit(0) == 1
+		}
+		if away {
+			if negative {
+				q.Sub(q, big.NewInt(1))
+			} else {
+				q.Add(q, big.NewInt(1))
+			}
+		}
+	}
+	return &Decimal{Unscaled: q, Scale: scale}
+}
+
+// Trim removes the trailing zeros of the fraction of d, keeping at least scale digits.
+func (d *Decimal) Trim(scale int) *Decimal {
+	unscaled, s := new(big.Int).Set(d.Unscaled), d.Scale
+	ten, rem := big.NewInt(10), new(big.Int)
+	for s > scale {
+		q, r := new(big.Int).QuoRem(unscaled, ten, rem)
+		if r.Sign() != 0 {
+			break
+		}
+		unscaled, s = q, s-1
+	}
+	return &Decimal{Unscaled: unscaled, Scale: s}
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
@@ -1,16 +1,26 @@
 package valuer
 
+import "sync"
+
+// Environment is safe for concurrent use, since closures and globals are
+// shared by the threads of spawned tasks.
 type Environment struct {
+	mu        sync.RWMutex
 	Values    map[string]Valuer
 	Enclosing *Environment
 }
 
 func (env *Environment) Define(key string, v Valuer) {
+	env.mu.Lock()
 	env.Values[key] = v
+	env.mu.Unlock()
 }
 
 func (env *Environment) Get(key string) (Valuer, bool) {
-	if v, ok := env.Values[key]; ok {
+	env.mu.RLock()
+	v, ok := env.Values[key]
+	env.mu.RUnlock()
+	if ok {
 		return v, true
 	}
 	if env.Enclosing != nil {
@@ -24,8 +34,13 @@ func (env *Environment) GetAt(distance int, key string) (Valuer, bool) {
 }
 
 func (env *Environment) Assign(key string, v Valuer) bool {
-	if _, ok := env.Values[key]; ok {
+	env.mu.Lock()
+	_, ok := env.Values[key]
+	if ok {
 		env.Values[key] = v
+	}
+	env.mu.Unlock()
+	if ok {
 		return true
 	}
 	if env.Enclosing != nil {
@@ -0,0 +1,131 @@
+package valuer
+
+import (
+	"sync"
+)
+
+// Map holds entries in the order of insertion. An entry is found by the hash
+// of its key, and the keys of the same hash are told apart by an equal function
+// given by the caller, which is called without holding the lock of the map.
+type Map struct {
+	mu      sync.RWMutex
+	buckets map[uint64][]*MapEntry
+	entries []*MapEntry
+	version int // increased by every change of the keys
+}
+
+// MapEntry is a key and its value.
+type MapEntry struct {
+	Key   Valuer
+	Value Valuer
+	hash  uint64
+}
+
+// Type returns its Type.
+func (*Map) Type() Type { return MapType }
+
+func (m *Map) String() string {
+	return display(m)
+}
+
+// Len returns the number of entries.
+func (m *Map) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.entries)
+}
+
+// Entries returns a copy of the entries in the order of insertion.
+func (m *Map) Entries() []MapEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entries := make([]MapEntry, len(m.entries))
+	for i, e := range m.entries {
+		entries[i] = *e
+	}
+	return entries
+}
+
+// find returns the entry of hash whose key is equal, and the version of the
+// map it was found in.
+func (m *Map) find(hash uint64, equal func(key Valuer) bool) (*MapEntry, int) {
+	m.mu.RLock()
+	bucket := append([]*MapEntry(nil), m.buckets[hash]...)
+	version := m.version
+	m.mu.RUnlock()
+	for _, e := range bucket {
+		if equal(e.Key) {
+			return e, version
+		}
+	}
+	return nil, version
+}
+
+// Get returns the value of the key of hash.
+func (m *Map) Get(hash uint64, equal func(key Valuer) bool) (Valuer, bool) {
+	e, _ := m.find(hash, equal)
+	if e == nil {
+		return nil, false
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return e.Value, true
+}
+
+// Set replaces the value of the key of hash, or adds the key if it is absent.
+func (m *Map) Set(hash uint64, key, value Valuer, equal func(key Valuer) bool) {
+	for {
+		e, version := m.find(hash, equal)
+		m.mu.Lock()
+		if m.version != version {
+			// the keys changed while comparing them, look again.
+			m.mu.Unlock()
+			continue
+		}
+		if e != nil {
+			e.Value = value
+		} else {
+			if m.buckets == nil {
+				m.buckets = make(map[uint64][]*MapEntry)
+			}
+			e = &MapEntry{Key: key, Value: value, hash: hash}
+			m.buckets[hash] = append(m.buckets[hash], e)
+			m.entries = append(m.entries, e)
+			m.version++
+		}
+		m.mu.Unlock()
+		return
+	}
+}
+
+// Delete removes the key of hash, and reports whether it was present.
+func (m *Map) Delete(hash uint64, equal func(key Valuer) bool) bool {
+	for {
+		e, version := m.find(hash, equal)
+		if e == nil {
+			return false
+		}
+		m.mu.Lock()
+		if m.version != version {
+			m.mu.Unlock()
+			continue
+		}
+		m.buckets[hash] = removeEntry(m.buckets[hash], e)
+		if len(m.buckets[hash]) == 0 {
+			delete(m.buckets, hash)
+		}
+		m.entries = removeEntry(m.entries, e)
+		m.version++
+		m.mu.Unlock()
+		return true
+	}
+}
+
+func removeEntry(entries []*MapEntry, e *MapEntry) []*MapEntry {
+	for i, x := range entries {
+		if x == e {
+			return append(entries[:i:i], entries[i+1:]...)
+		}
+	}
+	return entries
+}
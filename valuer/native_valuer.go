@@ -19,9 +19,9 @@ func GetNativeInstance(objName string) Valuer {
 
 	// 获取对象的所有方法
 	for k, v := range nativeObj {
-		var params []*ast.Ident
+		var params []*ast.Param
 		for _, param := range v.Params {
-			params = append(params, &ast.Ident{
+			params = append(params, &ast.Param{
 				Name: param,
 			})
 		}
@@ -0,0 +1,155 @@
+package valuer
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// printer formats values for print and repr. Strings nested in other values
+// are quoted and their numbers written as literals of their type, an instance
+// shows its public fields unless its class defines toString or __str__, and a
+// value met again inside itself, or inside its own toString or __str__, is
+// printed as ...
+type printer struct {
+	indent   string // indentation of a nested level, empty to print on a single line
+	visiting map[Valuer]bool
+	toString StringMethod
+	buf      strings.Builder
+}
+
+// Repr formats v as a literal, a string is quoted even at the top level. The
+// elements of arrays, maps and instances are put on their own lines indented
+// by indent spaces if indent is positive.
+func Repr(v Valuer, indent int, toString StringMethod) string {
+	p := &printer{indent: strings.Repeat(" ", indent), visiting: make(map[Valuer]bool), toString: toString}
+	p.print(v, 0)
+	return p.buf.String()
+}
+
+// Display formats v as print shows it.
+func Display(v Valuer, toString StringMethod) string {
+	p := &printer{visiting: make(map[Valuer]bool), toString: toString}
+	p.print(v, -1)
+	return p.buf.String()
+}
+
+// display formats v as print shows it for String.
+func display(v Valuer) string {
+	return Display(v, CallStringMethod)
+}
+
+// print writes v nested at depth, the depth of the value printed by print is
+// -1 so that its strings are not quoted.
+func (p *printer) print(v Valuer, depth int) {
+	switch x := v.(type) {
+	case *String:
+		if depth < 0 {
+			p.buf.WriteString(x.Value)
+		} else {
+			p.buf.WriteString(strconv.Quote(x.Value))
+		}
+	case *Array:
+		if p.enter(x, "[...]") {
+			defer delete(p.visiting, x)
+			elements := x.Snapshot()
+			p.list("[", "]", len(elements), depth, func(i int) { p.print(elements[i], p.nested(depth)) })
+		}
+	case *Map:
+		if p.enter(x, "{...}") {
+			defer delete(p.visiting, x)
+			entries := x.Entries()
+			p.list("{", "}", len(entries), depth, func(i int) {
+				p.print(entries[i].Key, p.nested(depth))
+				p.buf.WriteString(": ")
+				p.print(entries[i].Value, p.nested(depth))
+			})
+		}
+	case *Instance:
+		if method := x.stringMethod(); method != nil && p.toString != nil {
+			if s, ok := p.toString(x, method); ok {
+				p.buf.WriteString(s)
+			} else {
+				p.buf.WriteString(x.Klass.Name + "{...}")
+			}
+		} else if p.enter(x, x.Klass.Name+"{...}") {
+			defer delete(p.visiting, x)
+			names := x.publicFieldNames()
+			p.list(x.Klass.Name+"{", "}", len(names), depth, func(i int) {
+				v, _ := x.Get(names[i])
+				p.buf.WriteString(names[i] + ": ")
+				p.print(v, p.nested(depth))
+			})
+		}
+	case *Number:
+		p.buf.WriteString(x.String())
+		// a literal keeps the type of the number, 1.0 is not the int 1.
+		if depth >= 0 && !math.IsInf(x.Value, 0) && x.Value == math.Trunc(x.Value) {
+			p.buf.WriteString(".0")
+		}
+	case *BigInt:
+		p.buf.WriteString(x.String())
+		if depth >= 0 {
+			p.buf.WriteString("n")
+		}
+	case *Decimal:
+		p.buf.WriteString(x.String())
+		if depth >= 0 {
+			p.buf.WriteString("d")
+		}
+	case *EnumValue:
+		p.buf.WriteString(x.Variant.Enum.Name + "." + x.Variant.Name)
+		if x.Variant.Params != nil {
+			p.buf.WriteString("(")
+			for i, f := range x.Fields {
+				if i > 0 {
+					p.buf.WriteString(", ")
+				}
+				p.print(f, p.nested(depth))
+			}
+			p.buf.WriteString(")")
+		}
+	default:
+		p.buf.WriteString(v.String())
+	}
+}
+
+// enter marks v as being printed, or prints cycle and returns false if v
+// is being printed already.
+func (p *printer) enter(v Valuer, cycle string) bool {
+	if p.visiting[v] {
+		p.buf.WriteString(cycle)
+		return false
+	}
+	p.visiting[v] = true
+	return true
+}
+
+func (p *printer) nested(depth int) int {
+	if depth < 0 {
+		return 1
+	}
+	return depth + 1
+}
+
+// list writes n items between open and close, each item is written by item.
+func (p *printer) list(open, close string, n, depth int, item func(i int)) {
+	p.buf.WriteString(open)
+	if n == 0 || p.indent == "" {
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				p.buf.WriteString(", ")
+			}
+			item(i)
+		}
+		p.buf.WriteString(close)
+		return
+	}
+	level := p.nested(depth)
+	for i := 0; i < n; i++ {
+		p.buf.WriteString("\n" + strings.Repeat(p.indent, level))
+		item(i)
+		p.buf.WriteString(",")
+	}
+	p.buf.WriteString("\n" + strings.Repeat(p.indent, level-1) + close)
+}
@@ -2,34 +2,61 @@ package valuer
 
 import (
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 
 	"tiny-script/ast"
 )
 
 var typeMap = map[Type]string{
-	NumberType:   "number",
-	StringType:   "string",
-	BooleanType:  "bool",
-	NilType:      "nil",
-	FunctionType: "function",
-	ReturnType:   "return",
-	ClassType:    "class",
+	NumberType:    "float",
+	IntType:       "int",
+	BigIntType:    "bigint",
+	DecimalType:   "decimal",
+	GeneratorType: "generator",
+	TaskType:      "task",
+	ChannelType:   "chan",
+	PromiseType:   "promise",
+	EnumType:      "enum",
+	VariantType:   "variant",
+	TraitType:     "trait",
+	MapType:       "map",
+	StringType:    "string",
+	BooleanType:   "bool",
+	NilType:       "nil",
+	FunctionType:  "function",
+	ReturnType:    "return",
+	ClassType:     "class",
+	InstanceType:  "instance",
+	ArrayType:     "array",
 }
 
 // Type represents type of Valuer.
 type Type int
 
 const (
-	NumberType   Type = iota + 1 // number
-	StringType                   // string
-	BooleanType                  // bool
-	NilType                      // nil
-	FunctionType                 // function
-	ReturnType                   // return
-	ClassType                    // class
-	InstanceType                 // instance
-	ArrayType                    // array
+	NumberType    Type = iota + 1 // float
+	StringType                    // string
+	BooleanType                   // bool
+	NilType                       // nil
+	FunctionType                  // function
+	ReturnType                    // return
+	ClassType                     // class
+	InstanceType                  // instance
+	ArrayType                     // array
+	IntType                       // int
+	BigIntType                    // bigint
+	DecimalType                   // decimal
+	GeneratorType                 // generator
+	TaskType                      // task
+	ChannelType                   // chan
+	PromiseType                   // promise
+	EnumType                      // enum
+	VariantType                   // variant
+	TraitType                     // trait
+	MapType                       // map
 )
 
 func (typ Type) String() string {
@@ -46,7 +73,9 @@ type Valuer interface {
 
 type Callable interface {
 	call()
-	Arity() int
+	// Arity returns the minimum and maximum number of arguments,
+	// the maximum is -1 if the callable accepts any number of arguments.
+	Arity() (int, int)
 }
 
 type Number struct {
@@ -60,6 +89,19 @@ func (num *Number) String() string {
 	return strconv.FormatFloat(num.Value, 'f', -1, 64)
 }
 
+// Int is an integer number, the arithmetic between ints stays exact
+// while mixing with Number promotes to float.
+type Int struct {
+	Value int64
+}
+
+// Type returns its Type.
+func (*Int) Type() Type { return IntType }
+
+func (i *Int) String() string {
+	return strconv.FormatInt(i.Value, 10)
+}
+
 type String struct {
 	Value string
 }
@@ -87,10 +129,12 @@ func (*Nil) String() string { return "nil" }
 
 type Function struct {
 	Name          string
-	Params        []*ast.Ident
+	Params        []*ast.Param
 	Body          []ast.Stmt
 	Closure       *Environment
 	IsInitializer bool
+	IsGenerator   bool
+	IsAsync       bool
 	NativeFunc    reflect.Value
 	IsErr         bool
 }
@@ -104,22 +148,247 @@ func (fn *Function) String() string {
 	return "<fn " + fn.Name + ">"
 }
 
-// Arity returns size of params.
-func (fn *Function) Arity() int {
-	return len(fn.Params)
+// Builtin is a function implemented by the interpreter, such as int() and float().
+type Builtin struct {
+	Name     string
+	Min, Max int
+	Fn       func(args []Valuer) Valuer
+}
+
+// Type returns its Type.
+func (*Builtin) Type() Type { return FunctionType }
+
+func (*Builtin) call() {}
+
+func (b *Builtin) String() string {
+	return "<native fn " + b.Name + ">"
+}
+
+// Arity returns the number of arguments accepted by the builtin.
+func (b *Builtin) Arity() (int, int) { return b.Min, b.Max }
+
+// Arity returns the number of required params and the number of all params,
+// the latter is -1 if the function has a rest param.
+func (fn *Function) Arity() (int, int) {
+	min, max := 0, 0
+	for _, param := range fn.Params {
+		if param.Rest {
+			return min, -1
+		}
+		if param.Default == nil {
+			min++
+		}
+		max++
+	}
+	return min, max
 }
 
-func (fn *Function) Bind(instance *Instance) *Function {
+// Bind returns fn with "this" bound to an instance, or to the class of a static method.
+func (fn *Function) Bind(this Valuer) *Function {
 	environment := NewEnclosing(fn.Closure)
-	environment.Define("this", instance)
+	environment.Define("this", this)
 	return &Function{
-		Name:       fn.Name,
-		Params:     fn.Params,
-		Body:       fn.Body,
-		Closure:    environment,
-		NativeFunc: fn.NativeFunc,
-		IsErr:      fn.IsErr,
+		Name:        fn.Name,
+		Params:      fn.Params,
+		Body:        fn.Body,
+		Closure:     environment,
+		IsGenerator: fn.IsGenerator,
+		IsAsync:     fn.IsAsync,
+		NativeFunc:  fn.NativeFunc,
+		IsErr:       fn.IsErr,
+	}
+}
+
+// Generator is returned by calling a generator function, Resume runs the
+// function until the next yield, and Close abandons the rest of it.
+type Generator struct {
+	Name   string
+	Resume func(sent Valuer) (v Valuer, done bool)
+	Close  func()
+}
+
+// Type returns its Type.
+func (*Generator) Type() Type { return GeneratorType }
+
+func (g *Generator) String() string {
+	return "<generator " + g.Name + ">"
+}
+
+// Task is returned by spawn, Wait blocks until the spawned call finishes and
+// returns its result.
+type Task struct {
+	Name string
+	Wait func() Valuer
+}
+
+// Type returns its Type.
+func (*Task) Type() Type { return TaskType }
+
+func (t *Task) String() string {
+	return "<task " + t.Name + ">"
+}
+
+// Channel passes values between tasks, it is unbuffered if C has no capacity.
+type Channel struct {
+	C chan Valuer
+}
+
+// Type returns its Type.
+func (*Channel) Type() Type { return ChannelType }
+
+func (c *Channel) String() string {
+	return "<chan " + strconv.Itoa(cap(c.C)) + ">"
+}
+
+// Trait is a set of methods mixed into the classes using it, the classes
+// must implement its required methods.
+type Trait struct {
+	Name     string
+	Methods  map[string]*Function
+	Required []string
+}
+
+// Type returns its Type.
+func (*Trait) Type() Type { return TraitType }
+
+func (t *Trait) String() string {
+	return "<trait " + t.Name + ">"
+}
+
+// Enum is the namespace of variants created by an enum declaration.
+type Enum struct {
+	Name     string
+	Variants []*EnumVariant // in the order of declaration
+}
+
+// Type returns its Type.
+func (*Enum) Type() Type { return EnumType }
+
+func (e *Enum) String() string {
+	return "<enum " + e.Name + ">"
+}
+
+// Variant returns the variant named name, or nil if there is none.
+func (e *Enum) Variant(name string) *EnumVariant {
+	for _, v := range e.Variants {
+		if v.Name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// EnumVariant is a variant of an enum. A variant without params is a single
+// value, while a variant with params is called to make values carrying them.
+type EnumVariant struct {
+	Enum        *Enum
+	Name        string
+	Value       Valuer   // the explicit or implicit value, nil for a variant with params
+	Params      []string // nil for a variant without params
+	Unit        *EnumValue
+	Constructor *Builtin
+}
+
+// EnumValue is a value of an enum variant, Fields holds the arguments of
+// a variant with params.
+type EnumValue struct {
+	Variant *EnumVariant
+	Fields  []Valuer
+}
+
+// Type returns its Type.
+func (*EnumValue) Type() Type { return VariantType }
+
+func (v *EnumValue) String() string {
+	return display(v)
+}
+
+// Field returns the field named name of a variant with params.
+func (v *EnumValue) Field(name string) (Valuer, bool) {
+	for i, param := range v.Variant.Params {
+		if param == name {
+			return v.Fields[i], true
+		}
 	}
+	return nil, false
+}
+
+// PromiseState is the state of a Promise.
+type PromiseState int
+
+const (
+	Pending PromiseState = iota
+	Fulfilled
+	Rejected
+)
+
+func (s PromiseState) String() string {
+	return [...]string{"pending", "fulfilled", "rejected"}[s]
+}
+
+// Promise is the eventual result of an asynchronous operation, it is settled
+// once with a value or a rejection reason.
+type Promise struct {
+	mu       sync.Mutex
+	state    PromiseState
+	value    Valuer
+	handled  bool
+	handlers []func(PromiseState, Valuer)
+}
+
+// Type returns its Type.
+func (*Promise) Type() Type { return PromiseType }
+
+func (p *Promise) String() string {
+	state, _ := p.Result()
+	return "<promise " + state.String() + ">"
+}
+
+// Result returns the state and the value of the promise.
+func (p *Promise) Result() (PromiseState, Valuer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state, p.value
+}
+
+// Settle settles a pending promise and calls its handlers, it reports false
+// if the promise has been settled before.
+func (p *Promise) Settle(state PromiseState, v Valuer) bool {
+	p.mu.Lock()
+	if p.state != Pending {
+		p.mu.Unlock()
+		return false
+	}
+	p.state, p.value = state, v
+	handlers := p.handlers
+	p.handlers = nil
+	p.mu.Unlock()
+	for _, h := range handlers {
+		h(state, v)
+	}
+	return true
+}
+
+// OnSettled adds a handler called once the promise is settled, or at once if
+// it has been settled, and marks the promise as handled.
+func (p *Promise) OnSettled(h func(PromiseState, Valuer)) {
+	p.mu.Lock()
+	p.handled = true
+	if p.state == Pending {
+		p.handlers = append(p.handlers, h)
+		p.mu.Unlock()
+		return
+	}
+	state, v := p.state, p.value
+	p.mu.Unlock()
+	h(state, v)
+}
+
+// Handled reports whether a handler has been added to the promise.
+func (p *Promise) Handled() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.handled
 }
 
 type ReturnValue struct {
@@ -136,18 +405,26 @@ func (rt *ReturnValue) String() string {
 type ClassValue struct {
 	Name    string
 	Mehtods map[string]*Function
+	Getters map[string]*Function
+	Setters map[string]*Function
+	Fields  []*ast.FieldDecl // declared fields, initialized in Closure for each instance
+	Closure *Environment
+	Traits  []*Trait
+
+	mu      sync.RWMutex
+	statics map[string]Valuer // static fields and methods bound to the class
 }
 
 func (*ClassValue) Type() Type { return ClassType }
 
 func (*ClassValue) call() {}
 
-func (c *ClassValue) Arity() int {
+func (c *ClassValue) Arity() (int, int) {
 	initializer := c.FindMethod("init")
 	if initializer != nil {
 		return initializer.Arity()
 	}
-	return 0
+	return 0, 0
 }
 
 func (c *ClassValue) String() string {
@@ -161,19 +438,100 @@ func (c *ClassValue) FindMethod(key string) *Function {
 	return nil
 }
 
+// Implements reports whether the class uses trait.
+func (c *ClassValue) Implements(trait *Trait) bool {
+	for _, t := range c.Traits {
+		if t == trait {
+			return true
+		}
+	}
+	return false
+}
+
+// Declares reports whether the class declares the instance member key.
+func (c *ClassValue) Declares(key string) bool {
+	if c.Mehtods[key] != nil || c.Getters[key] != nil || c.Setters[key] != nil {
+		return true
+	}
+	for _, field := range c.Fields {
+		if field.Name == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *ClassValue) FindGetter(key string) *Function {
+	return c.Getters[key]
+}
+
+func (c *ClassValue) FindSetter(key string) *Function {
+	return c.Setters[key]
+}
+
+// GetStatic returns a static field or a static method of the class.
+func (c *ClassValue) GetStatic(key string) (Valuer, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	v, ok := c.statics[key]
+	return v, ok
+}
+
+func (c *ClassValue) SetStatic(key string, v Valuer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.statics == nil {
+		c.statics = make(map[string]Valuer)
+	}
+	c.statics[key] = v
+}
+
 type Instance struct {
+	mu     sync.RWMutex
 	Klass  *ClassValue
 	Fileds map[string]Valuer
 }
 
-func (*Instance) Type() Type { return ClassType }
+func (*Instance) Type() Type { return InstanceType }
+
+// StringMethod calls the toString or __str__ method of an instance and returns
+// its result, ok is false if the method is already being called for the
+// instance, which is then printed as a cycle.
+type StringMethod func(i *Instance, method *Function) (s string, ok bool)
+
+// CallStringMethod is the StringMethod of String, it is set by the interpreter.
+var CallStringMethod StringMethod
 
 func (i *Instance) String() string {
-	return i.Klass.Name + " instance"
+	return display(i)
+}
+
+// stringMethod returns the toString or __str__ method of the class, or nil.
+func (i *Instance) stringMethod() *Function {
+	for _, name := range []string{"toString", "__str__"} {
+		if method := i.Klass.FindMethod(name); method != nil {
+			return method
+		}
+	}
+	return nil
+}
+
+// publicFieldNames returns the sorted names of the fields not starting with #.
+func (i *Instance) publicFieldNames() []string {
+	names := make([]string, 0)
+	for _, name := range i.FieldNames() {
+		if !strings.HasPrefix(name, "#") {
+			names = append(names, name)
+		}
+	}
+	return names
 }
 
 func (i *Instance) Get(key string) (Valuer, bool) {
-	if v, ok := i.Fileds[key]; ok {
+	i.mu.RLock()
+	v, ok := i.Fileds[key]
+	i.mu.RUnlock()
+	if ok {
 		return v, ok
 	}
 	if method := i.Klass.FindMethod(key); method != nil {
@@ -182,27 +540,67 @@ func (i *Instance) Get(key string) (Valuer, bool) {
 	return nil, false
 }
 
+// HasField reports whether the field key has been set on the instance.
+func (i *Instance) HasField(key string) bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	_, ok := i.Fileds[key]
+	return ok
+}
+
+// FieldNames returns the sorted names of the fields set on the instance.
+func (i *Instance) FieldNames() []string {
+	i.mu.RLock()
+	names := make([]string, 0, len(i.Fileds))
+	for name := range i.Fileds {
+		names = append(names, name)
+	}
+	i.mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
 func (i *Instance) Set(key string, v Valuer) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
 	if i.Fileds == nil {
 		i.Fileds = make(map[string]Valuer)
 	}
 	i.Fileds[key] = v
 }
 
+// Array has a fixed length, its elements are guarded for concurrent use.
 type Array struct {
+	mu       sync.RWMutex
 	Elements []Valuer
 }
 
 func (*Array) Type() Type { return ArrayType }
 
+// Len returns the number of elements.
+func (a *Array) Len() int { return len(a.Elements) }
+
+// Get returns the element at index i.
+func (a *Array) Get(i int) Valuer {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.Elements[i]
+}
+
+// Set replaces the element at index i.
+func (a *Array) Set(i int, v Valuer) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.Elements[i] = v
+}
+
+// Snapshot returns a copy of the elements.
+func (a *Array) Snapshot() []Valuer {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return append([]Valuer(nil), a.Elements...)
+}
+
 func (a *Array) String() string {
-	str := "["
-	for i, e := range a.Elements {
-		str += e.String()
-		if i != len(a.Elements)-1 {
-			str += ", "
-		}
-	}
-	str += "]"
-	return str
+	return display(a)
 }